@@ -0,0 +1,373 @@
+//Package as51 is a two pass assembler for standard Intel syntax 8051
+//assembly. Instructions are encoded from the same descriptor tables
+//that mu51 decodes with, so the assembler and decoder can be checked
+//against each other.
+//
+//Source is line oriented, each line holding an optional label, an
+//instruction or directive and an optional ; comment
+//
+//	count   EQU  30h
+//	        ORG  0
+//	main:   MOV  count,#10
+//	.loop:  DJNZ count,.loop
+//	        SJMP $
+//	msg:    DB   "Hi",0
+//
+//The supported directives are ORG, DB, DW (big endian), DS, END and
+//name EQU value, where SET, DATA, IDATA, XDATA, BIT and CODE are accepted
+//in place of EQU. Labels starting with a dot are local to the preceding
+//global label. Symbols are case insensitive and include the standard
+//SFR and bit names, bits may also be written as address.n (ACC.7, 20h.3).
+//Expressions support + - * / % & | ^ ~ << >>, HIGH, LOW, parentheses,
+//'c' characters and $ for the address of the current line. Numbers are
+//decimal by default, with h or 0x for hex, b for binary and o or q for
+//octal. The generic JMP and CALL are always assembled as LJMP and LCALL
+package as51
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/JonathanFraser/go51/ihex"
+)
+
+//Error is returned for any problem found in the source,
+//Line is the 1 based source line it was found on
+type Error struct {
+	Line int
+	Err  error
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+//Program is the result of a successful assembly
+type Program struct {
+	Memory  ihex.RecordList   //assembled bytes in address order
+	Symbols map[string]uint16 //upper cased labels and EQU values, local labels as GLOBAL.LOCAL
+}
+
+//File returns the program as an intel hex file which can
+//be flattened into code memory with mu51.HexImage
+func (p *Program) File() ihex.File {
+	return ihex.File{Memory: p.Memory}
+}
+
+//Image returns the program as a flat code image running from address 0
+//to the last assembled byte, with gaps filled by pad
+func (p *Program) Image(pad byte) []byte {
+	size := p.File().Size()
+	img := make([]byte, size)
+	for i := range img {
+		img[i] = pad
+	}
+	for _, r := range p.Memory {
+		copy(img[r.Offset:], r.Data)
+	}
+	return img
+}
+
+//Assemble assembles the source read from r
+func Assemble(r io.Reader) (*Program, error) {
+	var lines []string
+	scn := bufio.NewScanner(r)
+	for scn.Scan() {
+		lines = append(lines, scn.Text())
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+
+	a := &assembler{symbols: make(map[string]int)}
+	for a.pass = 1; a.pass <= 2; a.pass++ {
+		a.pc, a.global = 0, ""
+		for i, text := range lines {
+			a.line = i + 1
+			done, err := a.assembleLine(text)
+			if err != nil {
+				return nil, Error{Line: a.line, Err: err}
+			}
+			if done {
+				break
+			}
+		}
+	}
+
+	p := &Program{Symbols: make(map[string]uint16, len(a.symbols))}
+	for name, v := range a.symbols {
+		p.Symbols[name] = uint16(v)
+	}
+	sort.Sort(a.mem)
+	for _, r := range a.mem {
+		if n := len(p.Memory); n > 0 {
+			last := &p.Memory[n-1]
+			if last.Offset+uint32(len(last.Data)) == r.Offset {
+				last.Data = append(last.Data, r.Data...)
+				continue
+			}
+		}
+		p.Memory = append(p.Memory, r)
+	}
+	return p, nil
+}
+
+//AssembleString assembles the source held in src
+func AssembleString(src string) (*Program, error) {
+	return Assemble(strings.NewReader(src))
+}
+
+//assembler holds the state of an assembly in progress
+type assembler struct {
+	pass   int
+	line   int
+	pc     int    //address of the next byte to be assembled
+	start  int    //address of the current line, the value of $
+	global string //last global label, the scope of local labels
+
+	symbols map[string]int
+	undef   bool //an undefined symbol was referenced during pass 1
+
+	mem  ihex.RecordList
+	used [0x10000]bool //addresses already assembled during pass 2
+}
+
+//equates are the keywords which may define a symbol in place of EQU
+var equates = map[string]bool{
+	"EQU": true, "SET": true, "DATA": true, "IDATA": true,
+	"XDATA": true, "BIT": true, "CODE": true,
+}
+
+//assembleLine processes a single source line and reports whether END was reached
+func (a *assembler) assembleLine(text string) (bool, error) {
+	text = strings.TrimSpace(stripComment(text))
+	a.start = a.pc
+
+	//a leading identifier is either a label or the name of an EQU
+	if n := identLen(text); n > 0 {
+		name := text[:n]
+		rest := strings.TrimSpace(text[n:])
+		if strings.HasPrefix(rest, ":") {
+			if err := a.define(name, a.pc, false); err != nil {
+				return false, err
+			}
+			if name[0] != '.' {
+				a.global = strings.ToUpper(name)
+			}
+			text = strings.TrimSpace(rest[1:])
+		} else if word, arg := splitWord(rest); equates[strings.ToUpper(word)] {
+			v, err := a.eval(arg)
+			if err != nil {
+				return false, err
+			}
+			if a.undef {
+				return false, nil //forward reference, resolved in pass 2
+			}
+			return false, a.define(name, v, strings.EqualFold(word, "SET"))
+		}
+	}
+	if text == "" {
+		return false, nil
+	}
+
+	word, arg := splitWord(text)
+	word = strings.ToUpper(word)
+	switch word {
+	case "END":
+		return true, nil
+	case "ORG":
+		v, err := a.eval(arg)
+		if err != nil {
+			return false, err
+		}
+		if a.undef {
+			return false, fmt.Errorf("ORG address must be defined before use")
+		}
+		if v < 0 || v > 0xFFFF {
+			return false, fmt.Errorf("ORG address %X out of range", v)
+		}
+		a.pc = v
+		return false, nil
+	case "DS":
+		v, err := a.eval(arg)
+		if err != nil {
+			return false, err
+		}
+		if a.undef {
+			return false, fmt.Errorf("DS size must be defined before use")
+		}
+		if v < 0 || a.pc+v > 0x10000 {
+			return false, fmt.Errorf("DS size %d out of range", v)
+		}
+		a.pc += v
+		return false, nil
+	case "DB":
+		return false, a.data(arg, 1)
+	case "DW":
+		return false, a.data(arg, 2)
+	}
+	return false, a.instruction(word, arg)
+}
+
+//define sets the value of a label or EQU symbol, redefinition
+//is only permitted for symbols defined with SET
+func (a *assembler) define(name string, v int, redefine bool) error {
+	name, err := a.qualify(name)
+	if err != nil {
+		return err
+	}
+	if old, ok := a.symbols[name]; ok && !redefine {
+		if a.pass == 1 {
+			return fmt.Errorf("symbol %s redefined", name)
+		}
+		if old != v {
+			return fmt.Errorf("symbol %s changed value between passes", name)
+		}
+	}
+	a.symbols[name] = v
+	return nil
+}
+
+//qualify upper cases a symbol name and prefixes local names with their scope
+func (a *assembler) qualify(name string) (string, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, ".") {
+		return name, nil
+	}
+	if a.global == "" {
+		return "", fmt.Errorf("local label %s has no preceding global label", name)
+	}
+	return a.global + name, nil
+}
+
+//data assembles the operands of DB (size 1) or DW (size 2)
+func (a *assembler) data(arg string, size int) error {
+	ops := splitOperands(arg)
+	if len(ops) == 0 {
+		return fmt.Errorf("missing data")
+	}
+	for _, op := range ops {
+		if s, ok := unquote(op); ok && len(s) != 1 {
+			if size != 1 {
+				return fmt.Errorf("strings are only allowed in DB")
+			}
+			if err := a.emit([]byte(s)...); err != nil {
+				return err
+			}
+			continue
+		}
+		v, err := a.eval(op)
+		if err != nil {
+			return err
+		}
+		if size == 1 {
+			if a.pass == 2 && (v < -0x80 || v > 0xFF) {
+				return fmt.Errorf("value %d does not fit in a byte", v)
+			}
+			err = a.emit(byte(v))
+		} else {
+			if a.pass == 2 && (v < -0x8000 || v > 0xFFFF) {
+				return fmt.Errorf("value %d does not fit in a word", v)
+			}
+			err = a.emit(byte(v>>8), byte(v))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//emit assembles bytes at the current address
+func (a *assembler) emit(b ...byte) error {
+	if a.pc+len(b) > 0x10000 {
+		return fmt.Errorf("code extends past the end of code memory")
+	}
+	if a.pass == 2 {
+		for i := range b {
+			if a.used[a.pc+i] {
+				return fmt.Errorf("address %04Xh assembled twice", a.pc+i)
+			}
+			a.used[a.pc+i] = true
+		}
+		if n := len(a.mem); n > 0 && int(a.mem[n-1].Offset)+len(a.mem[n-1].Data) == a.pc {
+			a.mem[n-1].Data = append(a.mem[n-1].Data, b...)
+		} else {
+			a.mem = append(a.mem, ihex.Record{Offset: uint32(a.pc), Data: append([]byte(nil), b...)})
+		}
+	}
+	a.pc += len(b)
+	return nil
+}
+
+//stripComment removes a trailing ; comment, ignoring any within quotes
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ';':
+			return s[:i]
+		}
+	}
+	return s
+}
+
+//splitWord splits s into its first word and the trimmed remainder
+func splitWord(s string) (string, string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+//splitOperands splits s on commas which are not quoted or parenthesised
+func splitOperands(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var ops []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			ops = append(ops, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(ops, strings.TrimSpace(s[start:]))
+}
+
+//unquote returns the contents of a quoted string, a doubled
+//quote within the string stands for a single quote character
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return "", false
+	}
+	q := string(s[0])
+	body := s[1 : len(s)-1]
+	if strings.Contains(strings.ReplaceAll(body, q+q, ""), q) {
+		return "", false
+	}
+	return strings.ReplaceAll(body, q+q, q), true
+}
@@ -0,0 +1,118 @@
+package as51
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//TestRoundTrip decodes every opcode, formats it with the disassembler
+//and checks the assembler reproduces the original bytes
+func TestRoundTrip(t *testing.T) {
+	const org = 0x4000
+	for i := 0; i < 256; i++ {
+		code := []byte{uint8(i), uint8(i + 0x31), uint8(i * 7)}
+		in, err := mu51.Decode(org, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Op == mu51.ERR {
+			continue
+		}
+		text := dis51.Format(in, nil)
+		p, err := AssembleString(fmt.Sprintf("ORG %04Xh\n%s\n", org, text))
+		if err != nil {
+			t.Errorf("0x%02X %q: %s", i, text, err)
+			continue
+		}
+		got := p.Image(0)[org:]
+		if !bytes.Equal(got, in.Bytes) {
+			t.Errorf("0x%02X %q assembled to % X, expected % X", i, text, got, in.Bytes)
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	src := `
+count	EQU	30h		; scratch counter
+flag	BIT	20h.1
+	ORG	0
+reset:	LJMP	main
+	ORG	0Bh
+	RETI
+main:	MOV	count,#LOW(table)
+	MOV	DPTR,#table
+	SETB	flag
+.loop:	DJNZ	count,.loop
+	CLR	ACC.7
+	JNB	TI,$
+	SJMP	main
+table:	DB	"Hi",0,'!',-1
+	DW	main,1234h
+	DS	2
+tail:	CALL	main
+	END
+	NOP
+`
+	p, err := AssembleString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		0x02, 0x00, 0x0C, //0000 LJMP main
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		0x32,             //000B RETI
+		0x75, 0x30, 0x1E, //000C MOV 30h,#1Eh
+		0x90, 0x00, 0x1E, //000F MOV DPTR,#001Eh
+		0xD2, 0x01, //0012 SETB 20h.1
+		0xD5, 0x30, 0xFD, //0014 DJNZ 30h,0014h
+		0xC2, 0xE7, //0017 CLR ACC.7
+		0x30, 0x99, 0xFD, //0019 JNB TI,0019h
+		0x80, 0xEE, //001C SJMP 000Ch
+		'H', 'i', 0x00, '!', 0xFF, //001E table
+		0x00, 0x0C, 0x12, 0x34, //0023 DW
+		0xFF, 0xFF, //0027 DS 2
+		0x12, 0x00, 0x0C, //0029 LCALL main
+	}
+	if img := p.Image(0xFF); !bytes.Equal(img, expected) {
+		t.Errorf("assembled\n% X\nexpected\n% X", img, expected)
+	}
+	if len(p.Memory) != 3 {
+		t.Errorf("expected 3 records, got %d", len(p.Memory))
+	}
+	for name, v := range map[string]uint16{"COUNT": 0x30, "MAIN": 0x0C, "MAIN.LOOP": 0x14, "TAIL": 0x29} {
+		if p.Symbols[name] != v {
+			t.Errorf("symbol %s = 0x%04X, expected 0x%04X", name, p.Symbols[name], v)
+		}
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	cases := []struct {
+		src  string
+		line int
+	}{
+		{"NOP\nLJMP nowhere\n", 2},
+		{"here: SJMP here+200\n", 1},
+		{"ORG 0\nAJMP 0800h\n", 2},
+		{"MOV A,@R2\n", 1},
+		{"FOO A\n", 1},
+		{"x: NOP\nx: NOP\n", 2},
+		{"NOP\nORG 0\nNOP\n", 3},
+		{"SETB 31h.0\n", 1},
+	}
+	for _, v := range cases {
+		_, err := AssembleString(v.src)
+		e, ok := err.(Error)
+		if !ok {
+			t.Errorf("%q: expected an Error, got %v", v.src, err)
+			continue
+		}
+		if e.Line != v.line {
+			t.Errorf("%q: error %q reported on line %d, expected %d", v.src, e, e.Line, v.line)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package as51
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//syntax is the addressing mode of an operand as written in the source,
+//value operands match any of the address kinds of the descriptor tables
+type syntax uint8
+
+const (
+	synA syntax = iota
+	synAB
+	synC
+	synDPTR
+	synReg
+	synInd
+	synImm
+	synNotBit
+	synValue
+	synAtDPTR
+	synAtADPTR
+	synAtAPC
+)
+
+//keywords are the operands written as reserved words
+var keywords = map[string]syntax{
+	"A": synA, "AB": synAB, "C": synC, "DPTR": synDPTR,
+	"@DPTR": synAtDPTR, "@A+DPTR": synAtADPTR, "@A+PC": synAtAPC,
+}
+
+//operand is a single parsed source operand
+type operand struct {
+	syn syntax
+	val int //register number or expression value
+}
+
+//parseOperand classifies and evaluates a single source operand
+func (a *assembler) parseOperand(s string) (operand, error) {
+	u := strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	if syn, ok := keywords[u]; ok {
+		return operand{syn: syn}, nil
+	}
+	if len(u) == 2 && u[0] == 'R' && u[1] >= '0' && u[1] <= '7' {
+		return operand{syn: synReg, val: int(u[1] - '0')}, nil
+	}
+	if len(u) == 3 && u[:2] == "@R" && (u[2] == '0' || u[2] == '1') {
+		return operand{syn: synInd, val: int(u[2] - '0')}, nil
+	}
+	syn := synValue
+	switch s[0] {
+	case '#':
+		syn, s = synImm, s[1:]
+	case '/':
+		syn, s = synNotBit, s[1:]
+	}
+	v, err := a.eval(s)
+	return operand{syn: syn, val: v}, err
+}
+
+//matches reports whether a source operand can be encoded as kind
+//within the given opcode
+func (o operand) matches(k mu51.OperandKind, opcode uint8) bool {
+	switch k {
+	case mu51.OperandA:
+		return o.syn == synA
+	case mu51.OperandAB:
+		return o.syn == synAB
+	case mu51.OperandC:
+		return o.syn == synC
+	case mu51.OperandDPTR:
+		return o.syn == synDPTR
+	case mu51.OperandReg:
+		return o.syn == synReg && int(opcode&0x07) == o.val
+	case mu51.OperandInd:
+		return o.syn == synInd && int(opcode&0x01) == o.val
+	case mu51.OperandImm, mu51.OperandImm16:
+		return o.syn == synImm
+	case mu51.OperandNotBit:
+		return o.syn == synNotBit
+	case mu51.OperandAddr11:
+		return o.syn == synValue && int(opcode&0xE0) == o.val>>3&0xE0
+	case mu51.OperandDirect, mu51.OperandBit, mu51.OperandRel, mu51.OperandAddr16:
+		return o.syn == synValue
+	case mu51.OperandAtDPTR:
+		return o.syn == synAtDPTR
+	case mu51.OperandAtADPTR:
+		return o.syn == synAtADPTR
+	case mu51.OperandAtAPC:
+		return o.syn == synAtAPC
+	}
+	return false
+}
+
+//instruction assembles a single machine instruction
+func (a *assembler) instruction(mnemonic, arg string) error {
+	var ops []operand
+	for _, s := range splitOperands(arg) {
+		if s == "" {
+			return fmt.Errorf("empty operand")
+		}
+		o, err := a.parseOperand(s)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, o)
+	}
+
+	//the generic jumps assemble to their long forms unless indexed
+	switch {
+	case mnemonic == "JMP" && len(ops) == 1 && ops[0].syn == synValue:
+		mnemonic = "LJMP"
+	case mnemonic == "CALL":
+		mnemonic = "LCALL"
+	}
+	op, ok := mu51.ParseOpCode(mnemonic)
+	if !ok {
+		return fmt.Errorf("unknown instruction %s", mnemonic)
+	}
+
+	for i := 0; i < 256; i++ {
+		opcode := uint8(i)
+		d := mu51.Lookup(opcode)
+		if d.Op != op || len(d.Kinds) != len(ops) {
+			continue
+		}
+		match := true
+		for j, k := range d.Kinds {
+			if !ops[j].matches(k, opcode) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return a.encode(opcode, d, ops)
+		}
+	}
+	return fmt.Errorf("invalid operands for %s", mnemonic)
+}
+
+//encode emits an instruction, range checking its operands during pass 2
+func (a *assembler) encode(opcode uint8, d mu51.Descriptor, ops []operand) error {
+	next := a.pc + int(d.Len)
+	b := []byte{opcode}
+	order := []int{0, 1, 2}
+	if opcode == 0x85 {
+		order = []int{1, 0} //MOV direct,direct encodes its source first
+	}
+	check := a.pass == 2
+	for _, j := range order[:len(ops)] {
+		v := ops[j].val
+		switch d.Kinds[j] {
+		case mu51.OperandImm:
+			if check && (v < -0x80 || v > 0xFF) {
+				return fmt.Errorf("immediate %d does not fit in a byte", v)
+			}
+			b = append(b, byte(v))
+		case mu51.OperandImm16:
+			if check && (v < -0x8000 || v > 0xFFFF) {
+				return fmt.Errorf("immediate %d does not fit in a word", v)
+			}
+			b = append(b, byte(v>>8), byte(v))
+		case mu51.OperandDirect:
+			if check && (v < 0 || v > 0xFF) {
+				return fmt.Errorf("direct address %Xh out of range", v)
+			}
+			b = append(b, byte(v))
+		case mu51.OperandBit, mu51.OperandNotBit:
+			if check && (v < 0 || v > 0xFF) {
+				return fmt.Errorf("bit address %Xh out of range", v)
+			}
+			b = append(b, byte(v))
+		case mu51.OperandRel:
+			off := v - next
+			if check && (off < -0x80 || off > 0x7F) {
+				return fmt.Errorf("relative target %04Xh out of range", v)
+			}
+			b = append(b, byte(off))
+		case mu51.OperandAddr11:
+			if check && (v < 0 || v>>11 != next>>11) {
+				return fmt.Errorf("target %04Xh is outside the current 2KiB page", v)
+			}
+			b = append(b, byte(v))
+		case mu51.OperandAddr16:
+			if check && (v < 0 || v > 0xFFFF) {
+				return fmt.Errorf("target %Xh out of range", v)
+			}
+			b = append(b, byte(v>>8), byte(v))
+		}
+	}
+	return a.emit(b...)
+}
@@ -0,0 +1,298 @@
+package as51
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//eval evaluates an expression. During pass 1 undefined symbols
+//evaluate to 0 and set a.undef, during pass 2 they are an error
+func (a *assembler) eval(s string) (int, error) {
+	a.undef = false
+	p := &parser{a: a, s: s}
+	v := p.or()
+	p.skipSpace()
+	if p.err == nil && p.pos < len(p.s) {
+		p.fail("unexpected %q in expression", p.s[p.pos:])
+	}
+	return v, p.err
+}
+
+//lookup returns the value of a symbol, user symbols take
+//precedence over the standard SFR and bit names
+func (a *assembler) lookup(name string) (int, error) {
+	name, err := a.qualify(name)
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := a.symbols[name]; ok {
+		return v, nil
+	}
+	if v, ok := mu51.SFRAddress(name); ok {
+		return int(v), nil
+	}
+	if v, ok := mu51.BitAddress(name); ok {
+		return int(v), nil
+	}
+	if a.pass == 1 {
+		a.undef = true
+		return 0, nil
+	}
+	return 0, fmt.Errorf("undefined symbol %s", name)
+}
+
+//parser is a recursive descent expression parser, the first
+//error encountered is kept and parsing continues returning 0
+type parser struct {
+	a   *assembler
+	s   string
+	pos int
+	err error
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+//accept consumes op if it is next in the input
+func (p *parser) accept(op string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], op) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() int {
+	v := p.xor()
+	for p.accept("|") {
+		v |= p.xor()
+	}
+	return v
+}
+
+func (p *parser) xor() int {
+	v := p.and()
+	for p.accept("^") {
+		v ^= p.and()
+	}
+	return v
+}
+
+func (p *parser) and() int {
+	v := p.shift()
+	for p.accept("&") {
+		v &= p.shift()
+	}
+	return v
+}
+
+func (p *parser) shift() int {
+	v := p.sum()
+	for {
+		switch {
+		case p.accept("<<"):
+			v <<= uint(p.sum() & 31)
+		case p.accept(">>"):
+			v >>= uint(p.sum() & 31)
+		default:
+			return v
+		}
+	}
+}
+
+func (p *parser) sum() int {
+	v := p.term()
+	for {
+		switch {
+		case p.accept("+"):
+			v += p.term()
+		case p.accept("-"):
+			v -= p.term()
+		default:
+			return v
+		}
+	}
+}
+
+func (p *parser) term() int {
+	v := p.unary()
+	for {
+		switch {
+		case p.accept("*"):
+			v *= p.unary()
+		case p.accept("/"), p.accept("%"):
+			op := p.s[p.pos-1]
+			d := p.unary()
+			if d == 0 {
+				if !p.a.undef {
+					p.fail("division by zero")
+				}
+				continue
+			}
+			if op == '/' {
+				v /= d
+			} else {
+				v %= d
+			}
+		default:
+			return v
+		}
+	}
+}
+
+func (p *parser) unary() int {
+	switch {
+	case p.accept("-"):
+		return -p.unary()
+	case p.accept("+"):
+		return p.unary()
+	case p.accept("~"):
+		return ^p.unary()
+	}
+	p.skipSpace()
+	if n := identLen(p.s[p.pos:]); n > 0 {
+		switch strings.ToUpper(p.s[p.pos : p.pos+n]) {
+		case "HIGH":
+			p.pos += n
+			return p.unary() >> 8 & 0xFF
+		case "LOW":
+			p.pos += n
+			return p.unary() & 0xFF
+		}
+	}
+	return p.bit()
+}
+
+//bit parses a primary followed by an optional .n bit selector
+func (p *parser) bit() int {
+	v := p.primary()
+	if p.pos >= len(p.s) || p.s[p.pos] != '.' {
+		return v
+	}
+	p.pos++
+	n := p.primary()
+	if n < 0 || n > 7 {
+		p.fail("bit number %d out of range", n)
+		return 0
+	}
+	switch {
+	case v >= 0x20 && v < 0x30:
+		return (v-0x20)*8 + n
+	case v >= 0x80 && v <= 0xFF && v&0x07 == 0:
+		return v + n
+	case p.a.undef:
+		return 0
+	}
+	p.fail("address %Xh is not bit addressable", v)
+	return 0
+}
+
+func (p *parser) primary() int {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		p.fail("missing operand")
+		return 0
+	}
+	rest := p.s[p.pos:]
+	switch c := rest[0]; {
+	case c == '(':
+		p.pos++
+		v := p.or()
+		if !p.accept(")") {
+			p.fail("missing )")
+		}
+		return v
+	case c == '$':
+		p.pos++
+		return p.a.start
+	case c == '\'' || c == '"':
+		if len(rest) < 3 || rest[2] != c {
+			p.fail("bad character constant")
+			return 0
+		}
+		p.pos += 3
+		return int(rest[1])
+	case c >= '0' && c <= '9':
+		n := 1
+		for n < len(rest) && isIdentChar(rest[n]) {
+			n++
+		}
+		p.pos += n
+		v, err := parseNumber(rest[:n])
+		if err != nil {
+			p.fail("%s", err)
+		}
+		return v
+	}
+	n := identLen(rest)
+	if n == 0 {
+		p.fail("unexpected %q in expression", rest)
+		return 0
+	}
+	p.pos += n
+	v, err := p.a.lookup(rest[:n])
+	if err != nil {
+		p.fail("%s", err)
+	}
+	return v
+}
+
+//parseNumber parses a numeric literal in any of the supported radixes
+func parseNumber(s string) (int, error) {
+	base := 10
+	u := strings.ToUpper(s)
+	switch {
+	case strings.HasPrefix(u, "0X"):
+		base, u = 16, u[2:]
+	case strings.HasSuffix(u, "H"):
+		base, u = 16, u[:len(u)-1]
+	case strings.HasSuffix(u, "B"):
+		base, u = 2, u[:len(u)-1]
+	case strings.HasSuffix(u, "O"), strings.HasSuffix(u, "Q"):
+		base, u = 8, u[:len(u)-1]
+	case strings.HasSuffix(u, "D"):
+		u = u[:len(u)-1]
+	}
+	v, err := strconv.ParseUint(u, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad number %s", s)
+	}
+	return int(v), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' || c == '?'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
+
+//identLen returns the length of the identifier at the start of s,
+//identifiers may begin with a dot to name a local label
+func identLen(s string) int {
+	n := 0
+	if n < len(s) && s[0] == '.' {
+		n++
+	}
+	if n >= len(s) || !isIdentStart(s[n]) {
+		return 0
+	}
+	for n < len(s) && isIdentChar(s[n]) {
+		n++
+	}
+	return n
+}
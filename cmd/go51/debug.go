@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/JonathanFraser/go51/dbg51"
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//debugHelp lists the debugger commands
+const debugHelp = `commands:
+  s, step [n]            step into n instructions
+  n, next                step over calls
+  finish                 run until the current function returns
+  ret                    run until the current function is about to return
+  c, continue            run until a breakpoint, watchpoint or ctrl-c
+  b, break ADDR [N]      break at ADDR, ignoring the first N hits
+  w, watch SPACE ADDR [r|w|rw|c]
+                         watch a location for reads, writes or changes
+  d, delete ID           remove a breakpoint or watchpoint
+  i, info                list breakpoints and watchpoints
+  x SPACE ADDR           show SPACE (code iram sfr xdata) from ADDR
+  set SPACE ADDR VAL...  write memory, set pc ADDR moves the PC
+  reset                  warm reset the cpu
+  h, help                show this help
+  q, quit                leave the debugger
+addresses are hex, an SFR name or a code symbol`
+
+//debugger is the state of an interactive session
+type debugger struct {
+	d    *dbg51.Debugger
+	view view
+}
+
+//debug implements "go51 debug [flags] firmware.hex"
+func debug(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ExitOnError)
+	profile := fs.String("profile", "8052", "derivative to emulate")
+	symPath := fs.String("sym", "", "symbol file to substitute names from")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: go51 debug [flags] firmware.hex")
+	}
+	cpu, err := newCPU(*profile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if cpu.ExtRAM == nil {
+		cpu.ExtRAM = make(mu51.Memory, 0x10000)
+	}
+	s := &debugger{d: dbg51.New(cpu)}
+	s.view = view{name: fs.Arg(0), space: mu51.SpaceIRAM}
+	s.view.trace(cpu.ProgMem)
+	if *symPath != "" {
+		sf, err := os.Open(*symPath)
+		if err != nil {
+			return err
+		}
+		sym, err := dis51.ParseSymbols(sf)
+		sf.Close()
+		if err != nil {
+			return err
+		}
+		s.view.sym = &sym
+	}
+
+	//ctrl-c stops a running program rather than the debugger
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		for range sig {
+			s.d.Interrupt()
+		}
+	}()
+	return s.loop(os.Stdin, os.Stdout)
+}
+
+//loop reads and executes commands until quit or end of input
+func (s *debugger) loop(r io.Reader, w io.Writer) error {
+	in := bufio.NewScanner(r)
+	last := ""
+	for {
+		s.view.draw(w, s.d)
+		if !in.Scan() {
+			fmt.Fprintln(w)
+			return in.Err()
+		}
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			line = last //repeat the previous command, as gdb does
+		}
+		last = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		msg, err := s.exec(fields[0], fields[1:])
+		if err != nil {
+			msg = "error: " + err.Error()
+		}
+		s.view.message = msg
+	}
+}
+
+//exec runs a single command, returning a message for the screen
+func (s *debugger) exec(cmd string, args []string) (string, error) {
+	d := s.d
+	switch cmd {
+	case "s", "step":
+		n := 1
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil {
+				return "", err
+			}
+			n = v
+		}
+		var ev dbg51.Event
+		for i := 0; i < n; i++ {
+			if ev = d.Step(); ev.Reason != dbg51.StopStep {
+				break
+			}
+		}
+		return ev.String(), nil
+	case "n", "next":
+		return d.StepOver().String(), nil
+	case "finish":
+		return d.StepOut().String(), nil
+	case "ret":
+		return d.RunUntilReturn().String(), nil
+	case "c", "continue":
+		return d.Continue().String(), nil
+	case "b", "break":
+		if len(args) == 0 {
+			return "", errors.New("break needs an address")
+		}
+		addr, err := s.parseAddr(mu51.SpaceCode, args[0])
+		if err != nil {
+			return "", err
+		}
+		b := d.AddBreakpoint(addr)
+		if len(args) > 1 {
+			if b.Ignore, err = strconv.Atoi(args[1]); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("breakpoint %d at %s", b.ID, dis51.Hex(addr, 4)), nil
+	case "w", "watch":
+		return s.watch(args)
+	case "d", "delete":
+		if len(args) == 0 {
+			return "", errors.New("delete needs an id")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", err
+		}
+		if !d.Remove(id) {
+			return "", fmt.Errorf("no breakpoint or watchpoint %d", id)
+		}
+		return fmt.Sprintf("deleted %d", id), nil
+	case "i", "info":
+		return s.info(), nil
+	case "x":
+		if len(args) < 2 {
+			return "", errors.New("x needs a space and address")
+		}
+		space, err := parseSpace(args[0])
+		if err != nil {
+			return "", err
+		}
+		addr, err := s.parseAddr(space, args[1])
+		if err != nil {
+			return "", err
+		}
+		s.view.space, s.view.addr = space, addr
+		return "", nil
+	case "set":
+		return s.set(args)
+	case "reset":
+		d.CPU.Reset()
+		return "reset", nil
+	case "h", "help":
+		return debugHelp, nil
+	}
+	return "", fmt.Errorf("unknown command %q, try help", cmd)
+}
+
+//spaceNames maps the names accepted for each address space
+var spaceNames = map[string]mu51.Space{
+	"code": mu51.SpaceCode, "iram": mu51.SpaceIRAM, "idata": mu51.SpaceIRAM,
+	"sfr": mu51.SpaceSFR, "xdata": mu51.SpaceXDATA, "bit": mu51.SpaceBit,
+}
+
+//parseSpace parses the name of an address space
+func parseSpace(name string) (mu51.Space, error) {
+	space, ok := spaceNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown space %q", name)
+	}
+	return space, nil
+}
+
+//parseAddr parses an address. A number with a 0x prefix, or starting
+//with a digit and an h suffix, is always taken as a number. Otherwise
+//a register name in the sfr space, a bit name in the bit space or a
+//code symbol in the code space is looked up before falling back to a
+//bare hex number, so in the sfr space B is the B register and 0Bh the
+//address 0Bh
+func (s *debugger) parseAddr(space mu51.Space, text string) (uint16, error) {
+	if explicitHex(text) {
+		return parseHex(text)
+	}
+	switch space {
+	case mu51.SpaceSFR:
+		if addr, ok := mu51.SFRAddress(strings.ToUpper(text)); ok {
+			return uint16(addr), nil
+		}
+	case mu51.SpaceBit:
+		if bit, ok := mu51.BitAddress(strings.ToUpper(text)); ok {
+			return uint16(bit), nil
+		}
+	case mu51.SpaceCode:
+		if s.view.sym == nil {
+			break
+		}
+		//symbols are case sensitive, a name given to several
+		//addresses is ambiguous
+		var found []uint16
+		for addr, name := range s.view.sym.Code {
+			if name == text {
+				found = append(found, addr)
+			}
+		}
+		if len(found) > 1 {
+			return 0, fmt.Errorf("symbol %s names %d addresses", text, len(found))
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+	}
+	return parseHex(text)
+}
+
+//explicitHex reports whether text is marked as a number, by a 0x
+//prefix or in Intel style by a leading digit and an h suffix
+func explicitHex(text string) bool {
+	t := strings.ToLower(text)
+	if strings.HasPrefix(t, "0x") {
+		return true
+	}
+	return len(t) > 1 && t[0] >= '0' && t[0] <= '9' && strings.HasSuffix(t, "h")
+}
+
+//parseHex parses a hex number in C or Intel style, a 0x prefix or an
+//h suffix is optional
+func parseHex(text string) (uint16, error) {
+	t := strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(text), "0x"), "h")
+	v, err := strconv.ParseUint(t, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad address %q", text)
+	}
+	return uint16(v), nil
+}
+
+//watch implements the watch command
+func (s *debugger) watch(args []string) (string, error) {
+	if len(args) < 2 {
+		return "", errors.New("watch needs a space and address")
+	}
+	space, err := parseSpace(args[0])
+	if err != nil {
+		return "", err
+	}
+	addr, err := s.parseAddr(space, args[1])
+	if err != nil {
+		return "", err
+	}
+	kind := dbg51.WatchWrite
+	if len(args) > 2 {
+		switch args[2] {
+		case "r":
+			kind = dbg51.WatchRead
+		case "w":
+			kind = dbg51.WatchWrite
+		case "rw":
+			kind = dbg51.WatchRead | dbg51.WatchWrite
+		case "c":
+			kind = dbg51.WatchChange
+		default:
+			return "", fmt.Errorf("unknown watch kind %q", args[2])
+		}
+	}
+	w := s.d.AddWatchpoint(space, addr, kind)
+	return fmt.Sprintf("watchpoint %d on %s %s", w.ID, space, dis51.Hex(addr, 4)), nil
+}
+
+//info lists the breakpoints and watchpoints
+func (s *debugger) info() string {
+	var lines []string
+	for _, b := range s.d.Breakpoints() {
+		lines = append(lines, fmt.Sprintf("%3d break %s hits %d ignore %d",
+			b.ID, dis51.Hex(b.Addr, 4), b.Hits, b.Ignore))
+	}
+	for _, w := range s.d.Watchpoints() {
+		lines = append(lines, fmt.Sprintf("%3d watch %s %s hits %d",
+			w.ID, w.Space, dis51.Hex(w.Addr, 4), w.Hits))
+	}
+	if len(lines) == 0 {
+		return "no breakpoints or watchpoints"
+	}
+	return strings.Join(lines, "\n")
+}
+
+//set implements the set command, writing memory or the PC
+func (s *debugger) set(args []string) (string, error) {
+	c := s.d.CPU
+	if len(args) == 2 && strings.EqualFold(args[0], "pc") {
+		addr, err := s.parseAddr(mu51.SpaceCode, args[1])
+		if err != nil {
+			return "", err
+		}
+		c.ProgCount = addr
+		return "", nil
+	}
+	if len(args) < 3 {
+		return "", errors.New("set needs a space, address and values")
+	}
+	space, err := parseSpace(args[0])
+	if err != nil {
+		return "", err
+	}
+	addr, err := s.parseAddr(space, args[1])
+	if err != nil {
+		return "", err
+	}
+	for i, text := range args[2:] {
+		v, err := parseHex(text)
+		if err != nil || v > 0xFF {
+			return "", fmt.Errorf("bad value %q", text)
+		}
+		if err := dbg51.Poke(c, space, addr+uint16(i), uint8(v)); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
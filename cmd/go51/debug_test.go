@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+func TestParseAddr(t *testing.T) {
+	s := &debugger{}
+	s.view.sym = &dis51.Symbols{Code: map[uint16]string{0x0100: "B", 0x0200: "main", 0x0300: "main"}}
+	cases := []struct {
+		space mu51.Space
+		text  string
+		addr  uint16
+	}{
+		{mu51.SpaceCode, "B", 0x0100},
+		{mu51.SpaceCode, "b", 0x000B},
+		{mu51.SpaceCode, "0Bh", 0x000B},
+		{mu51.SpaceCode, "0x0B", 0x000B},
+		{mu51.SpaceIRAM, "B", 0x0B},
+		{mu51.SpaceIRAM, "ac", 0xAC},
+		{mu51.SpaceIRAM, "0Bh", 0x0B},
+		{mu51.SpaceIRAM, "0x0B", 0x0B},
+		{mu51.SpaceSFR, "B", 0xF0},
+		{mu51.SpaceSFR, "acc", 0xE0},
+		{mu51.SpaceSFR, "0Bh", 0x0B},
+		{mu51.SpaceSFR, "0x0B", 0x0B},
+		{mu51.SpaceXDATA, "B", 0x000B},
+		{mu51.SpaceXDATA, "0Bh", 0x000B},
+		{mu51.SpaceXDATA, "0x0B", 0x000B},
+		{mu51.SpaceBit, "B", 0x0B},
+		{mu51.SpaceBit, "TR0", 0x8C},
+		{mu51.SpaceBit, "0Bh", 0x0B},
+		{mu51.SpaceBit, "0x0B", 0x0B},
+	}
+	for _, v := range cases {
+		addr, err := s.parseAddr(v.space, v.text)
+		if err != nil || addr != v.addr {
+			t.Errorf("%s in %s parsed as 0x%04X, %v, expected 0x%04X", v.text, v.space, addr, err, v.addr)
+		}
+	}
+	if _, err := s.parseAddr(mu51.SpaceCode, "main"); err == nil {
+		t.Error("ambiguous symbol accepted")
+	}
+	if _, err := s.parseAddr(mu51.SpaceIRAM, "P0"); err == nil {
+		t.Error("register name accepted outside the sfr space")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//dis implements "go51 dis [flags] firmware.hex"
+func dis(args []string) error {
+	fs := flag.NewFlagSet("dis", flag.ExitOnError)
+	symPath := fs.String("sym", "", "symbol file to substitute names from")
+	entries := fs.String("entry", "", "comma separated hex entry points (default reset and interrupt vectors)")
+	linear := fs.Bool("linear", false, "disassemble linearly instead of tracing code from the entry points")
+	start := fs.Uint("start", 0, "first address of a linear disassembly")
+	count := fs.Int("count", 64, "number of instructions in a linear disassembly")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: go51 dis [flags] firmware.hex")
+	}
+
+	f, err := loadHex(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	//only the extent of the image is listed, not the whole 64KiB
+	size := 0x10000
+	if f.Size() < int64(size) {
+		size = int(f.Size())
+	}
+	code, err := mu51.HexImage(f, size, mu51.DefaultFill)
+	if err != nil {
+		return err
+	}
+
+	var opts dis51.Options
+	if *symPath != "" {
+		sf, err := os.Open(*symPath)
+		if err != nil {
+			return err
+		}
+		opts.Symbols, err = dis51.ParseSymbols(sf)
+		sf.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if *entries != "" {
+		for _, e := range strings.Split(*entries, ",") {
+			v, err := strconv.ParseUint(strings.TrimPrefix(e, "0x"), 16, 16)
+			if err != nil {
+				return err
+			}
+			opts.Entries = append(opts.Entries, uint16(v))
+		}
+	}
+
+	var lines []dis51.Line
+	if *linear {
+		lines, err = dis51.Linear(code, uint16(*start), *count, &opts.Symbols)
+	} else {
+		lines, err = dis51.Disassemble(code, opts)
+	}
+	if err != nil && len(lines) == 0 {
+		return err
+	}
+	return dis51.WriteListing(os.Stdout, lines)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/JonathanFraser/go51/gdb51"
+)
+
+//gdb implements "go51 gdb [flags] firmware.hex"
+func gdb(args []string) error {
+	fs := flag.NewFlagSet("gdb", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:2331", "tcp address to listen on")
+	profile := fs.String("profile", "8052", "derivative to emulate")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: go51 gdb [flags] firmware.hex")
+	}
+	cpu, err := newCPU(*profile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "go51: waiting for gdb on %s\n", *addr)
+	return gdb51.NewServer(cpu).ListenAndServe(*addr)
+}
@@ -0,0 +1,79 @@
+//Command go51 is a toolbox for working with 8051 firmware images
+//
+//Usage:
+//
+//	go51 <command> [arguments]
+//
+//The commands are:
+//
+//	debug  debug an intel hex firmware image interactively
+//	dis    disassemble an intel hex firmware image
+//	gdb    serve the gdb remote protocol for a firmware image
+//	trace  record an execution trace of a firmware image
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/JonathanFraser/go51/ihex"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//commands maps each sub command onto its implementation
+var commands = map[string]func(args []string) error{
+	"debug": debug,
+	"dis":   dis,
+	"gdb":   gdb,
+	"trace": trace,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go51 <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "\tdebug  debug an intel hex firmware image interactively")
+	fmt.Fprintln(os.Stderr, "\tdis    disassemble an intel hex firmware image")
+	fmt.Fprintln(os.Stderr, "\tgdb    serve the gdb remote protocol for a firmware image")
+	fmt.Fprintln(os.Stderr, "\ttrace  record an execution trace of a firmware image")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "go51:", err)
+		os.Exit(1)
+	}
+}
+
+//loadHex parses an intel hex file from disk
+func loadHex(path string) (ihex.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ihex.File{}, err
+	}
+	defer f.Close()
+	return ihex.Parse(f)
+}
+
+//newCPU builds a cpu emulating the named profile running the intel
+//hex file at path
+func newCPU(profile, path string) (*mu51.CPU, error) {
+	p, ok := mu51.LookupProfile(profile)
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q, expected one of %s", profile, strings.Join(mu51.ProfileNames(), ", "))
+	}
+	cpu := p.NewCPU(nil)
+	if err := cpu.LoadHexFile(path); err != nil {
+		return nil, err
+	}
+	return cpu, nil
+}
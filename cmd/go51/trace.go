@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/JonathanFraser/go51/trace51"
+)
+
+//trace implements "go51 trace [flags] firmware.hex"
+func trace(args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	profile := fs.String("profile", "8052", "derivative to emulate")
+	outPath := fs.String("o", "", "file to write the trace to (default stdout)")
+	bin := fs.Bool("binary", false, "write the compact binary form instead of text")
+	s51 := fs.Bool("s51", false, "write the s51 simulator's step output instead of text")
+	ranges := fs.String("range", "", "comma separated hex address ranges to trace, such as 0100-01ff")
+	steps := fs.Int("steps", 10000, "number of steps to run")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: go51 trace [flags] firmware.hex")
+	}
+	cpu, err := newCPU(*profile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	var w interface {
+		trace51.RecordWriter
+		Flush() error
+	}
+	switch {
+	case *bin:
+		w = trace51.NewBinaryWriter(out)
+	case *s51:
+		w = trace51.NewS51Writer(out, cpu)
+	default:
+		w = trace51.NewTextWriter(out)
+	}
+
+	t := trace51.Attach(cpu, w)
+	if *ranges != "" {
+		for _, r := range strings.Split(*ranges, ",") {
+			parts := strings.SplitN(r, "-", 2)
+			start, err := parseHex(parts[0])
+			if err != nil {
+				return err
+			}
+			end := start
+			if len(parts) == 2 {
+				if end, err = parseHex(parts[1]); err != nil {
+					return err
+				}
+			}
+			t.Ranges = append(t.Ranges, trace51.Range{Start: start, End: end})
+		}
+	}
+	for i := 0; i < *steps && t.Err() == nil; i++ {
+		if err := cpu.Step(); err != nil {
+			fmt.Fprintln(os.Stderr, "go51:", err)
+			break
+		}
+	}
+	if err := t.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JonathanFraser/go51/dbg51"
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//ansi control sequences used to draw the screen
+const (
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiReverse = "\x1b[7m"
+	ansiBold    = "\x1b[1m"
+	ansiReset   = "\x1b[0m"
+)
+
+//codeLines is the number of instructions shown around the PC
+const codeLines = 12
+
+//view is the state of the debugger screen
+type view struct {
+	name    string //firmware file
+	sym     *dis51.Symbols
+	space   mu51.Space //space and start of the hex view
+	addr    uint16
+	message string //result of the last command
+
+	//known holds the instruction addresses found by tracing the code
+	//from its vectors, used to line up the disassembly before the PC
+	known map[uint16]bool
+}
+
+//draw renders the whole screen to w
+func (v *view) draw(w io.Writer, d *dbg51.Debugger) {
+	c := d.CPU
+	profile := "8051"
+	if c.Profile != nil {
+		profile = c.Profile.Name
+	}
+	fmt.Fprint(w, ansiClear)
+	fmt.Fprintf(w, "%s go51 debug  %s  profile %s  cycle %d  time %v %s\n",
+		ansiReverse, v.name, profile, c.Cycles, c.Elapsed(), ansiReset)
+
+	code := v.code(d)
+	regs := v.registers(c)
+	for i := 0; i < codeLines || i < len(regs); i++ {
+		left, right := "", ""
+		if i < len(code) {
+			left = code[i]
+		}
+		if i < len(regs) {
+			right = regs[i]
+		}
+		fmt.Fprintf(w, "%s%s%s\n", left, strings.Repeat(" ", pad(left, 46)), right)
+	}
+
+	fmt.Fprintf(w, "%s stack %s\n", ansiBold, ansiReset)
+	fmt.Fprintln(w, v.stack(d))
+	fmt.Fprintf(w, "%s %s %s %s\n", ansiBold, v.space, dis51.Hex(v.addr, 4), ansiReset)
+	for row := 0; row < 8; row++ {
+		fmt.Fprintln(w, v.hexRow(c, v.addr+uint16(row*16)))
+	}
+	if v.message != "" {
+		fmt.Fprintln(w, v.message)
+	}
+	fmt.Fprint(w, "(go51) ")
+}
+
+//pad returns the spaces needed to fill a line with escape
+//sequences out to width visible characters
+func pad(s string, width int) int {
+	n := len(s)
+	for _, seq := range []string{ansiReverse, ansiBold, ansiReset} {
+		n -= strings.Count(s, seq) * len(seq)
+	}
+	if n >= width {
+		return 1
+	}
+	return width - n
+}
+
+//trace records the instruction addresses reachable from the vectors
+func (v *view) trace(code mu51.CodeMemory) {
+	v.known = make(map[uint16]bool)
+	lines, _ := dis51.Disassemble(code, dis51.Options{})
+	for _, l := range lines {
+		if l.Code {
+			v.known[l.Address] = true
+		}
+	}
+}
+
+//code returns the disassembly around the PC, starting a few
+//instructions back where a decoding which lands on the PC is found.
+//Traced instruction addresses are preferred as starting points
+func (v *view) code(d *dbg51.Debugger) []string {
+	c := d.CPU
+	pc := c.ProgCount
+	start := pc
+	for _, traced := range []bool{true, false} {
+		for back := uint16(8); back > 0 && start == pc; back-- {
+			if back > pc || (traced && !v.known[pc-back]) {
+				continue
+			}
+			lines, _ := dis51.Linear(c.ProgMem, pc-back, codeLines, v.sym)
+			if landsOn(lines, pc) {
+				start = pc - back
+			}
+		}
+	}
+	lines, _ := dis51.Linear(c.ProgMem, start, codeLines, v.sym)
+	bps := make(map[uint16]bool)
+	for _, b := range d.Breakpoints() {
+		bps[b.Addr] = b.Enabled
+	}
+	var out []string
+	for _, l := range lines {
+		mark := " "
+		if bps[l.Address] {
+			mark = "*"
+		}
+		text := fmt.Sprintf("%s %04X  %-28s", mark, l.Address, l.Text)
+		if l.Label != "" {
+			text = fmt.Sprintf("%s %04X  %-28s", mark, l.Address, l.Label+": "+l.Text)
+		}
+		if l.Address == pc {
+			text = ansiReverse + ">" + text[1:] + ansiReset
+		}
+		out = append(out, text)
+	}
+	return out
+}
+
+//landsOn reports whether a run of lines decodes an instruction at pc
+//with at least two instructions before it
+func landsOn(lines []dis51.Line, pc uint16) bool {
+	for i, l := range lines {
+		if l.Address == pc {
+			return i >= 2
+		}
+		if l.Address > pc {
+			return false
+		}
+	}
+	return false
+}
+
+//psw flags from bit 7 down to bit 0
+var pswFlags = []string{"CY", "AC", "F0", "RS1", "RS0", "OV", "UD", "P"}
+
+//registers returns the register pane
+func (v *view) registers(c *mu51.CPU) []string {
+	psw := c.ProgStatus()
+	var flags []string
+	for i, name := range pswFlags {
+		if psw&(0x80>>uint(i)) != 0 {
+			flags = append(flags, name)
+		} else {
+			flags = append(flags, strings.Repeat("-", len(name)))
+		}
+	}
+	bank := int(psw >> 3 & 0x03)
+	regs := make([]string, 8)
+	for i := range regs {
+		regs[i] = fmt.Sprintf("R%d %02X", i, c.InternalRAM[bank*8+i])
+	}
+	dptr := fmt.Sprintf("DPTR %04X", c.DataPtr())
+	if n := c.ActiveDataPtr(); n != 0 {
+		dptr = fmt.Sprintf("DPTR%d %04X", n, c.DataPtr())
+	}
+	return []string{
+		ansiBold + "registers" + ansiReset,
+		fmt.Sprintf("PC %04X  SP %02X", c.ProgCount, c.StackPtr()),
+		fmt.Sprintf("A  %02X    B  %02X", c.Accum(), c.BReg()),
+		dptr,
+		fmt.Sprintf("PSW %02X %s", psw, strings.Join(flags, " ")),
+		fmt.Sprintf("bank %d", bank),
+		strings.Join(regs[:4], "  "),
+		strings.Join(regs[4:], "  "),
+		fmt.Sprintf("IE %02X  IP %02X  TCON %02X", c.SFR(mu51.IE), c.SFR(mu51.IP), c.SFR(mu51.TCON)),
+		fmt.Sprintf("P0 %02X  P1 %02X  P2 %02X  P3 %02X", c.SFR(mu51.P0), c.SFR(mu51.P1), c.SFR(mu51.P2), c.SFR(mu51.P3)),
+	}
+}
+
+//stack returns the stack contents above the reset stack pointer,
+//most recent first, with the call stack below
+func (v *view) stack(d *dbg51.Debugger) string {
+	c := d.CPU
+	sp := int(c.StackPtr())
+	var vals []string
+	for a := sp; a > 7 && sp-a < 16; a-- {
+		vals = append(vals, fmt.Sprintf("%02X", c.InternalRAM[a]))
+	}
+	line := fmt.Sprintf("  %02X: %s", sp, strings.Join(vals, " "))
+	var calls []string
+	for _, f := range d.CallStack() {
+		name := dis51.Hex(f.Target, 4)
+		if v.sym != nil && v.sym.Code[f.Target] != "" {
+			name = v.sym.Code[f.Target]
+		}
+		if f.Interrupt {
+			name += "(int)"
+		}
+		calls = append(calls, name)
+	}
+	if len(calls) > 0 {
+		line += "\n  calls: " + strings.Join(calls, " > ")
+	}
+	return line
+}
+
+//hexRow returns one row of the hex view
+func (v *view) hexRow(c *mu51.CPU, addr uint16) string {
+	var hexes []string
+	ascii := make([]byte, 16)
+	for i := 0; i < 16; i++ {
+		b := dbg51.Peek(c, v.space, addr+uint16(i))
+		hexes = append(hexes, fmt.Sprintf("%02X", b))
+		ascii[i] = '.'
+		if b >= 0x20 && b < 0x7F {
+			ascii[i] = b
+		}
+	}
+	return fmt.Sprintf("  %04X  %s  %s", addr, strings.Join(hexes, " "), ascii)
+}
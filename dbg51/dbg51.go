@@ -0,0 +1,334 @@
+//Package dbg51 is a debugger for firmware running on the mu51 emulator.
+//It adds conditional breakpoints, data watchpoints, call stack tracking
+//and source level stepping over CPU.Step, reporting every stop as an Event
+package dbg51
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//StopReason is the reason execution stopped
+type StopReason int
+
+const (
+	StopStep       StopReason = iota //a step completed
+	StopBreakpoint                   //a breakpoint was reached
+	StopWatchpoint                   //a watched location was accessed
+	StopReturn                       //the function being stepped out of returned
+	StopInterrupt                    //Interrupt was called
+	StopError                        //the CPU returned an error, such as a fault
+)
+
+//stopNames are the names of each StopReason
+var stopNames = []string{"step", "breakpoint", "watchpoint", "return", "interrupt", "error"}
+
+func (r StopReason) String() string {
+	if r < 0 || int(r) >= len(stopNames) {
+		return fmt.Sprintf("stop %d", int(r))
+	}
+	return stopNames[r]
+}
+
+//Event describes why and where execution stopped
+type Event struct {
+	Reason StopReason
+	PC     uint16 //program counter after stopping
+	Cycle  uint64
+
+	Breakpoint *Breakpoint //set for StopBreakpoint
+	Watchpoint *Watchpoint //set for StopWatchpoint
+	Access     mu51.Access //the triggering access, for read and write watches
+	Old, New   uint8       //the value before and after, for change watches
+	Err        error       //set for StopError
+}
+
+func (e Event) String() string {
+	switch e.Reason {
+	case StopBreakpoint:
+		return fmt.Sprintf("breakpoint %d at 0x%04X", e.Breakpoint.ID, e.PC)
+	case StopWatchpoint:
+		w := e.Watchpoint
+		if e.Old != e.New {
+			return fmt.Sprintf("watchpoint %d %s 0x%04X changed 0x%02X -> 0x%02X at 0x%04X",
+				w.ID, w.Space, w.Addr, e.Old, e.New, e.PC)
+		}
+		op := "read"
+		if e.Access.Write {
+			op = "write"
+		}
+		return fmt.Sprintf("watchpoint %d %s %s 0x%04X = 0x%02X at 0x%04X",
+			w.ID, op, w.Space, w.Addr, e.Access.Value, e.PC)
+	case StopError:
+		return fmt.Sprintf("stopped at 0x%04X: %v", e.PC, e.Err)
+	}
+	return fmt.Sprintf("%s at 0x%04X", e.Reason, e.PC)
+}
+
+//Frame is an active call or interrupt on the call stack
+type Frame struct {
+	Call      uint16 //address of the call, or the interrupted instruction
+	Target    uint16 //address called or interrupt vector
+	Return    uint16 //address returned to
+	SP        uint8  //stack pointer once the return address was pushed
+	Interrupt bool
+}
+
+//Debugger controls a CPU. Execution methods such as Continue must be
+//called from a single goroutine, only Interrupt may be called from others
+type Debugger struct {
+	CPU *mu51.CPU
+
+	breakpoints []*Breakpoint
+	watchpoints []*Watchpoint
+	nextID      int
+	frames      []Frame
+
+	prevAccess func(mu51.Access) //access hook installed before ours
+	watchHit   *Event            //the first watchpoint hit this step
+	interrupt  int32
+}
+
+//New returns a debugger for c, it installs an access hook on the CPU
+//which calls any hook already installed
+func New(c *mu51.CPU) *Debugger {
+	d := &Debugger{CPU: c, prevAccess: c.OnAccess}
+	c.OnAccess = d.onAccess
+	return d
+}
+
+//AddBreakpoint adds an enabled breakpoint at addr, its condition
+//and ignore count may be set on the returned breakpoint
+func (d *Debugger) AddBreakpoint(addr uint16) *Breakpoint {
+	d.nextID++
+	b := &Breakpoint{ID: d.nextID, Addr: addr, Enabled: true}
+	d.breakpoints = append(d.breakpoints, b)
+	return b
+}
+
+//AddWatchpoint adds an enabled watchpoint on a location
+func (d *Debugger) AddWatchpoint(space mu51.Space, addr uint16, kind WatchKind) *Watchpoint {
+	d.nextID++
+	w := &Watchpoint{ID: d.nextID, Space: space, Addr: addr, Kind: kind, Enabled: true}
+	w.last = Peek(d.CPU, space, addr)
+	d.watchpoints = append(d.watchpoints, w)
+	return w
+}
+
+//Remove deletes the breakpoint or watchpoint with the given id
+func (d *Debugger) Remove(id int) bool {
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	for i, w := range d.watchpoints {
+		if w.ID == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+//Breakpoints returns the breakpoints in the order they were added
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return append([]*Breakpoint(nil), d.breakpoints...)
+}
+
+//Watchpoints returns the watchpoints in the order they were added
+func (d *Debugger) Watchpoints() []*Watchpoint {
+	return append([]*Watchpoint(nil), d.watchpoints...)
+}
+
+//CallStack returns the active calls and interrupts, outermost first
+func (d *Debugger) CallStack() []Frame {
+	return append([]Frame(nil), d.frames...)
+}
+
+//Interrupt stops a running Continue or step at the next instruction,
+//or when nothing is running the next one to start. It is safe to call
+//from any goroutine
+func (d *Debugger) Interrupt() {
+	atomic.StoreInt32(&d.interrupt, 1)
+}
+
+//CancelInterrupt withdraws an Interrupt which has not yet stopped a
+//run, such as one which arrived just as the last run stopped
+func (d *Debugger) CancelInterrupt() {
+	atomic.StoreInt32(&d.interrupt, 0)
+}
+
+//onAccess checks every memory access against the watchpoints
+func (d *Debugger) onAccess(a mu51.Access) {
+	if d.prevAccess != nil {
+		d.prevAccess(a)
+	}
+	if d.watchHit != nil {
+		return
+	}
+	want := WatchRead
+	if a.Write {
+		want = WatchWrite
+	}
+	for _, w := range d.watchpoints {
+		if w.Enabled && w.Kind&want != 0 && w.matches(a) {
+			w.Hits++
+			d.watchHit = &Event{Reason: StopWatchpoint, Watchpoint: w, Access: a}
+			return
+		}
+	}
+}
+
+//checkChanges returns an event for the first changed value under a
+//change watchpoint, updating the values of all of them
+func (d *Debugger) checkChanges() *Event {
+	var ev *Event
+	for _, w := range d.watchpoints {
+		v := Peek(d.CPU, w.Space, w.Addr)
+		old := w.last
+		w.last = v
+		if ev == nil && w.Enabled && w.Kind&WatchChange != 0 && v != old {
+			w.Hits++
+			ev = &Event{Reason: StopWatchpoint, Watchpoint: w, Old: old, New: v}
+		}
+	}
+	return ev
+}
+
+//breakpointAt returns the breakpoint which stops execution at pc
+func (d *Debugger) breakpointAt(pc uint16) *Breakpoint {
+	for _, b := range d.breakpoints {
+		if b.Addr == pc && b.hit(d.CPU) {
+			return b
+		}
+	}
+	return nil
+}
+
+//event fills in the location of a stop
+func (d *Debugger) event(ev Event) Event {
+	ev.PC = d.CPU.ProgCount
+	ev.Cycle = d.CPU.Cycles
+	return ev
+}
+
+//step executes a single CPU step, tracking the call stack, and
+//returns an event if a watchpoint or error stopped it
+func (d *Debugger) step() *Event {
+	c := d.CPU
+	pc, sp := c.ProgCount, c.StackPtr()
+	in, ierr := mu51.ReadInstruction(c.ProgMem, int64(pc))
+
+	d.watchHit = nil
+	err := c.Step()
+	ev := d.watchHit
+	d.watchHit = nil
+	if change := d.checkChanges(); ev == nil {
+		ev = change
+	}
+
+	newSP := c.StackPtr()
+	switch {
+	case newSP == sp+2 && ierr == nil && (in.Op == mu51.ACALL || in.Op == mu51.LCALL) && d.returnAddr(newSP) == in.Next():
+		d.frames = append(d.frames, Frame{Call: pc, Target: c.ProgCount, Return: in.Next(), SP: newSP})
+	case newSP == sp+2 && d.returnAddr(newSP) == pc && c.ProgCount != pc:
+		d.frames = append(d.frames, Frame{Call: pc, Target: c.ProgCount, Return: pc, SP: newSP, Interrupt: true})
+	case ierr == nil && (in.Op == mu51.RET || in.Op == mu51.RETI):
+		for len(d.frames) > 0 && d.frames[len(d.frames)-1].SP > newSP {
+			d.frames = d.frames[:len(d.frames)-1]
+		}
+	}
+
+	if err != nil {
+		return &Event{Reason: StopError, Err: err}
+	}
+	return ev
+}
+
+//returnAddr reads the return address on top of the stack
+func (d *Debugger) returnAddr(sp uint8) uint16 {
+	ram := &d.CPU.InternalRAM
+	return uint16(ram[sp])<<8 | uint16(ram[sp-1])
+}
+
+//run steps until done reports true or a breakpoint, watchpoint, error
+//or interrupt intervenes. Breakpoints are not checked before the first
+//step so that execution can resume from one
+func (d *Debugger) run(done func() *Event) Event {
+	for first := true; ; first = false {
+		if atomic.SwapInt32(&d.interrupt, 0) != 0 {
+			return d.event(Event{Reason: StopInterrupt})
+		}
+		if !first {
+			if b := d.breakpointAt(d.CPU.ProgCount); b != nil {
+				return d.event(Event{Reason: StopBreakpoint, Breakpoint: b})
+			}
+		}
+		if ev := d.step(); ev != nil {
+			return d.event(*ev)
+		}
+		if ev := done(); ev != nil {
+			return d.event(*ev)
+		}
+	}
+}
+
+//Step executes a single instruction, stepping into calls
+func (d *Debugger) Step() Event {
+	return d.run(func() *Event {
+		return &Event{Reason: StopStep}
+	})
+}
+
+//StepOver executes a single instruction, running any call it makes to
+//completion
+func (d *Debugger) StepOver() Event {
+	depth := len(d.frames)
+	return d.run(func() *Event {
+		if len(d.frames) > depth {
+			return nil
+		}
+		return &Event{Reason: StopStep}
+	})
+}
+
+//StepOut runs until the current function or interrupt handler returns
+//to its caller. At the outermost level it runs like Continue
+func (d *Debugger) StepOut() Event {
+	depth := len(d.frames)
+	return d.run(func() *Event {
+		if len(d.frames) < depth {
+			return &Event{Reason: StopReturn}
+		}
+		return nil
+	})
+}
+
+//RunUntilReturn runs until the current function or interrupt handler is
+//about to execute the RET or RETI which returns from it, leaving the
+//return address on the stack to be inspected. At the outermost level
+//it runs like Continue
+func (d *Debugger) RunUntilReturn() Event {
+	depth := len(d.frames)
+	return d.run(func() *Event {
+		if len(d.frames) != depth || depth == 0 {
+			return nil
+		}
+		in, err := mu51.ReadInstruction(d.CPU.ProgMem, int64(d.CPU.ProgCount))
+		if err == nil && (in.Op == mu51.RET || in.Op == mu51.RETI) {
+			return &Event{Reason: StopReturn}
+		}
+		return nil
+	})
+}
+
+//Continue runs until a breakpoint, watchpoint, error or Interrupt
+func (d *Debugger) Continue() Event {
+	return d.run(func() *Event {
+		return nil
+	})
+}
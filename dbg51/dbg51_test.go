@@ -0,0 +1,194 @@
+package dbg51
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JonathanFraser/go51/as51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//testProgram calls a function which counts R7 into 30h, with a
+//timer 0 interrupt handler at its vector
+const testProgram = `
+	ORG 0
+	LJMP MAIN
+	ORG 0Bh
+	LJMP ISR
+	ORG 40h
+MAIN:	MOV SP,#50h
+	MOV R7,#3
+LOOP:	LCALL COUNT
+	DJNZ R7,LOOP
+	SJMP $
+COUNT:	INC 30h
+	SETB 00h
+	NOP
+	RET
+ISR:	MOV 31h,#1
+	RETI
+`
+
+func newTestDebugger(t *testing.T) (*Debugger, *as51.Program) {
+	p, err := as51.AssembleString(testProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := mu51.NewCPU(mu51.Memory(p.Image(0xFF)), nil)
+	return New(c), p
+}
+
+func TestBreakpoints(t *testing.T) {
+	d, p := newTestDebugger(t)
+	b := d.AddBreakpoint(p.Symbols["COUNT"])
+	b.Ignore = 1
+	ev := d.Continue()
+	if ev.Reason != StopBreakpoint || ev.Breakpoint != b || ev.PC != p.Symbols["COUNT"] {
+		t.Fatalf("stopped with %v", ev)
+	}
+	if b.Hits != 2 || d.CPU.InternalRAM[0x30] != 1 {
+		t.Errorf("ignore count not honoured, hits %d count %d", b.Hits, d.CPU.InternalRAM[0x30])
+	}
+
+	b.Cond = func(c *mu51.CPU) bool { return c.InternalRAM[0x30] == 5 }
+	d.AddBreakpoint(p.Symbols["LOOP"] + 5).Cond = func(c *mu51.CPU) bool { return c.Reg(7) == 0 }
+	ev = d.Continue()
+	if ev.Reason != StopBreakpoint || ev.Breakpoint.ID != 2 || d.CPU.InternalRAM[0x30] != 3 {
+		t.Errorf("conditional breakpoints stopped with %v", ev)
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	d, _ := newTestDebugger(t)
+	w := d.AddWatchpoint(mu51.SpaceIRAM, 0x30, WatchWrite)
+	ev := d.Continue()
+	if ev.Reason != StopWatchpoint || ev.Watchpoint != w || !ev.Access.Write || ev.Access.Value != 1 {
+		t.Fatalf("write watch stopped with %v", ev)
+	}
+	d.Remove(w.ID)
+
+	//SETB 00h is seen by a watch on the byte holding the bit
+	d.AddWatchpoint(mu51.SpaceIRAM, 0x20, WatchRead)
+	if ev := d.Continue(); ev.Reason != StopWatchpoint || ev.Access.Space != mu51.SpaceIRAM {
+		t.Fatalf("read watch stopped with %v", ev)
+	}
+	d.Remove(3)
+
+	//the accumulator is changed implicitly so only a change watch sees it
+	d.CPU.InternalRAM[0x30] = 0x10
+	d.AddWatchpoint(mu51.SpaceIRAM, 0x30, WatchChange)
+	ev = d.Continue()
+	if ev.Reason != StopWatchpoint || ev.Old != 0x10 || ev.New != 0x11 {
+		t.Errorf("change watch stopped with %v", ev)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	d, p := newTestDebugger(t)
+	for d.CPU.ProgCount != p.Symbols["LOOP"] {
+		d.Step()
+	}
+	ev := d.StepOver()
+	if ev.Reason != StopStep || ev.PC != p.Symbols["LOOP"]+3 || d.CPU.InternalRAM[0x30] != 1 {
+		t.Fatalf("step over stopped with %v", ev)
+	}
+
+	d.Step()
+	d.Step()
+	if d.CPU.ProgCount != p.Symbols["COUNT"] || len(d.CallStack()) != 1 {
+		t.Fatalf("step into reached 0x%04X depth %d", d.CPU.ProgCount, len(d.CallStack()))
+	}
+	if f := d.CallStack()[0]; f.Return != p.Symbols["LOOP"]+3 || f.Interrupt {
+		t.Errorf("frame %+v", f)
+	}
+
+	ev = d.RunUntilReturn()
+	if ev.Reason != StopReturn || ev.PC != p.Symbols["ISR"]-1 {
+		t.Errorf("run until return stopped with %v", ev)
+	}
+	ev = d.StepOut()
+	if ev.Reason != StopReturn || ev.PC != p.Symbols["LOOP"]+3 || len(d.CallStack()) != 0 {
+		t.Errorf("step out stopped with %v", ev)
+	}
+}
+
+func TestInterruptFrames(t *testing.T) {
+	d, p := newTestDebugger(t)
+	d.AddBreakpoint(p.Symbols["ISR"])
+	d.Step()
+	d.Step()
+	d.CPU.WriteDirect(mu51.IE, 0x82)
+	d.CPU.SetSFR(mu51.TCON, 0x20)
+	ev := d.Continue()
+	if ev.Reason != StopBreakpoint {
+		t.Fatalf("stopped with %v", ev)
+	}
+	stack := d.CallStack()
+	if len(stack) != 1 || !stack[0].Interrupt || stack[0].Target != 0x000B {
+		t.Fatalf("call stack %+v", stack)
+	}
+	ev = d.StepOut()
+	if ev.Reason != StopReturn || ev.PC != stack[0].Return || d.CPU.InternalRAM[0x31] != 1 {
+		t.Errorf("step out of handler stopped with %v", ev)
+	}
+}
+
+func TestErrorsAndInterrupt(t *testing.T) {
+	c := mu51.NewCPU(mu51.Memory{0xA5}, nil)
+	d := New(c)
+	ev := d.Continue()
+	if ev.Reason != StopError || !errors.Is(ev.Err, mu51.ErrUnknownOpCode) {
+		t.Errorf("illegal opcode stopped with %v", ev)
+	}
+
+	d, _ = newTestDebugger(t)
+	d.AddWatchpoint(mu51.SpaceIRAM, 0x7F, WatchWrite)
+	go d.Interrupt()
+	if ev := d.Continue(); ev.Reason != StopInterrupt {
+		t.Errorf("interrupted run stopped with %v", ev)
+	}
+}
+
+func TestPeekPoke(t *testing.T) {
+	c := mu51.NewCPU(mu51.Memory{0x00}, make(mu51.Memory, 0x100))
+	Poke(c, mu51.SpaceBit, 0x03, 1)
+	Poke(c, mu51.SpaceBit, 0xE7, 1)
+	Poke(c, mu51.SpaceXDATA, 0x10, 0x5A)
+	if c.InternalRAM[0x20] != 0x08 || c.Accum() != 0x80 || Peek(c, mu51.SpaceXDATA, 0x10) != 0x5A {
+		t.Error("poke did not write")
+	}
+	if Peek(c, mu51.SpaceBit, 0xE7) != 1 || Peek(c, mu51.SpaceSFR, uint16(mu51.PSW)) != 0x01 {
+		t.Error("peek did not read")
+	}
+	if err := Poke(c, mu51.SpaceCode, 0, 0); err != nil {
+		t.Errorf("poke of ram backed code gave %v", err)
+	}
+}
+
+func TestChangeWatchMMIO(t *testing.T) {
+	var reads int
+	status := uint8(0x80)
+	xdata := &mu51.Bus{}
+	xdata.MapIO(0xF000, 0x10, &mu51.MMIO{
+		Len: 0x10,
+		//reading the status register clears it
+		Read: func(off uint16) uint8 {
+			reads++
+			v := status
+			status = 0
+			return v
+		},
+		Peek: func(off uint16) uint8 { return status },
+	})
+	c := mu51.NewCPU(mu51.Memory{0x00, 0x00, 0x00, 0x00}, xdata)
+	d := New(c)
+	d.AddWatchpoint(mu51.SpaceXDATA, 0xF000, WatchChange)
+	for i := 0; i < 3; i++ {
+		if ev := d.Step(); ev.Reason == StopWatchpoint {
+			t.Errorf("unchanged register stopped with %v", ev)
+		}
+	}
+	if reads != 0 || status != 0x80 || Peek(c, mu51.SpaceXDATA, 0xF000) != 0x80 {
+		t.Errorf("watching the register read it %d times, status 0x%02X", reads, status)
+	}
+}
@@ -0,0 +1,159 @@
+package dbg51
+
+import (
+	"errors"
+
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//Breakpoint stops execution before the instruction at Addr runs
+type Breakpoint struct {
+	ID      int
+	Addr    uint16
+	Enabled bool
+
+	//Cond, when set, must return true for a hit to count
+	Cond func(c *mu51.CPU) bool
+
+	//Ignore is the number of hits passed over before stopping
+	Ignore int
+
+	//Hits counts the times the breakpoint was reached with Cond true
+	Hits int
+}
+
+//hit records a hit and reports whether execution should stop
+func (b *Breakpoint) hit(c *mu51.CPU) bool {
+	if !b.Enabled || (b.Cond != nil && !b.Cond(c)) {
+		return false
+	}
+	b.Hits++
+	return b.Hits > b.Ignore
+}
+
+//WatchKind selects the accesses which trigger a watchpoint, the
+//kinds may be combined
+type WatchKind int
+
+const (
+	WatchRead   WatchKind = 1 << iota //any read of the location
+	WatchWrite                        //any write, even of the same value
+	WatchChange                       //a change of value, however it came about
+)
+
+//Watchpoint stops execution after an instruction accesses a location.
+//Accesses through the bit space also trigger watchpoints on the byte
+//holding the bit, while a bit watchpoint only sees bit instructions and
+//changes of value
+type Watchpoint struct {
+	ID      int
+	Space   mu51.Space
+	Addr    uint16
+	Kind    WatchKind
+	Enabled bool
+	Hits    int
+
+	last uint8 //value at the last check, for WatchChange
+}
+
+//matches reports whether an access touches the watched location
+func (w *Watchpoint) matches(a mu51.Access) bool {
+	if a.Space == w.Space && a.Addr == w.Addr {
+		return true
+	}
+	if w.Space == mu51.SpaceBit || a.Space != mu51.SpaceBit {
+		return false
+	}
+	addr, _ := mu51.BitLocation(uint8(a.Addr))
+	space := mu51.SpaceSFR
+	if addr < 0x80 {
+		space = mu51.SpaceIRAM
+	}
+	return w.Space == space && w.Addr == uint16(addr)
+}
+
+//Peek reads a location without side effects, special function
+//registers are read from their backing store rather than callbacks
+//and memory which is a mu51.Peeker, such as a Bus with memory mapped
+//registers, is peeked rather than read
+func Peek(c *mu51.CPU, space mu51.Space, addr uint16) uint8 {
+	b := make([]byte, 1)
+	switch space {
+	case mu51.SpaceCode:
+		if c.ProgMem != nil {
+			peekAt(c.ProgMem, b, addr)
+		}
+		return b[0]
+	case mu51.SpaceIRAM:
+		return c.InternalRAM[uint8(addr)]
+	case mu51.SpaceSFR:
+		if uint8(addr) == mu51.PSW {
+			return c.ProgStatus()
+		}
+		return c.SFR(uint8(addr))
+	case mu51.SpaceXDATA:
+		if c.ExtRAM != nil {
+			peekAt(c.ExtRAM, b, addr)
+		}
+		return b[0]
+	case mu51.SpaceBit:
+		byteAddr, mask := mu51.BitLocation(uint8(addr))
+		space := mu51.SpaceSFR
+		if byteAddr < 0x80 {
+			space = mu51.SpaceIRAM
+		}
+		if Peek(c, space, uint16(byteAddr))&mask != 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+//peekAt reads m at addr, through PeekAt when m supports it
+func peekAt(m mu51.CodeMemory, b []byte, addr uint16) {
+	if p, ok := m.(mu51.Peeker); ok {
+		p.PeekAt(b, int64(addr))
+		return
+	}
+	m.ReadAt(b, int64(addr))
+}
+
+//ErrReadOnly is returned by Poke for code memory which cannot be written
+var ErrReadOnly = errors.New("memory is read only")
+
+//Poke writes a location without side effects, special function
+//registers are written to their backing store rather than callbacks.
+//Bits are set by any non zero value
+func Poke(c *mu51.CPU, space mu51.Space, addr uint16, val uint8) error {
+	switch space {
+	case mu51.SpaceCode:
+		ram, ok := c.ProgMem.(mu51.RAM)
+		if !ok {
+			return ErrReadOnly
+		}
+		_, err := ram.WriteAt([]byte{val}, int64(addr))
+		return err
+	case mu51.SpaceIRAM:
+		c.InternalRAM[uint8(addr)] = val
+	case mu51.SpaceSFR:
+		c.SetSFR(uint8(addr), val)
+	case mu51.SpaceXDATA:
+		if c.ExtRAM == nil {
+			return mu51.ErrNoExtRAM
+		}
+		_, err := c.ExtRAM.WriteAt([]byte{val}, int64(addr))
+		return err
+	case mu51.SpaceBit:
+		byteAddr, mask := mu51.BitLocation(uint8(addr))
+		space := mu51.SpaceSFR
+		if byteAddr < 0x80 {
+			space = mu51.SpaceIRAM
+		}
+		b := Peek(c, space, uint16(byteAddr)) &^ mask
+		if val != 0 {
+			b |= mask
+		}
+		return Poke(c, space, uint16(byteAddr), b)
+	}
+	return nil
+}
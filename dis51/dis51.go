@@ -0,0 +1,338 @@
+//Package dis51 renders 8051 machine code as Intel syntax assembly.
+//It can format single decoded instructions or walk a whole code
+//image by recursive descent, separating code from data
+package dis51
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//Vectors are the reset and interrupt vectors of the standard 8051/8052,
+//these are the default entry points for a recursive disassembly
+var Vectors = []uint16{0x0000, 0x0003, 0x000B, 0x0013, 0x001B, 0x0023, 0x002B}
+
+//Symbols maps addresses onto names which are used in place of numeric
+//operands. Any map may be nil, in which case the standard SFR and bit
+//names are still used for direct and bit operands
+type Symbols struct {
+	Code map[uint16]string //code addresses, used for jump and call targets
+	Data map[uint8]string  //direct addresses, override the SFR names
+	Bits map[uint8]string  //bit addresses, override the SFR bit names
+}
+
+//Hex formats a value in Intel syntax with at least digits hex digits,
+//a leading zero is added whenever the number would start with a letter
+func Hex(v uint16, digits int) string {
+	s := fmt.Sprintf("%0*Xh", digits, v)
+	if s[0] >= 'A' && s[0] <= 'F' {
+		s = "0" + s
+	}
+	return s
+}
+
+func (s *Symbols) code(addr uint16) string {
+	if s != nil {
+		if name, ok := s.Code[addr]; ok {
+			return name
+		}
+	}
+	return Hex(addr, 4)
+}
+
+func (s *Symbols) data(addr uint8) string {
+	if s != nil {
+		if name, ok := s.Data[addr]; ok {
+			return name
+		}
+	}
+	if addr >= 0x80 {
+		if name, ok := mu51.SFRName(addr); ok {
+			return name
+		}
+	}
+	return Hex(uint16(addr), 2)
+}
+
+func (s *Symbols) bit(bit uint8) string {
+	if s != nil {
+		if name, ok := s.Bits[bit]; ok {
+			return name
+		}
+	}
+	if name, ok := mu51.BitName(bit); ok {
+		return name
+	}
+	addr, _ := mu51.BitLocation(bit)
+	return fmt.Sprintf("%s.%d", s.data(addr), bit&0x07)
+}
+
+//FormatOperand renders a single operand in Intel syntax
+func FormatOperand(o mu51.Operand, sym *Symbols) string {
+	switch o.Kind {
+	case mu51.OperandA:
+		return "A"
+	case mu51.OperandAB:
+		return "AB"
+	case mu51.OperandC:
+		return "C"
+	case mu51.OperandDPTR:
+		return "DPTR"
+	case mu51.OperandReg:
+		return fmt.Sprintf("R%d", o.Value)
+	case mu51.OperandInd:
+		return fmt.Sprintf("@R%d", o.Value)
+	case mu51.OperandImm:
+		return "#" + Hex(o.Value, 2)
+	case mu51.OperandImm16:
+		return "#" + Hex(o.Value, 4)
+	case mu51.OperandDirect:
+		return sym.data(uint8(o.Value))
+	case mu51.OperandBit:
+		return sym.bit(uint8(o.Value))
+	case mu51.OperandNotBit:
+		return "/" + sym.bit(uint8(o.Value))
+	case mu51.OperandRel, mu51.OperandAddr11, mu51.OperandAddr16:
+		return sym.code(o.Value)
+	case mu51.OperandAtDPTR:
+		return "@DPTR"
+	case mu51.OperandAtADPTR:
+		return "@A+DPTR"
+	case mu51.OperandAtAPC:
+		return "@A+PC"
+	}
+	return "?"
+}
+
+//Format renders a decoded instruction in Intel syntax, sym may be nil
+func Format(in mu51.Instruction, sym *Symbols) string {
+	if in.Op == mu51.ERR {
+		return "DB " + Hex(uint16(in.Opcode()), 2)
+	}
+	if len(in.Operands) == 0 {
+		return in.Op.String()
+	}
+	ops := make([]string, len(in.Operands))
+	for i, o := range in.Operands {
+		ops[i] = FormatOperand(o, sym)
+	}
+	return in.Op.String() + " " + strings.Join(ops, ",")
+}
+
+//Line is a single line of a disassembly listing, either an
+//instruction or a run of data bytes
+type Line struct {
+	Address uint16
+	Bytes   []byte
+	Label   string //label defined at Address, empty if none
+	Text    string
+	Code    bool //true for instructions, false for data
+}
+
+//Options controls a recursive disassembly
+type Options struct {
+	//Entries are the addresses code is traced from, when empty
+	//the reset vector and any interrupt vector which does not
+	//hold erased (0xFF) memory are used
+	Entries []uint16
+
+	//Symbols used in place of numeric operands, code symbols are
+	//also emitted as labels. Branch targets without a symbol are
+	//given generated labels of the form L1234
+	Symbols Symbols
+}
+
+//flow describes how control leaves an instruction
+func flow(in mu51.Instruction) (target uint16, branches, falls bool) {
+	switch in.Op {
+	case mu51.AJMP, mu51.LJMP, mu51.SJMP:
+		return in.Operands[0].Value, true, false
+	case mu51.ACALL, mu51.LCALL, mu51.JC, mu51.JNC, mu51.JZ, mu51.JNZ:
+		return in.Operands[0].Value, true, true
+	case mu51.JB, mu51.JNB, mu51.JBC, mu51.DJNZ:
+		return in.Operands[1].Value, true, true
+	case mu51.CJNE:
+		return in.Operands[2].Value, true, true
+	case mu51.RET, mu51.RETI, mu51.JMP, mu51.ERR:
+		return 0, false, false
+	}
+	return 0, false, true
+}
+
+func codeSize(mem mu51.CodeMemory) int {
+	size := mem.Size()
+	if size > 0x10000 {
+		size = 0x10000
+	}
+	return int(size)
+}
+
+//Disassemble walks code memory by recursive descent from the entry
+//points, following jumps, calls and conditional branches. Bytes which
+//are never reached are rendered as data. Code memory which delivers
+//fewer bytes than its size reports io.ErrUnexpectedEOF
+func Disassemble(mem mu51.CodeMemory, opts Options) ([]Line, error) {
+	size := codeSize(mem)
+	image := make([]byte, size)
+	if n, err := mem.ReadAt(image, 0); n != size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	entries := opts.Entries
+	if len(entries) == 0 {
+		for _, v := range Vectors {
+			if int(v) < size && (v == 0 || image[v] != 0xFF) {
+				entries = append(entries, v)
+			}
+		}
+	}
+
+	const (
+		unknown = iota
+		start   //first byte of an instruction
+		operand //remaining bytes of an instruction
+	)
+	kind := make([]uint8, size)
+	insts := make(map[uint16]mu51.Instruction)
+	targets := make(map[uint16]bool)
+
+	for _, e := range entries {
+		work := []uint16{e}
+		for len(work) > 0 {
+			pc := work[len(work)-1]
+			work = work[:len(work)-1]
+			for int(pc) < size && kind[pc] == unknown {
+				in, err := mu51.Decode(pc, image[pc:])
+				if err != nil {
+					break
+				}
+				clash := false
+				for i := 1; i < int(in.Len); i++ {
+					if kind[int(pc)+i] != unknown {
+						clash = true
+					}
+				}
+				if clash {
+					break
+				}
+				kind[pc] = start
+				for i := 1; i < int(in.Len); i++ {
+					kind[int(pc)+i] = operand
+				}
+				insts[pc] = in
+				target, branches, falls := flow(in)
+				if branches {
+					targets[target] = true
+					work = append(work, target)
+				}
+				if !falls {
+					break
+				}
+				pc = in.Next()
+			}
+		}
+	}
+
+	//generate labels for every decoded branch target and code symbol
+	sym := opts.Symbols
+	labels := make(map[uint16]string)
+	for addr, name := range sym.Code {
+		labels[addr] = name
+	}
+	for addr := range targets {
+		if int(addr) >= size || kind[addr] != start {
+			continue //no instruction starts there to carry a label
+		}
+		if _, ok := labels[addr]; !ok {
+			labels[addr] = fmt.Sprintf("L%04X", addr)
+		}
+	}
+	sym.Code = labels
+
+	var lines []Line
+	for pc := 0; pc < size; {
+		if kind[pc] == start {
+			in := insts[uint16(pc)]
+			lines = append(lines, Line{
+				Address: uint16(pc),
+				Bytes:   in.Bytes,
+				Label:   labels[uint16(pc)],
+				Text:    Format(in, &sym),
+				Code:    true,
+			})
+			pc += int(in.Len)
+			continue
+		}
+		//gather a run of data bytes, breaking at labels, code and
+		//eight byte boundaries so tables line up with their addresses
+		end := pc + 1
+		for end < size && end%8 != 0 && kind[end] != start {
+			if _, ok := labels[uint16(end)]; ok {
+				break
+			}
+			end++
+		}
+		vals := make([]string, end-pc)
+		for i := range vals {
+			vals[i] = Hex(uint16(image[pc+i]), 2)
+		}
+		lines = append(lines, Line{
+			Address: uint16(pc),
+			Bytes:   image[pc:end],
+			Label:   labels[uint16(pc)],
+			Text:    "DB " + strings.Join(vals, ","),
+		})
+		pc = end
+	}
+	return lines, nil
+}
+
+//Linear disassembles count instructions starting at addr, treating
+//everything as code. This is intended for views around the program
+//counter rather than whole images
+func Linear(mem mu51.CodeMemory, addr uint16, count int, sym *Symbols) ([]Line, error) {
+	var lines []Line
+	for i := 0; i < count; i++ {
+		in, err := mu51.ReadInstruction(mem, int64(addr))
+		if err != nil {
+			return lines, err
+		}
+		line := Line{Address: addr, Bytes: in.Bytes, Text: Format(in, sym), Code: true}
+		if sym != nil {
+			line.Label = sym.Code[addr]
+		}
+		lines = append(lines, line)
+		addr = in.Next()
+	}
+	return lines, nil
+}
+
+//WriteListing writes lines as an assembly listing with the address
+//and raw bytes of each line in a leading comment column
+func WriteListing(w io.Writer, lines []Line) error {
+	for _, l := range lines {
+		if l.Label != "" {
+			if _, err := fmt.Fprintf(w, "%s:\n", l.Label); err != nil {
+				return err
+			}
+		}
+		raw := make([]string, len(l.Bytes))
+		for i, b := range l.Bytes {
+			raw[i] = fmt.Sprintf("%02X", b)
+		}
+		bytes := strings.Join(raw, " ")
+		if len(l.Bytes) > 3 {
+			bytes = raw[0] + " ..."
+		}
+		if _, err := fmt.Fprintf(w, "\t%-24s; %04X  %s\n", l.Text, l.Address, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package dis51
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+type rom []byte
+
+func (r rom) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(r)) {
+		return 0, io.EOF
+	}
+	n := copy(b, r[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r rom) Size() int64 {
+	return int64(len(r))
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		code []byte
+		text string
+	}{
+		{[]byte{0xD2, 0x8C}, "SETB TR0"},
+		{[]byte{0xF5, 0x99}, "MOV SBUF,A"},
+		{[]byte{0x75, 0x89, 0x21}, "MOV TMOD,#21h"},
+		{[]byte{0x85, 0x30, 0xE0}, "MOV ACC,30h"},
+		{[]byte{0x74, 0xFF}, "MOV A,#0FFh"},
+		{[]byte{0xC2, 0x93}, "CLR P1.3"},
+		{[]byte{0xB0, 0x05}, "ANL C,/20h.5"},
+		{[]byte{0x90, 0xAB, 0xCD}, "MOV DPTR,#0ABCDh"},
+		{[]byte{0x02, 0x01, 0x00}, "LJMP 0100h"},
+		{[]byte{0x93}, "MOVC A,@A+DPTR"},
+		{[]byte{0xE3}, "MOVX A,@R1"},
+		{[]byte{0xA5}, "DB 0A5h"},
+	}
+	for _, v := range cases {
+		in, err := mu51.Decode(0, v.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := Format(in, nil); s != v.text {
+			t.Errorf("0x%02X formatted as %q, expected %q", v.code[0], s, v.text)
+		}
+	}
+	in, _ := mu51.Decode(0x10, []byte{0x80, 0xFE})
+	if s := Format(in, &Symbols{Code: map[uint16]string{0x10: "spin"}}); s != "SJMP spin" {
+		t.Errorf("symbol substitution gave %q", s)
+	}
+}
+
+func TestDisassembleSeparatesData(t *testing.T) {
+	image := make(rom, 0x30)
+	for i := range image {
+		image[i] = 0xFF
+	}
+	copy(image, []byte{
+		0x02, 0x00, 0x10, //0000 LJMP 0010h
+	})
+	copy(image[0x10:], []byte{
+		0x90, 0x00, 0x20, //0010 MOV DPTR,#0020h
+		0xE4,       //0013 CLR A
+		0x93,       //0014 MOVC A,@A+DPTR
+		0x60, 0xFE, //0015 JZ 0015h
+		0x80, 0xF7, //0017 SJMP 0010h
+	})
+	copy(image[0x20:], "Hi!")
+	lines, err := Disassemble(image, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	WriteListing(&buf, lines)
+	out := buf.String()
+	for _, want := range []string{"LJMP L0010", "L0010:", "L0015:", "JZ L0015", "SJMP L0010", "DB 48h,69h,21h"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("listing missing %q:\n%s", want, out)
+		}
+	}
+	for _, l := range lines {
+		if l.Code && l.Address >= 0x20 {
+			t.Errorf("data at 0x%04X rendered as code %q", l.Address, l.Text)
+		}
+		if l.Code && l.Address == 0x03 {
+			t.Error("erased interrupt vector traced as code")
+		}
+	}
+}
+
+func TestParseSymbols(t *testing.T) {
+	sym, err := ParseSymbols(strings.NewReader("; comment\nC:0100 main\nD:30 counter\nB:00h ready\n0200 isr\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym.Code[0x100] != "main" || sym.Code[0x200] != "isr" || sym.Data[0x30] != "counter" || sym.Bits[0] != "ready" {
+		t.Errorf("unexpected symbols %v", sym)
+	}
+}
+
+//shortROM claims more code memory than it can deliver
+type shortROM struct{ rom }
+
+func (r shortROM) Size() int64 {
+	return int64(len(r.rom)) + 8
+}
+
+func TestDisassembleTruncated(t *testing.T) {
+	lines, err := Disassemble(shortROM{rom{0x00, 0x00}}, Options{})
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("short read gave %v, expected io.ErrUnexpectedEOF", err)
+	}
+	if lines != nil {
+		t.Error("short read produced a listing")
+	}
+	lines, err = Disassemble(rom{}, Options{})
+	if err != nil || len(lines) != 0 {
+		t.Errorf("empty image gave %d lines, %v", len(lines), err)
+	}
+}
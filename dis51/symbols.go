@@ -0,0 +1,59 @@
+package dis51
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//ParseSymbols reads a symbol file. Each line holds a hex address and a
+//name separated by whitespace. The address may be prefixed with C: for
+//code (the default), D: for a direct address or B: for a bit address.
+//Blank lines and lines starting with ; or # are ignored
+//
+//	C:0100 main
+//	D:30   counter
+//	B:00   ready
+func ParseSymbols(r io.Reader) (Symbols, error) {
+	sym := Symbols{
+		Code: make(map[uint16]string),
+		Data: make(map[uint8]string),
+		Bits: make(map[uint8]string),
+	}
+	scn := bufio.NewScanner(r)
+	line := 0
+	for scn.Scan() {
+		line++
+		text := strings.TrimSpace(scn.Text())
+		if text == "" || text[0] == ';' || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return sym, fmt.Errorf("symbol file line %d: expected address and name", line)
+		}
+		space, addr := "C", fields[0]
+		if i := strings.IndexByte(addr, ':'); i >= 0 {
+			space, addr = strings.ToUpper(addr[:i]), addr[i+1:]
+		}
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+		addr = strings.TrimSuffix(strings.TrimSuffix(addr, "h"), "H")
+		val, err := strconv.ParseUint(addr, 16, 16)
+		if err != nil {
+			return sym, fmt.Errorf("symbol file line %d: %s", line, err)
+		}
+		switch {
+		case space == "C":
+			sym.Code[uint16(val)] = fields[1]
+		case space == "D" && val < 0x100:
+			sym.Data[uint8(val)] = fields[1]
+		case space == "B" && val < 0x100:
+			sym.Bits[uint8(val)] = fields[1]
+		default:
+			return sym, fmt.Errorf("symbol file line %d: bad address %s", line, fields[0])
+		}
+	}
+	return sym, scn.Err()
+}
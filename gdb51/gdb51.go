@@ -0,0 +1,601 @@
+//Package gdb51 serves the GDB remote serial protocol for firmware running
+//on the mu51 emulator, so gdb or an IDE can debug it over TCP.
+//
+//Registers are sent as 16 bytes in this order, multi byte registers
+//little endian:
+//
+//	0-7   R0-R7 of the active bank
+//	8     ACC
+//	9     B
+//	10-11 DPTR, the active pointer on parts with several
+//	12    SP
+//	13    PSW
+//	14-15 PC
+//
+//The 8051 address spaces are distinguished by the third byte of the
+//24 bit addresses used in memory and watchpoint packets:
+//
+//	0x000000-0x00FFFF CODE
+//	0x010000-0x0100FF IDATA, internal ram as seen through @Ri
+//	0x020000-0x02FFFF XDATA
+//	0x030080-0x0300FF SFR, read without triggering peripheral side effects
+//
+//Supported packets are ?, g, G, p, P, m, M, c, s, vCont, Z0-Z4 and their
+//removal, k, D and the queries needed to connect. Breakpoints of kind Z0
+//and Z1 are equivalent, as are the watchpoint kinds on any space
+package gdb51
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/JonathanFraser/go51/dbg51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//address space selectors held in the third byte of an address
+const (
+	spaceCode  = 0x00
+	spaceIDATA = 0x01
+	spaceXDATA = 0x02
+	spaceSFR   = 0x03
+)
+
+//ErrBadAddress is returned for an address outside every space
+var ErrBadAddress = errors.New("address outside the 8051 address spaces")
+
+//numRegs is the number of registers in the layout, regBytes their size
+const (
+	numRegs  = 14
+	regBytes = 16
+)
+
+//Server debugs a single CPU over the remote protocol. Connections are
+//served one at a time, each controls the CPU until it detaches
+type Server struct {
+	Debugger *dbg51.Debugger
+
+	points map[string][]int //debugger point ids by Z packet
+}
+
+//NewServer returns a server debugging c
+func NewServer(c *mu51.CPU) *Server {
+	return &Server{Debugger: dbg51.New(c)}
+}
+
+//ListenAndServe accepts connections on the TCP address addr, such as
+//"localhost:2331", serving each in turn
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+//Serve accepts connections on l, serving each in turn
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		err = s.ServeConn(conn)
+		conn.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+//input is a packet, a packet with a bad checksum or an interrupt
+//request read from the client
+type input struct {
+	packet    string
+	bad       bool
+	interrupt bool
+	err       error
+
+	acked bool //already acknowledged, as packets queued during a run are
+}
+
+//conn is the state of a single client connection
+type conn struct {
+	s     *Server
+	w     io.Writer
+	in    chan input
+	done  chan struct{} //closed when the connection is no longer served
+	queue []input       //packets which arrived while the target ran
+	noAck bool
+}
+
+//ServeConn serves the protocol over rw until the client detaches, kills
+//the target or the connection closes
+func (s *Server) ServeConn(rw io.ReadWriter) error {
+	c := &conn{s: s, w: rw, in: make(chan input, 16), done: make(chan struct{})}
+	defer close(c.done)
+	go c.read(bufio.NewReader(rw))
+	for {
+		v, ok := c.next()
+		if !ok {
+			return io.EOF
+		}
+		if v.err != nil {
+			return v.err
+		}
+		if v.interrupt {
+			continue
+		}
+		if v.bad {
+			if err := c.ack(false); err != nil {
+				return err
+			}
+			continue
+		}
+		if !v.acked {
+			if err := c.ack(true); err != nil {
+				return err
+			}
+		}
+		reply, done := c.handle(v.packet)
+		if err := c.send(reply); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+//next returns the next input from the client, packets queued while
+//the target ran come first
+func (c *conn) next() (input, bool) {
+	if len(c.queue) > 0 {
+		v := c.queue[0]
+		c.queue = c.queue[1:]
+		return v, true
+	}
+	v, ok := <-c.in
+	return v, ok
+}
+
+//ack acknowledges a packet, or asks for it again when its checksum
+//was bad, unless acknowledgements have been turned off
+func (c *conn) ack(good bool) error {
+	if c.noAck {
+		return nil
+	}
+	a := "+"
+	if !good {
+		a = "-"
+	}
+	_, err := io.WriteString(c.w, a)
+	return err
+}
+
+//put passes an input to the connection, reporting false once the
+//connection is no longer being served
+func (c *conn) put(v input) bool {
+	select {
+	case c.in <- v:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+//read splits the client stream into packets and interrupt requests
+//until the stream or the connection ends, acknowledgements are ignored
+func (c *conn) read(r *bufio.Reader) {
+	defer close(c.in)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			c.put(input{err: err})
+			return
+		}
+		var v input
+		switch b {
+		case 0x03:
+			v.interrupt = true
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				c.put(input{err: err})
+				return
+			}
+			sum := make([]byte, 2)
+			if _, err := io.ReadFull(r, sum); err != nil {
+				c.put(input{err: err})
+				return
+			}
+			v.packet = data[:len(data)-1]
+			n, err := strconv.ParseUint(string(sum), 16, 8)
+			v.bad = err != nil || uint8(n) != checksum(v.packet)
+		default:
+			continue
+		}
+		if !c.put(v) {
+			return
+		}
+	}
+}
+
+//checksum returns the modulo 256 sum of a packet's data
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+//send writes a packet to the client
+func (c *conn) send(data string) error {
+	_, err := fmt.Fprintf(c.w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+//handle executes a packet, returning the reply and whether the
+//connection should close after sending it
+func (c *conn) handle(p string) (string, bool) {
+	d := c.s.Debugger
+	cpu := d.CPU
+	switch {
+	case p == "?":
+		return "S05", false
+	case p == "g":
+		return hex.EncodeToString(readRegs(cpu)), false
+	case strings.HasPrefix(p, "G"):
+		b, err := hex.DecodeString(p[1:])
+		if err != nil || len(b) != regBytes {
+			return "E01", false
+		}
+		writeRegs(cpu, b)
+		return "OK", false
+	case strings.HasPrefix(p, "p"):
+		n, err := strconv.ParseUint(p[1:], 16, 8)
+		if err != nil || n >= numRegs {
+			return "E01", false
+		}
+		off, size := regSpan(int(n))
+		return hex.EncodeToString(readRegs(cpu)[off : off+size]), false
+	case strings.HasPrefix(p, "P"):
+		return c.writeReg(p[1:]), false
+	case strings.HasPrefix(p, "m"):
+		return c.readMem(p[1:]), false
+	case strings.HasPrefix(p, "M"):
+		return c.writeMem(p[1:]), false
+	case strings.HasPrefix(p, "c"):
+		return c.resume(p[1:], d.Continue), false
+	case strings.HasPrefix(p, "s"):
+		return c.resume(p[1:], d.Step), false
+	case p == "vCont?":
+		return "vCont;c;C;s;S", false
+	case strings.HasPrefix(p, "vCont;"):
+		return c.vCont(p[len("vCont;"):]), false
+	case strings.HasPrefix(p, "Z"), strings.HasPrefix(p, "z"):
+		return c.point(p), false
+	case strings.HasPrefix(p, "qSupported"):
+		return "PacketSize=1000;QStartNoAckMode+;vContSupported+", false
+	case p == "QStartNoAckMode":
+		c.noAck = true
+		return "OK", false
+	case p == "qAttached":
+		return "1", false
+	case p == "qC":
+		return "QC1", false
+	case p == "qfThreadInfo":
+		return "m1", false
+	case p == "qsThreadInfo":
+		return "l", false
+	case strings.HasPrefix(p, "H"), strings.HasPrefix(p, "T"):
+		return "OK", false
+	case p == "k", strings.HasPrefix(p, "D"):
+		return "OK", true
+	}
+	return "", false
+}
+
+//regSpan returns the offset and size of register n in the layout
+func regSpan(n int) (int, int) {
+	switch {
+	case n < 10:
+		return n, 1
+	case n == 10:
+		return 10, 2
+	case n < 13:
+		return n + 1, 1
+	}
+	return 14, 2
+}
+
+//readRegs returns the registers in the documented layout
+func readRegs(c *mu51.CPU) []byte {
+	b := make([]byte, regBytes)
+	bank := int(c.ProgStatus()>>3&0x03) * 8
+	copy(b, c.InternalRAM[bank:bank+8])
+	b[8] = c.Accum()
+	b[9] = c.BReg()
+	dptr := c.DataPtr()
+	b[10], b[11] = uint8(dptr), uint8(dptr>>8)
+	b[12] = c.StackPtr()
+	b[13] = c.ProgStatus()
+	b[14], b[15] = uint8(c.ProgCount), uint8(c.ProgCount>>8)
+	return b
+}
+
+//writeRegs loads the registers from the documented layout, PSW is
+//written first so R0-R7 land in the bank it selects
+func writeRegs(c *mu51.CPU, b []byte) {
+	c.SetProgStatus(b[13])
+	bank := int(b[13]>>3&0x03) * 8
+	copy(c.InternalRAM[bank:bank+8], b[:8])
+	c.SetAccum(b[8])
+	c.SetBReg(b[9])
+	c.SetDataPtr(uint16(b[11])<<8 | uint16(b[10]))
+	c.SetStackPtr(b[12])
+	c.ProgCount = uint16(b[15])<<8 | uint16(b[14])
+}
+
+//writeReg handles the body of a P packet, n=value
+func (c *conn) writeReg(arg string) string {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	n, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || n >= numRegs {
+		return "E01"
+	}
+	off, size := regSpan(int(n))
+	v, err := hex.DecodeString(parts[1])
+	if err != nil || len(v) != size {
+		return "E01"
+	}
+	cpu := c.s.Debugger.CPU
+	regs := readRegs(cpu)
+	copy(regs[off:], v)
+	writeRegs(cpu, regs)
+	return "OK"
+}
+
+//parseAddr parses a 24 bit address into a debugger space and offset
+func parseAddr(s string) (mu51.Space, uint16, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	off := uint16(v)
+	switch v >> 16 {
+	case spaceCode:
+		return mu51.SpaceCode, off, nil
+	case spaceIDATA:
+		if off > 0xFF {
+			return 0, 0, ErrBadAddress
+		}
+		return mu51.SpaceIRAM, off, nil
+	case spaceXDATA:
+		return mu51.SpaceXDATA, off, nil
+	case spaceSFR:
+		if off < 0x80 || off > 0xFF {
+			return 0, 0, ErrBadAddress
+		}
+		return mu51.SpaceSFR, off, nil
+	}
+	return 0, 0, ErrBadAddress
+}
+
+//parseRange parses the addr,length argument of memory packets
+func parseRange(arg string) (mu51.Space, uint16, int, error) {
+	parts := strings.SplitN(arg, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, 0, ErrBadAddress
+	}
+	space, addr, err := parseAddr(parts[0])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	n, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return space, addr, int(n), nil
+}
+
+//readMem handles the body of an m packet, addr,length
+func (c *conn) readMem(arg string) string {
+	space, addr, n, err := parseRange(arg)
+	if err != nil {
+		return "E01"
+	}
+	cpu := c.s.Debugger.CPU
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = dbg51.Peek(cpu, space, addr+uint16(i))
+	}
+	return hex.EncodeToString(b)
+}
+
+//writeMem handles the body of an M packet, addr,length:data. Code
+//memory can only be written when it supports writes, as ram does
+func (c *conn) writeMem(arg string) string {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	space, addr, n, err := parseRange(parts[0])
+	if err != nil {
+		return "E01"
+	}
+	data, err := hex.DecodeString(parts[1])
+	if err != nil || len(data) != n {
+		return "E01"
+	}
+	cpu := c.s.Debugger.CPU
+	for i, v := range data {
+		if err := dbg51.Poke(cpu, space, addr+uint16(i), v); err != nil {
+			return "E02"
+		}
+	}
+	return "OK"
+}
+
+//resume handles c and s packets, an optional address sets the PC
+//before running. An interrupt from the client stops the run, other
+//packets are acknowledged and queued to be handled once it stops
+func (c *conn) resume(arg string, run func() dbg51.Event) string {
+	if arg != "" {
+		v, err := strconv.ParseUint(arg, 16, 32)
+		if err != nil {
+			return "E01"
+		}
+		c.s.Debugger.CPU.ProgCount = uint16(v)
+	}
+	//an interrupt read as the last run stopped would otherwise stop
+	//this one before it starts
+	c.s.Debugger.CancelInterrupt()
+	done := make(chan dbg51.Event, 1)
+	go func() {
+		done <- run()
+	}()
+	for {
+		select {
+		case ev := <-done:
+			return stopReply(ev)
+		case v, ok := <-c.in:
+			switch {
+			case !ok:
+				c.s.Debugger.Interrupt()
+				return stopReply(<-done)
+			case v.interrupt:
+				c.s.Debugger.Interrupt()
+			case v.err != nil:
+				//stop and leave the error for the serve loop
+				c.s.Debugger.Interrupt()
+				c.queue = append(c.queue, v)
+			case v.bad:
+				c.ack(false)
+			default:
+				c.ack(true)
+				v.acked = true
+				c.queue = append(c.queue, v)
+			}
+		}
+	}
+}
+
+//vCont handles the actions of a vCont packet, the single thread
+//means only the first action applies
+func (c *conn) vCont(arg string) string {
+	action := strings.SplitN(strings.SplitN(arg, ";", 2)[0], ":", 2)[0]
+	if action == "" {
+		return "E01"
+	}
+	d := c.s.Debugger
+	switch action[0] {
+	case 'c', 'C':
+		return c.resume("", d.Continue)
+	case 's', 'S':
+		return c.resume("", d.Step)
+	}
+	return "E01"
+}
+
+//stopReply returns the stop reply packet for a debugger event
+func stopReply(ev dbg51.Event) string {
+	switch ev.Reason {
+	case dbg51.StopInterrupt:
+		return "S02"
+	case dbg51.StopError:
+		if errors.Is(ev.Err, mu51.ErrUnknownOpCode) {
+			return "S04"
+		}
+		return "S0b"
+	case dbg51.StopWatchpoint:
+		w := ev.Watchpoint
+		kind := "watch"
+		switch w.Kind {
+		case dbg51.WatchRead:
+			kind = "rwatch"
+		case dbg51.WatchRead | dbg51.WatchWrite:
+			kind = "awatch"
+		}
+		return fmt.Sprintf("T05%s:%x;", kind, encodeAddr(w.Space, w.Addr))
+	}
+	return "S05"
+}
+
+//encodeAddr returns the 24 bit address of a location
+func encodeAddr(space mu51.Space, addr uint16) uint32 {
+	switch space {
+	case mu51.SpaceIRAM:
+		return spaceIDATA<<16 | uint32(addr)
+	case mu51.SpaceXDATA:
+		return spaceXDATA<<16 | uint32(addr)
+	case mu51.SpaceSFR:
+		return spaceSFR<<16 | uint32(addr)
+	}
+	return uint32(addr)
+}
+
+//point handles Z and z packets, type,addr,kind
+func (c *conn) point(p string) string {
+	parts := strings.Split(p[1:], ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	d := c.s.Debugger
+	if c.s.points == nil {
+		c.s.points = make(map[string][]int)
+	}
+	key := parts[0] + "," + parts[1]
+	if p[0] == 'z' {
+		for _, id := range c.s.points[key] {
+			d.Remove(id)
+		}
+		delete(c.s.points, key)
+		return "OK"
+	}
+	if _, ok := c.s.points[key]; ok {
+		return "OK"
+	}
+	space, addr, err := parseAddr(parts[1])
+	if err != nil {
+		return "E01"
+	}
+	var kind dbg51.WatchKind
+	switch parts[0] {
+	case "0", "1":
+		if space != mu51.SpaceCode {
+			return "E01"
+		}
+		c.s.points[key] = []int{d.AddBreakpoint(addr).ID}
+		return "OK"
+	case "2":
+		kind = dbg51.WatchWrite
+	case "3":
+		kind = dbg51.WatchRead
+	case "4":
+		kind = dbg51.WatchRead | dbg51.WatchWrite
+	default:
+		return ""
+	}
+	n, err := strconv.ParseUint(parts[2], 16, 16)
+	if err != nil || n == 0 {
+		return "E01"
+	}
+	var ids []int
+	for i := uint64(0); i < n; i++ {
+		ids = append(ids, d.AddWatchpoint(space, addr+uint16(i), kind).ID)
+	}
+	c.s.points[key] = ids
+	return "OK"
+}
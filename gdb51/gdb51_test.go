@@ -0,0 +1,233 @@
+package gdb51
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JonathanFraser/go51/as51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+const testProgram = `
+	ORG 0
+	MOV R0,#40h
+	MOV A,#5Ah
+LOOP:	MOV @R0,A
+	MOV DPTR,#1234h
+	MOVX @DPTR,A
+	INC A
+	SJMP LOOP
+`
+
+//client speaks the protocol to a server over a pipe
+type client struct {
+	t *testing.T
+	w io.Writer
+	r *bufio.Reader
+}
+
+func newClient(t *testing.T) (*client, *Server, *as51.Program) {
+	p, err := as51.AssembleString(testProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := mu51.NewCPU(mu51.Memory(p.Image(0xFF)), make(mu51.Memory, 0x10000))
+	s := NewServer(cpu)
+	a, b := net.Pipe()
+	go s.ServeConn(b)
+	return &client{t: t, w: a, r: bufio.NewReader(a)}, s, p
+}
+
+//call sends a packet and returns the reply
+func (c *client) call(data string) string {
+	fmt.Fprintf(c.w, "$%s#%02x", data, checksum(data))
+	ack, err := c.r.ReadByte()
+	if err != nil || ack != '+' {
+		c.t.Fatalf("%s: no ack, %v", data, err)
+	}
+	return c.reply()
+}
+
+//reply reads a reply packet, checking its checksum
+func (c *client) reply() string {
+	if _, err := c.r.ReadString('$'); err != nil {
+		c.t.Fatal(err)
+	}
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	data = data[:len(data)-1]
+	sum := make([]byte, 2)
+	io.ReadFull(c.r, sum)
+	if string(sum) != fmt.Sprintf("%02x", checksum(data)) {
+		c.t.Fatalf("bad checksum on %q", data)
+	}
+	return data
+}
+
+func TestRegistersAndMemory(t *testing.T) {
+	c, s, _ := newClient(t)
+	if r := c.call("qSupported:swbreak+"); !strings.Contains(r, "vContSupported+") {
+		t.Errorf("qSupported gave %q", r)
+	}
+	if r := c.call("?"); r != "S05" {
+		t.Errorf("? gave %q", r)
+	}
+	c.call("s")
+	c.call("s")
+	if r := c.call("g"); r != "4000000000000000"+"5a00"+"0000"+"0700"+"0400" {
+		t.Errorf("g gave %q", r)
+	}
+	if r := c.call("p8"); r != "5a" {
+		t.Errorf("p8 gave %q", r)
+	}
+	if r := c.call("Pa=3412"); r != "OK" || s.Debugger.CPU.DataPtr() != 0x1234 {
+		t.Errorf("P gave %q, DPTR 0x%04X", r, s.Debugger.CPU.DataPtr())
+	}
+	if r := c.call("G" + "01020304050607081122ccdd3000" + "0200"); r != "OK" {
+		t.Errorf("G gave %q", r)
+	}
+	cpu := s.Debugger.CPU
+	if cpu.InternalRAM[0x07] != 0x08 || cpu.BReg() != 0x22 || cpu.DataPtr() != 0xDDCC || cpu.StackPtr() != 0x30 || cpu.ProgCount != 0x0002 {
+		t.Error("G did not load the registers")
+	}
+
+	if r := c.call("m0,4"); r != "7840745a" {
+		t.Errorf("code read gave %q", r)
+	}
+	if r := c.call("M10041,2:abcd"); r != "OK" || cpu.InternalRAM[0x42] != 0xCD {
+		t.Errorf("idata write gave %q", r)
+	}
+	if r := c.call("m30081,1"); r != "30" {
+		t.Errorf("sfr read gave %q", r)
+	}
+	if r := c.call("m30010,1"); r != "E01" {
+		t.Errorf("sfr space below 80h gave %q", r)
+	}
+	if r := c.call("M20100,1:99"); r != "OK" || c.call("m20100,1") != "99" {
+		t.Errorf("xdata write gave %q", r)
+	}
+}
+
+func TestBreakAndWatch(t *testing.T) {
+	c, s, p := newClient(t)
+	loop := p.Symbols["LOOP"]
+	if r := c.call(fmt.Sprintf("Z0,%x,1", loop)); r != "OK" {
+		t.Fatalf("Z0 gave %q", r)
+	}
+	if r := c.call("c"); r != "S05" || s.Debugger.CPU.ProgCount != loop {
+		t.Fatalf("continue gave %q at 0x%04X", r, s.Debugger.CPU.ProgCount)
+	}
+	c.call(fmt.Sprintf("z0,%x,1", loop))
+
+	if r := c.call("Z2,21234,1"); r != "OK" {
+		t.Fatalf("Z2 gave %q", r)
+	}
+	if r := c.call("vCont;c"); r != "T05watch:21234;" {
+		t.Errorf("write watch gave %q", r)
+	}
+	c.call("z2,21234,1")
+	if r := c.call("Z3,10040,1"); r != "OK" {
+		t.Fatalf("Z3 gave %q", r)
+	}
+	c.call("z3,10040,1")
+	if r := c.call("Z4,10040,1"); r != "OK" {
+		t.Fatalf("Z4 gave %q", r)
+	}
+	if r := c.call("c"); r != "T05awatch:10040;" {
+		t.Errorf("access watch gave %q", r)
+	}
+	c.call("z4,10040,1")
+
+	fmt.Fprintf(c.w, "$c#%02x", checksum("c"))
+	c.r.ReadByte()
+	c.w.Write([]byte{0x03})
+	if r := c.reply(); r != "S02" {
+		t.Errorf("interrupted continue gave %q", r)
+	}
+	if r := c.call("k"); r != "OK" {
+		t.Errorf("k gave %q", r)
+	}
+}
+
+func TestNakAndQueuedPackets(t *testing.T) {
+	c, _, _ := newClient(t)
+	io.WriteString(c.w, "$g#00")
+	if b, err := c.r.ReadByte(); err != nil || b != '-' {
+		t.Fatalf("bad checksum answered with %q, %v", b, err)
+	}
+	if r := c.call("m0,1"); r != "78" {
+		t.Errorf("packet after a retransmit request gave %q", r)
+	}
+
+	//a packet sent while running is answered once the run stops
+	fmt.Fprintf(c.w, "$c#%02x", checksum("c"))
+	c.r.ReadByte()
+	fmt.Fprintf(c.w, "$m0,4#%02x", checksum("m0,4"))
+	if b, err := c.r.ReadByte(); err != nil || b != '+' {
+		t.Fatalf("packet during a run acknowledged with %q, %v", b, err)
+	}
+	c.w.Write([]byte{0x03})
+	if r := c.reply(); r != "S02" {
+		t.Errorf("interrupted continue gave %q", r)
+	}
+	if r := c.reply(); r != "7840745a" {
+		t.Errorf("queued read gave %q", r)
+	}
+}
+
+func TestLateInterrupt(t *testing.T) {
+	c, s, _ := newClient(t)
+	c.call("s")
+
+	//an interrupt arriving after the run stopped must not stop the next
+	c.w.Write([]byte{0x03})
+	if r := c.call("s"); r != "S05" {
+		t.Errorf("step after a late interrupt gave %q", r)
+	}
+	s.Debugger.Interrupt()
+	if r := c.call("s"); r != "S05" {
+		t.Errorf("step with a stale interrupt pending gave %q", r)
+	}
+	if r := c.call("vCont;s"); r != "S05" {
+		t.Errorf("vCont step gave %q", r)
+	}
+}
+
+//chatter sends a kill packet followed by an endless stream of packets
+type chatter struct {
+	sent bool
+}
+
+func (r *chatter) Read(b []byte) (int, error) {
+	if !r.sent {
+		r.sent = true
+		return copy(b, "$k#6b"), nil
+	}
+	return copy(b, "$?#3f"), nil
+}
+
+func TestReaderStops(t *testing.T) {
+	cpu := mu51.NewCPU(mu51.Memory{0x00}, nil)
+	before := runtime.NumGoroutine()
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{&chatter{}, io.Discard}
+	if err := NewServer(cpu).ServeConn(rw); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Error("packet reader still running after the connection ended")
+	}
+}
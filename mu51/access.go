@@ -0,0 +1,49 @@
+package mu51
+
+import (
+	"fmt"
+)
+
+//Space identifies one of the 8051 address spaces
+type Space uint8
+
+const (
+	SpaceCode  Space = iota //code memory, read by MOVC
+	SpaceIRAM               //internal ram, direct below 0x80 or indirect
+	SpaceSFR                //special function registers
+	SpaceXDATA              //external ram, reached with MOVX
+	SpaceBit                //the bit addressable space
+)
+
+//spaceNames are the names of each Space
+var spaceNames = []string{"code", "iram", "sfr", "xdata", "bit"}
+
+func (s Space) String() string {
+	if int(s) >= len(spaceNames) {
+		return fmt.Sprintf("space %d", int(s))
+	}
+	return spaceNames[s]
+}
+
+//Access describes a single memory access made by an instruction
+type Access struct {
+	Space Space
+	Addr  uint16
+	Write bool
+	Value uint8 //value read or written, 0 or 1 for bits
+}
+
+//access reports an access to OnAccess, if set
+func (a *ALU) access(s Space, addr uint16, write bool, val uint8) {
+	if a.OnAccess != nil {
+		a.OnAccess(Access{Space: s, Addr: addr, Write: write, Value: val})
+	}
+}
+
+//bitValue returns the value reported for a bit access
+func bitValue(set bool) uint8 {
+	if set {
+		return 1
+	}
+	return 0
+}
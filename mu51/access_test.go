@@ -0,0 +1,45 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestAccessReporting(t *testing.T) {
+	c := newTestCPU(0x1000,
+		0x78, 0x40, //MOV R0,#40h
+		0xE6,       //MOV A,@R0
+		0xF5, 0x90, //MOV P1,A
+		0xD2, 0x00, //SETB 00h
+		0xC0, 0xE0, //PUSH ACC
+	)
+	c.ExtRAM = make(Memory, 0x100)
+	c.InternalRAM[0x40] = 0x5A
+	var got []Access
+	c.OnAccess = func(a Access) {
+		got = append(got, a)
+	}
+	for i := 0; i < 5; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []Access{
+		{SpaceIRAM, 0x00, true, 0x40},
+		{SpaceIRAM, 0x00, false, 0x40},
+		{SpaceIRAM, 0x40, false, 0x5A},
+		{SpaceSFR, 0x90, true, 0x5A},
+		{SpaceIRAM, 0x20, false, 0x00},
+		{SpaceIRAM, 0x20, true, 0x01},
+		{SpaceBit, 0x00, true, 1},
+		{SpaceSFR, 0xE0, false, 0x5A},
+		{SpaceIRAM, 0x08, true, 0x5A},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("accesses %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("access %d was %+v, expected %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package mu51
+
+//Carry reports whether the carry flag is set
+func (a *ALU) Carry() bool {
+	return a.ProgStatus()&CarryBit != 0
+}
+
+//SetCarry sets or clears the carry flag
+func (a *ALU) SetCarry(set bool) {
+	if set {
+		a.SetProgStatus(a.ProgStatus() | CarryBit)
+	} else {
+		a.SetProgStatus(a.ProgStatus() &^ CarryBit)
+	}
+}
+
+//InstrSUBB subtracts val and the carry (borrow) from the accumulator,
+//setting the carry, auxiliary carry and overflow flags from the result
+func (a *ALU) InstrSUBB(val uint8) {
+	var acc = a.Accum()
+	var cy uint8
+	if a.Carry() {
+		cy = 1
+	}
+	var res = acc - val - cy
+	ps := a.ProgStatus() &^ arithFlags
+	if uint16(acc) < uint16(val)+uint16(cy) {
+		ps = ps | CarryBit
+	}
+	if acc&0x0F < val&0x0F+cy {
+		ps = ps | AuxCarryBit
+	}
+	if (acc^val)&(acc^res)&0x80 != 0 {
+		ps = ps | OverFlowBit
+	}
+	a.SetAccum(res)
+	a.SetProgStatus(ps)
+}
+
+//InstrDA decimal adjusts the accumulator after a BCD addition.
+//The carry flag is set if the result exceeds 99 but never cleared
+func (a *ALU) InstrDA() {
+	var res = uint16(a.Accum())
+	var cy = a.Carry()
+	if res&0x0F > 9 || a.ProgStatus()&AuxCarryBit != 0 {
+		res += 0x06
+	}
+	if res > 0xFF {
+		cy = true
+	}
+	if (res>>4)&0x0F > 9 || cy {
+		res += 0x60
+	}
+	if res > 0xFF {
+		cy = true
+	}
+	a.SetAccum(uint8(res))
+	a.SetCarry(cy)
+}
+
+//InstrDIV divides the accumulator by B, placing the quotient in A
+//and the remainder in B. Carry is cleared, overflow is set on a
+//divide by zero in which case A and B are left untouched
+func (a *ALU) InstrDIV() {
+	ps := a.ProgStatus() &^ (CarryBit | OverFlowBit)
+	if a.BReg() == 0 {
+		a.SetProgStatus(ps | OverFlowBit)
+		return
+	}
+	acc, b := a.Accum(), a.BReg()
+	a.SetAccum(acc / b)
+	a.SetBReg(acc % b)
+	a.SetProgStatus(ps)
+}
+
+//InstrRL rotates the accumulator left
+func (a *ALU) InstrRL() {
+	a.SetAccum(a.Accum()<<1 | a.Accum()>>7)
+}
+
+//InstrRR rotates the accumulator right
+func (a *ALU) InstrRR() {
+	a.SetAccum(a.Accum()>>1 | a.Accum()<<7)
+}
+
+//InstrRLC rotates the accumulator left through the carry flag
+func (a *ALU) InstrRLC() {
+	acc := a.Accum()
+	res := acc << 1
+	if a.Carry() {
+		res = res | 0x01
+	}
+	a.SetAccum(res)
+	a.SetCarry(acc&0x80 != 0)
+}
+
+//InstrRRC rotates the accumulator right through the carry flag
+func (a *ALU) InstrRRC() {
+	acc := a.Accum()
+	res := acc >> 1
+	if a.Carry() {
+		res = res | 0x80
+	}
+	a.SetAccum(res)
+	a.SetCarry(acc&0x01 != 0)
+}
@@ -0,0 +1,96 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestSUBB(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"SUBB A,#data borrow", []byte{0x94, 0x01}, setCarry, 0x1002, func(c *CPU) bool {
+			return c.Accum() == 0xFE && c.ProgStatus()&arithFlags == CarryBit|AuxCarryBit
+		}},
+		{"SUBB A,#data overflow", []byte{0x94, 0x01}, func(c *CPU) { c.SetAccum(0x80) }, 0x1002, func(c *CPU) bool {
+			return c.Accum() == 0x7F && c.ProgStatus()&arithFlags == OverFlowBit|AuxCarryBit
+		}},
+		{"SUBB A,direct", []byte{0x95, 0xF0}, func(c *CPU) {
+			c.SetAccum(5)
+			c.SetBReg(5)
+			setCarry(c)
+		}, 0x1002, func(c *CPU) bool {
+			return c.Accum() == 0xFF && c.ProgStatus()&arithFlags == CarryBit|AuxCarryBit
+		}},
+		{"SUBB A,@Ri", []byte{0x96}, func(c *CPU) {
+			c.SetReg(0, 0x40)
+			c.InternalRAM[0x40] = 0x10
+			c.SetAccum(0x10)
+		}, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0 && c.ProgStatus()&arithFlags == 0
+		}},
+		{"SUBB A,Rn", []byte{0x9A}, func(c *CPU) {
+			c.SetReg(2, 0x26)
+			c.SetAccum(0x49)
+			setCarry(c)
+		}, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x22 && c.ProgStatus()&arithFlags == 0
+		}},
+	})
+}
+
+func TestDA(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"DA both nibbles", []byte{0xD4}, func(c *CPU) { c.SetAccum(0x9A) }, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x00 && carry(c)
+		}},
+		{"DA auxiliary carry", []byte{0xD4}, func(c *CPU) {
+			c.SetAccum(0x31)
+			c.SetProgStatus(AuxCarryBit)
+		}, 0x1001, func(c *CPU) bool { return c.Accum() == 0x37 && !carry(c) }},
+		{"DA keeps carry", []byte{0xD4}, setCarry, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x60 && carry(c)
+		}},
+	})
+	c := newTestCPU(0, 0x24, 0x28, 0xD4) //ADD A,#28h DA A
+	c.SetAccum(0x19)
+	c.Step()
+	c.Step()
+	if c.Accum() != 0x47 {
+		t.Errorf("BCD 19+28 gave 0x%02X", c.Accum())
+	}
+}
+
+func TestDIV(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"DIV", []byte{0x84}, func(c *CPU) {
+			c.SetAccum(251)
+			c.SetBReg(18)
+			setCarry(c)
+		}, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 13 && c.BReg() == 17 && c.ProgStatus()&(CarryBit|OverFlowBit) == 0
+		}},
+		{"DIV by zero", []byte{0x84}, func(c *CPU) { c.SetAccum(5) }, 0x1001, func(c *CPU) bool {
+			return c.ProgStatus()&OverFlowBit != 0 && c.Accum() == 5 && c.BReg() == 0
+		}},
+	})
+}
+
+func TestRotate(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"RL", []byte{0x23}, func(c *CPU) { c.SetAccum(0x81) }, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x03 && !carry(c)
+		}},
+		{"RLC", []byte{0x33}, func(c *CPU) { c.SetAccum(0x81) }, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x02 && carry(c)
+		}},
+		{"RLC carry in", []byte{0x33}, setCarry, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x01 && !carry(c)
+		}},
+		{"RR", []byte{0x03}, func(c *CPU) { c.SetAccum(0x01) }, 0x1001, func(c *CPU) bool { return c.Accum() == 0x80 }},
+		{"RRC", []byte{0x13}, func(c *CPU) {
+			c.SetAccum(0x01)
+			setCarry(c)
+		}, 0x1001, func(c *CPU) bool { return c.Accum() == 0x80 && carry(c) }},
+		{"RRC carry out", []byte{0x13}, func(c *CPU) { c.SetAccum(0x03) }, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x01 && carry(c)
+		}},
+	})
+}
@@ -0,0 +1,39 @@
+package mu51
+
+//BitLocation resolves a bit address into the direct address of the
+//byte which holds it and the mask of the bit within that byte.
+//Bit addresses 0x00-0x7F map onto internal ram 0x20-0x2F, while
+//0x80-0xFF map onto the special function registers whose address
+//is divisible by 8 (P0, TCON, P1, SCON, P2, IE, P3, IP, PSW, ACC, B)
+func BitLocation(bit uint8) (addr uint8, mask uint8) {
+	mask = 0x01 << (bit & 0x07)
+	if bit < 0x80 {
+		return 0x20 + bit>>3, mask
+	}
+	return bit &^ 0x07, mask
+}
+
+//ReadBit reads a single bit from the bit addressable space
+//special function registers are read through ReadDirect
+//so any installed callbacks are honoured
+func (c *CPU) ReadBit(bit uint8) bool {
+	addr, mask := BitLocation(bit)
+	set := c.ReadDirect(addr)&mask != 0
+	c.access(SpaceBit, uint16(bit), false, bitValue(set))
+	return set
+}
+
+//WriteBit sets or clears a single bit in the bit addressable
+//space. The containing byte is read, modified and written back
+//as a whole through ReadDirect and WriteDirect
+func (c *CPU) WriteBit(bit uint8, set bool) {
+	addr, mask := BitLocation(bit)
+	val := c.ReadDirect(addr)
+	if set {
+		val = val | mask
+	} else {
+		val = val &^ mask
+	}
+	c.WriteDirect(addr, val)
+	c.access(SpaceBit, uint16(bit), true, bitValue(set))
+}
@@ -0,0 +1,72 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestBitLocation(t *testing.T) {
+	cases := []struct {
+		bit, addr, mask uint8
+	}{
+		{0x00, 0x20, 0x01},
+		{0x07, 0x20, 0x80},
+		{0x08, 0x21, 0x01},
+		{0x7F, 0x2F, 0x80},
+		{0x80, P0, 0x01},
+		{0x8C, TCON, 0x10}, //TR0
+		{0xAF, IE, 0x80},   //EA
+		{0xD7, PSW, 0x80},  //CY
+		{0xE3, ACC, 0x08},
+		{0xF0, B, 0x01},
+	}
+	for _, v := range cases {
+		addr, mask := BitLocation(v.bit)
+		if addr != v.addr || mask != v.mask {
+			t.Errorf("bit 0x%02X resolved to 0x%02X/0x%02X, expected 0x%02X/0x%02X", v.bit, addr, mask, v.addr, v.mask)
+		}
+	}
+}
+
+func TestWriteBitRAM(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.WriteBit(0x0B, true)
+	if c.InternalRAM[0x21] != 0x08 {
+		t.Errorf("expected 0x08 at 0x21, got 0x%02X", c.InternalRAM[0x21])
+	}
+	if !c.ReadBit(0x0B) {
+		t.Error("bit 0x0B did not read back as set")
+	}
+	c.WriteBit(0x0B, false)
+	if c.InternalRAM[0x21] != 0 {
+		t.Errorf("expected 0x00 at 0x21, got 0x%02X", c.InternalRAM[0x21])
+	}
+}
+
+func TestWriteBitCoreRegisters(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.WriteBit(0xD7, true) //CY
+	if c.ProgStatus() != CarryBit {
+		t.Errorf("expected carry set in PSW, got 0x%02X", c.ProgStatus())
+	}
+	c.SetAccum(0x10)
+	if !c.ReadBit(0xE4) {
+		t.Error("ACC.4 did not read as set")
+	}
+}
+
+func TestWriteBitCallbacks(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	var port uint8 = 0xF0
+	c.ReadCallbacks[P1] = func() uint8 { return port }
+	c.WriteCallbacks[P1] = func(v uint8) { port = v }
+	c.WriteBit(0x90, true) //P1.0
+	if port != 0xF1 {
+		t.Errorf("expected P1 callback to receive 0xF1, got 0x%02X", port)
+	}
+	if !c.ReadBit(0x97) {
+		t.Error("P1.7 did not read through callback")
+	}
+	if c.SFR(P1) != 0 || c.InternalRAM[P1] != 0 {
+		t.Error("callback backed register leaked into backing store")
+	}
+}
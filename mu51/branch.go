@@ -0,0 +1,74 @@
+package mu51
+
+//jumpIf transfers control to target only when cond is true. Relative
+//branch targets are resolved against the following instruction when
+//decoded, wrapping around at the 64KiB boundary
+func (a *ALU) jumpIf(cond bool, target uint16) {
+	if cond {
+		a.ProgCount = target
+	}
+}
+
+//InstrSJMP executes a short jump to target
+func (a *ALU) InstrSJMP(target uint16) {
+	a.ProgCount = target
+}
+
+//InstrJMPIndexed executes JMP @A+DPTR, an indirect jump to the
+//sum of the accumulator and the data pointer
+func (a *ALU) InstrJMPIndexed() {
+	a.ProgCount = a.DataPtr() + uint16(a.Accum())
+}
+
+//InstrJZ branches when the accumulator is zero
+func (a *ALU) InstrJZ(target uint16) {
+	a.jumpIf(a.Accum() == 0, target)
+}
+
+//InstrJNZ branches when the accumulator is not zero
+func (a *ALU) InstrJNZ(target uint16) {
+	a.jumpIf(a.Accum() != 0, target)
+}
+
+//InstrJC branches when the carry flag is set
+func (a *ALU) InstrJC(target uint16) {
+	a.jumpIf(a.Carry(), target)
+}
+
+//InstrJNC branches when the carry flag is clear
+func (a *ALU) InstrJNC(target uint16) {
+	a.jumpIf(!a.Carry(), target)
+}
+
+//InstrCJNE sets the carry flag if x is less than y and then
+//branches if they differ, this is the core of all CJNE forms
+func (a *ALU) InstrCJNE(x, y uint8, target uint16) {
+	a.SetCarry(x < y)
+	a.jumpIf(x != y, target)
+}
+
+//InstrDJNZ decrements a register or directly addressed byte
+//and branches if the result is not zero
+func (c *CPU) InstrDJNZ(o Operand, target uint16) {
+	val := c.load(o) - 1
+	c.store(o, val)
+	c.jumpIf(val != 0, target)
+}
+
+//InstrJB branches when the addressed bit is set
+func (c *CPU) InstrJB(bit uint8, target uint16) {
+	c.jumpIf(c.ReadBit(bit), target)
+}
+
+//InstrJNB branches when the addressed bit is clear
+func (c *CPU) InstrJNB(bit uint8, target uint16) {
+	c.jumpIf(!c.ReadBit(bit), target)
+}
+
+//InstrJBC branches when the addressed bit is set, clearing it
+func (c *CPU) InstrJBC(bit uint8, target uint16) {
+	if c.ReadBit(bit) {
+		c.WriteBit(bit, false)
+		c.ProgCount = target
+	}
+}
@@ -0,0 +1,274 @@
+package mu51
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+//testROM is a flat code memory for hand assembled test programs
+type testROM []byte
+
+func (r testROM) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(r)) {
+		return 0, io.EOF
+	}
+	n := copy(b, r[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r testROM) Size() int64 {
+	return int64(len(r))
+}
+
+//newTestCPU builds a cpu with a full 64KiB code space
+//holding code at org and the program counter pointed at it
+func newTestCPU(org uint16, code ...byte) *CPU {
+	rom := make(testROM, 0x10000)
+	for i, v := range code {
+		rom[(int(org)+i)&0xFFFF] = v
+	}
+	c := &CPU{ALU: &ALU{}, ProgMem: rom}
+	c.ProgCount = org
+	c.SetStackPtr(0x07)
+	return c
+}
+
+type branchCase struct {
+	name  string
+	code  []byte
+	setup func(c *CPU)
+	pc    uint16 //expected program counter after the step
+	check func(c *CPU) bool
+}
+
+func runBranchCases(t *testing.T, cases []branchCase) {
+	for _, v := range cases {
+		c := newTestCPU(0x1000, v.code...)
+		if v.setup != nil {
+			v.setup(c)
+		}
+		if err := c.Step(); err != nil {
+			t.Errorf("%s: %s", v.name, err)
+			continue
+		}
+		if c.ProgCount != v.pc {
+			t.Errorf("%s: expected PC 0x%04X, got 0x%04X", v.name, v.pc, c.ProgCount)
+		}
+		if v.check != nil && !v.check(c) {
+			t.Errorf("%s: post condition failed", v.name)
+		}
+	}
+}
+
+func setCarry(c *CPU) {
+	c.SetProgStatus(c.ProgStatus() | CarryBit)
+}
+
+func carry(c *CPU) bool {
+	return c.ProgStatus()&CarryBit != 0
+}
+
+func TestBitBranches(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"JBC taken", []byte{0x10, 0x00, 0x10}, func(c *CPU) { c.InternalRAM[0x20] = 0x01 }, 0x1013,
+			func(c *CPU) bool { return c.InternalRAM[0x20] == 0 }},
+		{"JBC not taken", []byte{0x10, 0x00, 0x10}, nil, 0x1003, nil},
+		{"JBC SFR bit", []byte{0x10, 0xE7, 0xFD}, func(c *CPU) { c.SetAccum(0x80) }, 0x1000,
+			func(c *CPU) bool { return c.Accum() == 0 }},
+		{"JB taken", []byte{0x20, 0x08, 0xF0}, func(c *CPU) { c.InternalRAM[0x21] = 0x01 }, 0x0FF3,
+			func(c *CPU) bool { return c.InternalRAM[0x21] == 0x01 }},
+		{"JB not taken", []byte{0x20, 0x08, 0xF0}, nil, 0x1003, nil},
+		{"JNB taken", []byte{0x30, 0xD7, 0x05}, nil, 0x1008, nil},
+		{"JNB not taken", []byte{0x30, 0xD7, 0x05}, setCarry, 0x1003, nil},
+	})
+}
+
+func TestFlagBranches(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"JC taken", []byte{0x40, 0x7F}, setCarry, 0x1081, nil},
+		{"JC not taken", []byte{0x40, 0x7F}, nil, 0x1002, nil},
+		{"JNC taken", []byte{0x50, 0x80}, nil, 0x0F82, nil},
+		{"JNC not taken", []byte{0x50, 0x80}, setCarry, 0x1002, nil},
+		{"JZ taken", []byte{0x60, 0x02}, nil, 0x1004, nil},
+		{"JZ not taken", []byte{0x60, 0x02}, func(c *CPU) { c.SetAccum(1) }, 0x1002, nil},
+		{"JNZ taken", []byte{0x70, 0xFE}, func(c *CPU) { c.SetAccum(1) }, 0x1000, nil},
+		{"JNZ not taken", []byte{0x70, 0xFE}, nil, 0x1002, nil},
+	})
+}
+
+func TestJumps(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"JMP @A+DPTR", []byte{0x73}, func(c *CPU) {
+			c.SetAccum(0x10)
+			c.SetDataPtr(0x2000)
+		}, 0x2010, nil},
+		{"JMP @A+DPTR wraps", []byte{0x73}, func(c *CPU) {
+			c.SetAccum(0x20)
+			c.SetDataPtr(0xFFF0)
+		}, 0x0010, nil},
+		{"SJMP forward", []byte{0x80, 0x10}, nil, 0x1012, nil},
+		{"SJMP backward", []byte{0x80, 0xFE}, nil, 0x1000, nil},
+	})
+}
+
+func TestBranchWraparound(t *testing.T) {
+	c := newTestCPU(0xFFFE, 0x80, 0x04)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0x0004 {
+		t.Errorf("forward wrap expected 0x0004, got 0x%04X", c.ProgCount)
+	}
+	c = newTestCPU(0x0001, 0x80, 0xFC)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0xFFFF {
+		t.Errorf("backward wrap expected 0xFFFF, got 0x%04X", c.ProgCount)
+	}
+}
+
+func TestCJNE(t *testing.T) {
+	cases := []branchCase{
+		{"CJNE A,#data less", []byte{0xB4, 0x20, 0x10}, func(c *CPU) { c.SetAccum(0x10) }, 0x1013, carry},
+		{"CJNE A,#data greater", []byte{0xB4, 0x20, 0x10}, func(c *CPU) {
+			c.SetAccum(0x30)
+			setCarry(c)
+		}, 0x1013, func(c *CPU) bool { return !carry(c) }},
+		{"CJNE A,#data equal", []byte{0xB4, 0x20, 0x10}, func(c *CPU) {
+			c.SetAccum(0x20)
+			setCarry(c)
+		}, 0x1003, func(c *CPU) bool { return !carry(c) }},
+		{"CJNE A,direct less", []byte{0xB5, 0x30, 0xF0}, func(c *CPU) { c.InternalRAM[0x30] = 0x01 }, 0x0FF3, carry},
+		{"CJNE A,direct equal", []byte{0xB5, 0xF0, 0xF0}, func(c *CPU) {
+			c.SetAccum(0x42)
+			c.SetBReg(0x42)
+		}, 0x1003, func(c *CPU) bool { return !carry(c) }},
+	}
+	for i := uint8(0); i < 2; i++ {
+		r := i
+		cases = append(cases,
+			branchCase{"CJNE @Ri,#data less", []byte{0xB6 + r, 0x90, 0x08}, func(c *CPU) {
+				c.SetReg(r, 0x90)
+				c.InternalRAM[0x90] = 0x80
+				c.SetSFR(0x90, 0xFF)
+			}, 0x100B, carry},
+			branchCase{"CJNE @Ri,#data equal", []byte{0xB6 + r, 0x80, 0x08}, func(c *CPU) {
+				c.SetReg(r, 0x90)
+				c.InternalRAM[0x90] = 0x80
+			}, 0x1003, nil},
+		)
+	}
+	for i := uint8(0); i < 8; i++ {
+		r := i
+		cases = append(cases,
+			branchCase{"CJNE Rn,#data less", []byte{0xB8 + r, 0x05, 0x04}, func(c *CPU) {
+				c.SetProgStatus(RS0Bit)
+				c.SetReg(r, 0x04)
+			}, 0x1007, func(c *CPU) bool { return carry(c) && c.InternalRAM[0x08+r] == 0x04 }},
+			branchCase{"CJNE Rn,#data equal", []byte{0xB8 + r, 0x05, 0x04}, func(c *CPU) { c.SetReg(r, 0x05) }, 0x1003, nil},
+		)
+	}
+	runBranchCases(t, cases)
+}
+
+func TestDJNZ(t *testing.T) {
+	cases := []branchCase{
+		{"DJNZ direct taken", []byte{0xD5, 0x40, 0xFD}, func(c *CPU) { c.InternalRAM[0x40] = 2 }, 0x1000,
+			func(c *CPU) bool { return c.InternalRAM[0x40] == 1 }},
+		{"DJNZ direct not taken", []byte{0xD5, 0x40, 0xFD}, func(c *CPU) { c.InternalRAM[0x40] = 1 }, 0x1003,
+			func(c *CPU) bool { return c.InternalRAM[0x40] == 0 }},
+		{"DJNZ direct wraps", []byte{0xD5, 0xF0, 0xFD}, nil, 0x1000,
+			func(c *CPU) bool { return c.BReg() == 0xFF }},
+	}
+	for i := uint8(0); i < 8; i++ {
+		r := i
+		cases = append(cases,
+			branchCase{"DJNZ Rn taken", []byte{0xD8 + r, 0xFE}, func(c *CPU) {
+				c.SetProgStatus(RS1Bit)
+				c.SetReg(r, 3)
+			}, 0x1000, func(c *CPU) bool { return c.InternalRAM[0x10+r] == 2 }},
+			branchCase{"DJNZ Rn not taken", []byte{0xD8 + r, 0xFE}, func(c *CPU) { c.SetReg(r, 1) }, 0x1002,
+				func(c *CPU) bool { return c.Reg(r) == 0 }},
+		)
+	}
+	runBranchCases(t, cases)
+}
+
+func TestCallReturn(t *testing.T) {
+	c := newTestCPU(0x07FE, 0x31, 0x23) //ACALL into the next page
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0x0923 {
+		t.Errorf("ACALL expected PC 0x0923, got 0x%04X", c.ProgCount)
+	}
+	if c.StackPtr() != 0x09 || c.InternalRAM[0x08] != 0x00 || c.InternalRAM[0x09] != 0x08 {
+		t.Error("ACALL pushed wrong return address")
+	}
+	c.ProgMem.(testROM)[0x0923] = 0x22 //RET
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0x0800 || c.StackPtr() != 0x07 {
+		t.Errorf("RET expected PC 0x0800, got 0x%04X", c.ProgCount)
+	}
+}
+
+//pushed reports whether the stack holds ret as the last pushed
+//word with the stack pointer left at sp
+func pushed(c *CPU, sp uint8, ret uint16) bool {
+	return c.StackPtr() == sp && c.InternalRAM[sp-1] == uint8(ret) && c.InternalRAM[sp] == uint8(ret>>8)
+}
+
+func TestAbsoluteJumps(t *testing.T) {
+	var cases []branchCase
+	for i := uint16(0); i < 8; i++ {
+		page := i
+		op := uint8(page<<5) | 0x01
+		cases = append(cases,
+			branchCase{fmt.Sprintf("AJMP 0x%02X", op), []byte{op, 0x34}, nil, 0x1034 | page<<8,
+				func(c *CPU) bool { return c.StackPtr() == 0x07 }},
+		)
+	}
+	//the page is taken from the following instruction
+	cases = append(cases, branchCase{"AJMP page crossing", []byte{0x21, 0x00}, func(c *CPU) {
+		c.ProgMem.(testROM)[0x17FE] = 0x21
+		c.ProgMem.(testROM)[0x17FF] = 0x00
+		c.ProgCount = 0x17FE
+	}, 0x1900, nil})
+	runBranchCases(t, cases)
+}
+
+func TestCalls(t *testing.T) {
+	var cases []branchCase
+	for i := uint16(0); i < 8; i++ {
+		page := i
+		op := uint8(page<<5) | 0x11
+		cases = append(cases,
+			branchCase{fmt.Sprintf("ACALL 0x%02X", op), []byte{op, 0x34}, nil, 0x1034 | page<<8,
+				func(c *CPU) bool { return pushed(c, 0x09, 0x1002) }},
+		)
+	}
+	cases = append(cases,
+		branchCase{"LCALL", []byte{0x12, 0xAB, 0xCD}, nil, 0xABCD,
+			func(c *CPU) bool { return pushed(c, 0x09, 0x1003) }},
+		branchCase{"LCALL moved stack", []byte{0x12, 0x00, 0x40}, func(c *CPU) { c.SetStackPtr(0x30) }, 0x0040,
+			func(c *CPU) bool { return pushed(c, 0x32, 0x1003) }},
+		branchCase{"RET", []byte{0x22}, func(c *CPU) { c.PushWord(0x2345) }, 0x2345,
+			func(c *CPU) bool { return c.StackPtr() == 0x07 }},
+		branchCase{"RETI nested", []byte{0x32}, func(c *CPU) {
+			c.PushWord(0x2345)
+			c.inService = 3
+		}, 0x2345, func(c *CPU) bool { return c.StackPtr() == 0x07 && c.InServiceLevel() == 0 }},
+		branchCase{"RETI", []byte{0x32}, func(c *CPU) {
+			c.PushWord(0x0123)
+			c.inService = 1
+		}, 0x0123, func(c *CPU) bool { return c.StackPtr() == 0x07 && c.InServiceLevel() == -1 }},
+	)
+	runBranchCases(t, cases)
+}
@@ -0,0 +1,270 @@
+package mu51
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+//ErrUnmapped is returned when the bus is accessed at an address
+//no region covers
+var ErrUnmapped = errors.New("address not mapped")
+
+//ErrReadOnly is returned when the bus is written within a read only region
+var ErrReadOnly = errors.New("address is read only")
+
+//Peeker is implemented by memory whose reads may have side effects,
+//PeekAt reads it without them for debuggers and tracers
+type Peeker interface {
+	PeekAt(p []byte, off int64) (int, error)
+}
+
+//Region maps a device into a window of a bus. Offsets within the window
+//are passed to the device from zero. A banked region holds several
+//devices and Select chooses which one the window currently shows
+type Region struct {
+	Base     uint16
+	Size     int        //bytes of the address space covered
+	Device   CodeMemory //the device shown, a RAM unless ReadOnly
+	ReadOnly bool       //writes fail with ErrReadOnly
+
+	Banks  []CodeMemory //devices of a banked region, replacing Device
+	Select func() int   //returns the bank shown, usually from an SFR
+}
+
+//device returns the device currently shown through the region
+func (r *Region) device() CodeMemory {
+	if r.Banks == nil {
+		return r.Device
+	}
+	n := 0
+	if r.Select != nil {
+		n = r.Select()
+	}
+	if n < 0 || n >= len(r.Banks) {
+		return nil
+	}
+	return r.Banks[n]
+}
+
+//contains reports whether the region covers addr
+func (r *Region) contains(addr int64) bool {
+	return addr >= int64(r.Base) && addr < int64(r.Base)+int64(r.Size)
+}
+
+//Bus is a 64KiB address space composed of regions of rom, ram, banked
+//memory and memory mapped registers. It satisfies both CodeMemory and
+//RAM so may serve as ProgMem, as ExtRAM or, mapping the same devices
+//into both, as a shared von Neumann space. Regions mapped later take
+//precedence where they overlap
+type Bus struct {
+	Regions []*Region
+}
+
+//Map adds a region to the bus
+func (b *Bus) Map(r *Region) {
+	b.Regions = append(b.Regions, r)
+}
+
+//MapROM maps a read only device at base
+func (b *Bus) MapROM(base uint16, m CodeMemory) {
+	b.Map(&Region{Base: base, Size: int(m.Size()), Device: m, ReadOnly: true})
+}
+
+//MapRAM maps a writable device at base
+func (b *Bus) MapRAM(base uint16, m RAM) {
+	b.Map(&Region{Base: base, Size: int(m.Size()), Device: m})
+}
+
+//MapBanked maps size bytes at base onto one of banks, chosen by select
+func (b *Bus) MapBanked(base uint16, size int, banks []CodeMemory, sel func() int, readOnly bool) {
+	b.Map(&Region{Base: base, Size: size, Banks: banks, Select: sel, ReadOnly: readOnly})
+}
+
+//MapIO maps size bytes of memory mapped registers at base
+func (b *Bus) MapIO(base uint16, size int, regs *MMIO) {
+	b.Map(&Region{Base: base, Size: size, Device: regs})
+}
+
+//Lookup returns the region covering addr, or nil when unmapped
+func (b *Bus) Lookup(addr uint16) *Region {
+	for i := len(b.Regions) - 1; i >= 0; i-- {
+		if b.Regions[i].contains(int64(addr)) {
+			return b.Regions[i]
+		}
+	}
+	return nil
+}
+
+//ReadAt reads from the regions covering each address in turn
+func (b *Bus) ReadAt(p []byte, off int64) (int, error) {
+	return b.read(p, off, false)
+}
+
+//PeekAt reads like ReadAt but without side effects, devices which are
+//Peekers such as memory mapped registers are peeked rather than read
+func (b *Bus) PeekAt(p []byte, off int64) (int, error) {
+	return b.read(p, off, true)
+}
+
+//read reads from the regions covering each address in turn, peeking
+//devices which support it when peek is set
+func (b *Bus) read(p []byte, off int64, peek bool) (int, error) {
+	for n := range p {
+		addr := off + int64(n)
+		if addr >= 0x10000 {
+			return n, io.EOF
+		}
+		r := b.Lookup(uint16(addr))
+		if r == nil {
+			return n, ErrUnmapped
+		}
+		d := r.device()
+		if d == nil {
+			return n, ErrUnmapped
+		}
+		read := d.ReadAt
+		if pk, ok := d.(Peeker); ok && peek {
+			read = pk.PeekAt
+		}
+		if _, err := read(p[n:n+1], addr-int64(r.Base)); err != nil {
+			return n, err
+		}
+	}
+	return len(p), nil
+}
+
+//WriteAt writes to the regions covering each address in turn
+func (b *Bus) WriteAt(p []byte, off int64) (int, error) {
+	for n := range p {
+		addr := off + int64(n)
+		if addr >= 0x10000 {
+			return n, io.EOF
+		}
+		r := b.Lookup(uint16(addr))
+		if r == nil {
+			return n, ErrUnmapped
+		}
+		if r.ReadOnly {
+			return n, ErrReadOnly
+		}
+		d, ok := r.device().(RAM)
+		if !ok {
+			return n, ErrReadOnly
+		}
+		if _, err := d.WriteAt(p[n:n+1], addr-int64(r.Base)); err != nil {
+			return n, err
+		}
+	}
+	return len(p), nil
+}
+
+//Size returns the full 64KiB of the address space
+func (b *Bus) Size() int64 {
+	return 0x10000
+}
+
+//Randomize fills the ram mapped on the bus with values read from r, as
+//at power on. Read only regions and memory mapped registers are left
+//alone so no device sees a write
+func (b *Bus) Randomize(r io.Reader) error {
+	for _, reg := range b.Regions {
+		if reg.ReadOnly {
+			continue
+		}
+		devices := reg.Banks
+		if devices == nil {
+			devices = []CodeMemory{reg.Device}
+		}
+		for _, d := range devices {
+			m, ok := d.(RAM)
+			if _, isIO := d.(*MMIO); isIO || !ok {
+				continue
+			}
+			buf := make([]byte, m.Size())
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return err
+			}
+			if _, err := m.WriteAt(buf, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//MMIO is a block of memory mapped registers, each access is passed
+//to Read or Write with the offset of the register within the block.
+//Debuggers and tracers look at the registers through Peek, which must
+//not change the state of the device
+type MMIO struct {
+	Read  func(offset uint16) uint8
+	Write func(offset uint16, val uint8)
+	Peek  func(offset uint16) uint8
+	Len   int
+}
+
+//ReadAt reads registers through Read, those without one read as 0xFF
+func (m *MMIO) ReadAt(p []byte, off int64) (int, error) {
+	for n := range p {
+		p[n] = 0xFF
+		if m.Read != nil {
+			p[n] = m.Read(uint16(off) + uint16(n))
+		}
+	}
+	return len(p), nil
+}
+
+//PeekAt reads registers through Peek, never calling Read, those
+//without one read as 0xFF
+func (m *MMIO) PeekAt(p []byte, off int64) (int, error) {
+	for n := range p {
+		p[n] = 0xFF
+		if m.Peek != nil {
+			p[n] = m.Peek(uint16(off) + uint16(n))
+		}
+	}
+	return len(p), nil
+}
+
+//WriteAt writes registers through Write, writes without one are lost
+func (m *MMIO) WriteAt(p []byte, off int64) (int, error) {
+	for n, v := range p {
+		if m.Write != nil {
+			m.Write(uint16(off)+uint16(n), v)
+		}
+	}
+	return len(p), nil
+}
+
+//Size returns the length of the register block
+func (m *MMIO) Size() int64 {
+	return int64(m.Len)
+}
+
+//SFRSelect returns a bank selector reading the field of the special
+//function register addr picked out by mask, such as a bank register
+//or the latch of the port pins driving the upper address lines
+func (c *CPU) SFRSelect(addr uint8, mask uint8) func() int {
+	shift := uint(bits.TrailingZeros8(mask))
+	return func() int {
+		return int(c.SFR(addr)&mask) >> shift
+	}
+}
+
+//SplitBanks divides a flat image, such as a banked hex file loaded at
+//linear addresses, into banks of size bytes
+func SplitBanks(image []byte, size int) []CodeMemory {
+	var banks []CodeMemory
+	for len(image) > 0 {
+		n := size
+		if n > len(image) {
+			n = len(image)
+		}
+		bank := make(Memory, size)
+		copy(bank, image[:n])
+		banks = append(banks, bank)
+		image = image[n:]
+	}
+	return banks
+}
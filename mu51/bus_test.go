@@ -0,0 +1,85 @@
+package mu51
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBankedCode(t *testing.T) {
+	common := make(Memory, 0x8000)
+	copy(common, []byte{
+		0x75, 0x90, 0x01, //MOV P1,#01h
+		0x02, 0x80, 0x00, //LJMP 8000h
+	})
+	image := make([]byte, 0x10000)
+	image[0x0000] = 0x74 //bank 0: MOV A,#00h
+	image[0x8000] = 0x74 //bank 1: MOV A,#11h
+	image[0x8001] = 0x11
+
+	code := &Bus{}
+	c := NewCPU(code, nil)
+	code.MapROM(0x0000, common)
+	code.MapBanked(0x8000, 0x8000, SplitBanks(image, 0x8000), c.SFRSelect(P1, 0x03), true)
+	for i := 0; i < 3; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Accum() != 0x11 {
+		t.Errorf("executed the wrong bank, A=0x%02X", c.Accum())
+	}
+
+	c.SetSFR(P1, 0x03)
+	if _, err := code.ReadAt(make([]byte, 1), 0x8000); err != ErrUnmapped {
+		t.Errorf("missing bank read gave %v", err)
+	}
+	if _, err := code.WriteAt([]byte{0}, 0x0000); err != ErrReadOnly {
+		t.Errorf("rom write gave %v", err)
+	}
+}
+
+func TestMappedXDATA(t *testing.T) {
+	var written []byte
+	xdata := &Bus{}
+	xdata.MapRAM(0x0000, make(Memory, 0x800))
+	xdata.MapIO(0xF000, 0x10, &MMIO{
+		Len:   0x10,
+		Read:  func(off uint16) uint8 { return 0xA0 + uint8(off) },
+		Write: func(off uint16, val uint8) { written = append(written, uint8(off), val) },
+	})
+	c := NewCPU(Memory{
+		0x90, 0xF0, 0x03, //MOV DPTR,#F003h
+		0xE0,             //MOVX A,@DPTR
+		0x90, 0x01, 0x00, //MOV DPTR,#0100h
+		0xF0,             //MOVX @DPTR,A
+		0x90, 0xF0, 0x05, //MOV DPTR,#F005h
+		0xF0,             //MOVX @DPTR,A
+		0x90, 0x90, 0x00, //MOV DPTR,#9000h
+		0xF0, //MOVX @DPTR,A
+	}, xdata)
+	for i := 0; i < 6; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Accum() != 0xA3 || len(written) != 2 || written[0] != 5 || written[1] != 0xA3 {
+		t.Errorf("mmio access A=0x%02X writes %v", c.Accum(), written)
+	}
+	b := make([]byte, 1)
+	xdata.ReadAt(b, 0x0100)
+	if b[0] != 0xA3 {
+		t.Error("ram region not written")
+	}
+	c.Step()
+	if err := c.Step(); !errors.Is(err, ErrUnmapped) {
+		t.Errorf("unmapped MOVX gave %v", err)
+	}
+
+	//registers without a Peek read as 0xFF when peeked
+	if _, err := xdata.PeekAt(b, 0xF003); err != nil || b[0] != 0xFF {
+		t.Errorf("peek of a register gave 0x%02X, %v", b[0], err)
+	}
+	if _, err := xdata.PeekAt(b, 0x0100); err != nil || b[0] != 0xA3 {
+		t.Errorf("peek of ram gave 0x%02X, %v", b[0], err)
+	}
+}
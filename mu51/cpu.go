@@ -1,5 +1,9 @@
 package mu51
 
+import (
+	"log"
+)
+
 //RAM is a random access interface nessecary to act as
 //backing ram for the CPU
 type RAM interface {
@@ -41,32 +45,162 @@ const (
 	CarryBit
 )
 
-//ALU is the data set for an 8051 core, the main registers R0-R1
-//are contained within InternalRAM while the other special registers
-//are tracked seperately
+//ALU is the data set for an 8051 core. InternalRAM holds the
+//register banks and is the memory reached through indirect
+//addressing and the stack, its upper half shadows the special
+//function registers and is only reachable indirectly. The special
+//function registers, including the core registers such as the
+//accumulator and stack pointer, live in SpecialRegs and are only
+//reachable with direct addressing
 type ALU struct {
-	InternalRAM [256]byte //internal IRAM (is also the registers)
+	InternalRAM [256]byte     //internal IRAM (is also the registers)
+	SpecialRegs [128]byte     //special function registers (0x80-0xFF)
+	ProgCount   uint16        //the program counter
+	IRAMSize    int           //bytes of internal ram, 0 for the full 256
+	DPTRs       *DataPointers //extra data pointers, nil for a single DPTR
+
+	//OnAccess, when set, is called for every memory access made by an
+	//instruction or by interrupt vectoring. Registers the core uses
+	//implicitly, such as the accumulator in ADD, are not reported
+	OnAccess func(Access)
+}
+
+//SFR returns the raw value held in the special function register at
+//the direct address addr, no side effects or callbacks are triggered
+func (a *ALU) SFR(addr uint8) uint8 {
+	return a.SpecialRegs[addr&0x7F]
+}
+
+//SetSFR stores a raw value into the special function register at the
+//direct address addr, no side effects or callbacks are triggered
+func (a *ALU) SetSFR(addr uint8, val uint8) {
+	a.SpecialRegs[addr&0x7F] = val
+}
+
+//StackPtr returns the stack pointer (0x81)
+func (a *ALU) StackPtr() uint8 {
+	return a.SFR(SP)
+}
+
+//SetStackPtr sets the stack pointer (0x81)
+func (a *ALU) SetStackPtr(val uint8) {
+	a.SetSFR(SP, val)
+}
+
+//DataPtr returns the 16 bit data pointer register (0x82-0x83),
+//or on parts with several the one currently selected
+func (a *ALU) DataPtr() uint16 {
+	lo, hi := a.dptrRegs()
+	return uint16(a.SFR(hi))<<8 | uint16(a.SFR(lo))
+}
+
+//SetDataPtr sets the 16 bit data pointer register (0x82-0x83),
+//or on parts with several the one currently selected
+func (a *ALU) SetDataPtr(val uint16) {
+	lo, hi := a.dptrRegs()
+	a.SetSFR(lo, uint8(val))
+	a.SetSFR(hi, uint8(val>>8))
+}
+
+//ProgStatus returns the program status word (0xD0), the parity
+//bit always reflects the current contents of the accumulator
+func (a *ALU) ProgStatus() uint8 {
+	ps := a.SFR(PSW) &^ ParityBit
+	if parity(a.Accum()) {
+		ps = ps | ParityBit
+	}
+	return ps
+}
+
+//SetProgStatus sets the program status word (0xD0), the parity
+//bit is read only and will continue to track the accumulator
+func (a *ALU) SetProgStatus(val uint8) {
+	a.SetSFR(PSW, val)
+}
+
+//Accum returns the accumulator (0xE0)
+func (a *ALU) Accum() uint8 {
+	return a.SFR(ACC)
+}
+
+//SetAccum sets the accumulator (0xE0)
+func (a *ALU) SetAccum(val uint8) {
+	a.SetSFR(ACC, val)
+}
 
-	StackPtr   byte   //Stack Pointer (0x81)
-	DataPtr    uint16 //16 bit data pointer register (0x82-0x83)
-	ProgStatus byte   //Program status word (0xD0)
-	Accum      byte   //accumulator (0xE0)
-	BReg       byte   //B register (0xF0)
-	ProgCount  uint16 //the program counter
+//BReg returns the B register (0xF0)
+func (a *ALU) BReg() uint8 {
+	return a.SFR(B)
+}
+
+//SetBReg sets the B register (0xF0)
+func (a *ALU) SetBReg(val uint8) {
+	a.SetSFR(B, val)
+}
+
+//Reg returns the value of register Rn in the active register bank
+func (a *ALU) Reg(r uint8) uint8 {
+	addr := a.regAddr(r)
+	a.access(SpaceIRAM, uint16(addr), false, a.InternalRAM[addr])
+	return a.InternalRAM[addr]
+}
+
+//SetReg sets register Rn in the active register bank
+func (a *ALU) SetReg(r uint8, val uint8) {
+	addr := a.regAddr(r)
+	a.InternalRAM[addr] = val
+	a.access(SpaceIRAM, uint16(addr), true, val)
+}
+
+//ReadIndirect reads internal ram as addressed through @Ri or
+//the stack, the full 256 bytes are reachable and never alias
+//the special function registers. Parts with only 128 bytes read
+//0xFF from the missing upper half
+func (a *ALU) ReadIndirect(addr uint8) uint8 {
+	val := uint8(0xFF)
+	if a.hasIRAM(addr) {
+		val = a.InternalRAM[addr]
+	}
+	a.access(SpaceIRAM, uint16(addr), false, val)
+	return val
+}
+
+//WriteIndirect writes internal ram as addressed through @Ri
+//or the stack, writes to missing upper ram are lost
+func (a *ALU) WriteIndirect(addr uint8, val uint8) {
+	if a.hasIRAM(addr) {
+		a.InternalRAM[addr] = val
+	}
+	a.access(SpaceIRAM, uint16(addr), true, val)
+}
+
+//hasIRAM reports whether internal ram exists at addr
+func (a *ALU) hasIRAM(addr uint8) bool {
+	return a.IRAMSize == 0 || int(addr) < a.IRAMSize
+}
+
+//parity returns true when val has an odd number of bits set
+func parity(val uint8) bool {
+	val ^= val >> 4
+	val ^= val >> 2
+	val ^= val >> 1
+	return val&0x01 != 0
 }
 
 //PushByte pushes a single byte on the stack
 //maintaining increment ordering
 func (a *ALU) PushByte(byte uint8) {
-	a.StackPtr++
-	a.InternalRAM[a.StackPtr] = byte
+	sp := a.StackPtr() + 1
+	a.WriteIndirect(sp, byte)
+	a.SetStackPtr(sp)
 }
 
 //PopByte removes a single byte from the stack
 //maintaining decrement ordering
 func (a *ALU) PopByte() byte {
-	b := a.InternalRAM[a.StackPtr]
-	a.StackPtr--
+	sp := a.StackPtr()
+	b := a.ReadIndirect(sp)
+	a.SetStackPtr(sp - 1)
 	return b
 }
 
@@ -74,34 +208,38 @@ func (a *ALU) PopByte() byte {
 //on the stack, maintaining both byte and
 //increment ordering
 func (a *ALU) PushWord(word uint16) {
-	a.InternalRAM[a.StackPtr+1] = uint8(word)
-	a.InternalRAM[a.StackPtr+2] = uint8(word >> 8)
-	a.StackPtr += 2
+	sp := a.StackPtr()
+	a.WriteIndirect(sp+1, uint8(word))
+	a.WriteIndirect(sp+2, uint8(word>>8))
+	a.SetStackPtr(sp + 2)
 }
 
 //PopWord is a helper function to remove a 16bit
 //word from the stack, maintaining both byte and
 //decrement ordering
 func (a *ALU) PopWord() uint16 {
-	ret := uint16(a.InternalRAM[a.StackPtr]) << 8
-	ret = ret | uint16(a.InternalRAM[a.StackPtr-1])
-	a.StackPtr -= 2
+	sp := a.StackPtr()
+	ret := uint16(a.ReadIndirect(sp)) << 8
+	ret = ret | uint16(a.ReadIndirect(sp-1))
+	a.SetStackPtr(sp - 2)
 	return ret
 }
 
 //InstrACALL exectues an absolute call within the same
 //2KiB page as the following instruction, rel specifies
-//the absolute address within that page
+//the absolute address within that page. Like all of the
+//control flow instructions the program counter is expected
+//to already point at the following instruction
 func (a *ALU) InstrACALL(rel uint16) {
-	a.PushWord(a.ProgCount + 2)
-	a.ProgCount = (a.ProgCount+2)&0xF800 + rel&0x7FF
+	a.PushWord(a.ProgCount)
+	a.ProgCount = a.ProgCount&0xF800 + rel&0x7FF
 }
 
 //InstrAJMP executes an absolute jump within the same
 //2KiB page as the following instruction, rel specifies
 //the absolute address within that page
 func (a *ALU) InstrAJMP(rel uint16) {
-	a.ProgCount = (a.ProgCount+2)&0xF800 + rel&0x07FF
+	a.ProgCount = a.ProgCount&0xF800 + rel&0x07FF
 }
 
 //InstrRET exectutes a return by restoring the
@@ -110,29 +248,9 @@ func (a *ALU) InstrRET() {
 	a.ProgCount = a.PopWord()
 }
 
-//InstrRETI executes a return from interrupt
-//it acts like a RET instruction but also restores
-//lower priority interrupts
-func (a *ALU) InstrRETI() {
-	//no interrupts right now
-	a.ProgCount = a.PopWord()
-}
-
-//InstrPUSH pushes a byte onto the stack located
-//at the specified internal ram location
-func (a *ALU) InstrPUSH(loc uint8) {
-	a.PushByte(a.InternalRAM[loc])
-}
-
-//InstrPOP pops a byte off the stack and places it in
-//the specified internal ram location
-func (a *ALU) InstrPOP(loc uint8) {
-	a.InternalRAM[loc] = a.PopByte()
-}
-
 //InstrSWAP executes a nibble swap in the accumulator
 func (a *ALU) InstrSWAP() {
-	a.Accum = (a.Accum >> 4) & (a.Accum << 4)
+	a.SetAccum(a.Accum()>>4 | a.Accum()<<4)
 }
 
 //InstrMUL executes a multiply instruction
@@ -141,58 +259,30 @@ func (a *ALU) InstrSWAP() {
 //is cleared and the overflow bit is set if the
 //result is larger than 255
 func (a *ALU) InstrMUL() {
-	var res = uint16(a.Accum) * uint16(a.BReg)
-	a.BReg = uint8(res >> 16)
-	a.Accum = uint8(res)
-	a.ProgStatus = a.ProgStatus &^ CarryBit
+	var res = uint16(a.Accum()) * uint16(a.BReg())
+	a.SetBReg(uint8(res >> 8))
+	a.SetAccum(uint8(res))
+	ps := a.ProgStatus() &^ CarryBit
 	if res > 255 {
-		a.ProgStatus = a.ProgStatus | OverFlowBit
+		ps = ps | OverFlowBit
 	} else {
-		a.ProgStatus = a.ProgStatus &^ OverFlowBit
+		ps = ps &^ OverFlowBit
 	}
+	a.SetProgStatus(ps)
 }
 
 //retrieves the current indirect address
 //of a register by index, takes into account
 //program status word
 func (a *ALU) regAddr(r uint8) uint8 {
-	return ((a.ProgStatus >> 3) & 0x03) * 8
-}
-
-//InstrXCHInd executes and exchange between
-//the accumulator and an address specified with
-//indirect addressing. Setting R1 will use the R1
-//register for the address, else it will look to R0
-func (a *ALU) InstrXCHInd(R1 bool) {
-	var regLoc uint8
-	var loc uint8
-	if R1 {
-		regLoc = a.regAddr(1)
-	} else {
-		regLoc = a.regAddr(0)
-	}
-	loc = a.InternalRAM[regLoc]
-	a.Accum, a.InternalRAM[loc] = a.InternalRAM[loc], a.Accum
-}
-
-//InstrXCHDir exectutes an exchange with direct addressing
-//swaps the accumulator with the specified register
-func (a *ALU) InstrXCHDir(reg uint8) {
-	var loc = a.regAddr(reg)
-	a.Accum, a.InternalRAM[loc] = a.InternalRAM[loc], a.Accum
-}
-
-//InstrXCHImmed performs an exchange between the
-//accumulator and the specified address in internal ram
-func (a *ALU) InstrXCHImmed(loc uint8) {
-	a.Accum, a.InternalRAM[loc] = a.InternalRAM[loc], a.Accum
+	return ((a.ProgStatus()>>3)&0x03)*8 + r&0x07
 }
 
 //InstrLCALL executes a long call
 //pushes location of next instruction on the stack
 //then sets program counter to specified address
 func (a *ALU) InstrLCALL(addr uint16) {
-	a.PushWord(a.ProgCount + 3)
+	a.PushWord(a.ProgCount)
 	a.ProgCount = addr
 }
 
@@ -202,56 +292,37 @@ func (a *ALU) InstrLJMP(addr uint16) {
 	a.ProgCount = addr
 }
 
-func (a *ALU) InstrADDLit(literal uint8) {
-
-}
-
-func (a *ALU) InstrADDImmed(addr uint8) {
-	var val = a.InternalRAM[addr]
-}
-
-func (a *ALU) InstrADDInd(R1 bool) {
-	var addr uint8
-	//lookup the current memory location
-	//of R0 or R1
-	if R1 {
-		addr = a.regAddr(1)
-	} else {
-		addr = a.regAddr(0)
+//add performs the addition shared by ADD and ADDC, setting
+//the carry, auxiliary carry and overflow flags from the result
+func (a *ALU) add(val uint8, withCarry bool) {
+	var acc = a.Accum()
+	var cy uint8
+	if withCarry && a.ProgStatus()&CarryBit != 0 {
+		cy = 1
 	}
-	//use the value at that address as an
-	//address
-	var val = a.InternalRAM[a.InternalRAM[addr]]
-}
-
-func (a *ALU) InstrADDDir(reg uint8) {
-	var val = a.InternalRAM[a.regAddr(reg)]
-}
-
-func (a *ALU) InstrADDCLit(literal uint8) {
-
-}
-
-func (a *ALU) InstrADDCImmed(addr uint8) {
-	var val = a.InternalRAM[addr]
+	var res = uint16(acc) + uint16(val) + uint16(cy)
+	ps := a.ProgStatus() &^ (CarryBit | AuxCarryBit | OverFlowBit)
+	if res > 0xFF {
+		ps = ps | CarryBit
+	}
+	if acc&0x0F+val&0x0F+cy > 0x0F {
+		ps = ps | AuxCarryBit
+	}
+	if (acc^uint8(res))&(val^uint8(res))&0x80 != 0 {
+		ps = ps | OverFlowBit
+	}
+	a.SetAccum(uint8(res))
+	a.SetProgStatus(ps)
 }
 
-func (a *ALU) InstrADDCInd(R1 bool) {
-	var addr uint8
-	//lookup the current memory location
-	//of R0 or R1
-	if R1 {
-		addr = a.regAddr(1)
-	} else {
-		addr = a.regAddr(0)
-	}
-	//use the value at that address as an
-	//address
-	var val = a.InternalRAM[a.InternalRAM[addr]]
+//InstrADD adds val to the accumulator
+func (a *ALU) InstrADD(val uint8) {
+	a.add(val, false)
 }
 
-func (a *ALU) InstrADDCDir(reg uint8) {
-	var val = a.InternalRAM[a.regAddr(reg)]
+//InstrADDC adds val and the carry to the accumulator
+func (a *ALU) InstrADDC(val uint8) {
+	a.add(val, true)
 }
 
 //CPU is a structure representing a complete 8051 CPU, including
@@ -267,4 +338,110 @@ type CPU struct {
 	WriteCallbacks [256]func(uint8)
 	ExtRAM         RAM
 	ProgMem        CodeMemory
+	Peripherals    []Peripheral //clocked every machine cycle
+
+	Cycles         uint64  //machine cycles executed
+	ClocksPerCycle int     //oscillator clocks per machine cycle, 0 for the classic 12
+	OscillatorHz   float64 //oscillator frequency, 0 for DefaultOscillatorHz
+
+	Power             PowerStats
+	WakeFromPowerDown bool //an external interrupt ends power down mode
+
+	ResetValues     ResetTable //SFR values after reset, nil for Reset8051
+	RandomizeMemory bool       //power on fills ram with random values
+	RandomSeed      int64      //seed for RandomizeMemory
+
+	Profile *Profile //the derivative emulated, nil for a plain 8051
+
+	FaultPolicies map[FaultKind]FaultPolicy //response to each fault, FaultHalt when absent
+	OnFault       func(*Fault) error        //called under FaultCallback
+	FaultLog      *log.Logger               //written under FaultLog, nil for the standard logger
+
+	//StackFloor and StackCeiling bound the internal ram the stack may
+	//use, keeping it clear of the register banks and bit area. A zero
+	//floor allows the whole of ram and a zero ceiling its top
+	StackFloor   uint8
+	StackCeiling uint8
+
+	Observer Observer //notified around every instruction executed and interrupt taken
+
+	inService uint8 //interrupt levels in progress, bit 0 low and bit 1 high
+	holdoff   bool  //the last instruction was RETI or wrote IE or IP
+	latchRead bool  //a read-modify-write instruction is executing
+
+	idling      bool //cycles are being spent in idle mode
+	poweredDown bool //power down mode has been counted in Power
+}
+
+//Step fetches the instruction at the program counter, advances
+//the program counter past it and then executes it. When an enabled
+//interrupt is pending the step instead vectors to its handler. In
+//idle mode a step is a single machine cycle of the peripherals alone
+func (c *CPU) Step() error {
+	switch c.PowerState() {
+	case PowerDown:
+		if !c.poweredDown {
+			c.poweredDown = true
+			c.Power.PowerDowns++
+		}
+		if !c.wake() {
+			c.Power.PowerDown++
+			return ErrPowerDown
+		}
+	case PowerIdle:
+		if !c.idleUntil(c.Cycles + 1) {
+			return nil
+		}
+	}
+	if ok, err := c.serviceInterrupt(); ok || err != nil {
+		return err
+	}
+	pc, cycle := c.ProgCount, c.Cycles
+	in, err := ReadInstruction(c.ProgMem, int64(pc))
+	if err == nil && !c.inCode(pc, int(in.Len)) {
+		err = ErrCodeBounds
+	}
+	if err == nil && in.Op == ERR {
+		err = ErrUnknownOpCode
+	}
+	if err != nil {
+		//the fetch failed so there is nothing to complete, any
+		//policy which carries on steps over a single byte
+		kind := FaultCodeBounds
+		if err == ErrUnknownOpCode {
+			kind = FaultIllegalOpcode
+		}
+		if _, err := c.raise(&Fault{Kind: kind, PC: pc, Addr: pc, Cycle: cycle, Err: err}); err != nil {
+			return err
+		}
+		c.ProgCount++
+		c.advance(1)
+		return nil
+	}
+	skip, err := c.checkStack(in, pc, cycle)
+	if err != nil {
+		return err
+	}
+	c.ProgCount = in.Next()
+	if skip {
+		c.advance(int(in.Cycles))
+		return nil
+	}
+	if c.Observer != nil {
+		c.Observer.BeforeInstruction(c, pc, in)
+	}
+	c.latchRead = readModifyWrite(in)
+	err = DecodeInstruction(in)(c)
+	c.latchRead = false
+	c.stepDataPointers(in)
+	c.advance(int(in.Cycles))
+	if f, ok := err.(*Fault); ok {
+		//memory faults leave the instruction without effect
+		f.PC, f.Cycle = pc, cycle
+		_, err = c.raise(f)
+	}
+	if c.Observer != nil {
+		c.Observer.AfterInstruction(c, pc, in, err)
+	}
+	return err
 }
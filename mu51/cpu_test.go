@@ -0,0 +1,90 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestDirectIndirectSplit(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.WriteDirect(0x90, 0x12)
+	c.WriteIndirect(0x90, 0x34)
+	if c.ReadDirect(0x90) != 0x12 {
+		t.Errorf("direct read of P1 returned 0x%02X", c.ReadDirect(0x90))
+	}
+	if c.ReadIndirect(0x90) != 0x34 {
+		t.Errorf("indirect read of 0x90 returned 0x%02X", c.ReadIndirect(0x90))
+	}
+	c.WriteDirect(0x30, 0x56)
+	if c.ReadIndirect(0x30) != 0x56 {
+		t.Error("lower internal ram not shared between direct and indirect addressing")
+	}
+}
+
+func TestNamedRegisterCoherence(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.WriteDirect(ACC, 0x5A)
+	c.WriteDirect(B, 0xA5)
+	c.WriteDirect(SP, 0x30)
+	c.WriteDirect(DPL, 0x34)
+	c.WriteDirect(DPH, 0x12)
+	if c.Accum() != 0x5A || c.BReg() != 0xA5 || c.StackPtr() != 0x30 || c.DataPtr() != 0x1234 {
+		t.Errorf("named registers incoherent: A=%02X B=%02X SP=%02X DPTR=%04X", c.Accum(), c.BReg(), c.StackPtr(), c.DataPtr())
+	}
+	c.SetDataPtr(0xBEEF)
+	if c.ReadDirect(DPL) != 0xEF || c.ReadDirect(DPH) != 0xBE {
+		t.Error("data pointer not visible at DPL/DPH")
+	}
+}
+
+func TestStackUsesIndirectRAM(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.SetStackPtr(0x7F)
+	c.PushByte(0xAA)
+	if c.InternalRAM[0x80] != 0xAA || c.SFR(0x80) != 0 {
+		t.Error("push above 0x7F did not land in upper internal ram")
+	}
+	c.SetSFR(ACC, 0x77)
+	c.InstrPUSH(ACC)
+	if c.InternalRAM[0x81] != 0x77 {
+		t.Error("push of ACC did not use the SFR value")
+	}
+	c.InstrPOP(B)
+	if c.BReg() != 0x77 || c.StackPtr() != 0x80 {
+		t.Error("pop into B failed")
+	}
+}
+
+func TestParityTracksAccumulator(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.SetAccum(0x01)
+	if c.ProgStatus()&ParityBit == 0 {
+		t.Error("parity not set for odd accumulator")
+	}
+	c.SetProgStatus(0)
+	if c.ReadDirect(PSW)&ParityBit == 0 {
+		t.Error("parity bit writable through PSW")
+	}
+	c.SetAccum(0x03)
+	if c.ProgStatus()&ParityBit != 0 {
+		t.Error("parity set for even accumulator")
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	c := &CPU{ALU: &ALU{}}
+	c.SetAccum(0x7F)
+	c.InstrADD(0x01)
+	if c.Accum() != 0x80 || c.ProgStatus()&(OverFlowBit|AuxCarryBit) != OverFlowBit|AuxCarryBit || c.ProgStatus()&CarryBit != 0 {
+		t.Errorf("0x7F+0x01 gave A=%02X PSW=%02X", c.Accum(), c.ProgStatus())
+	}
+	c.SetAccum(0xFF)
+	c.SetReg(2, 0x01)
+	c.InstrADD(c.Reg(2))
+	if c.Accum() != 0x00 || c.ProgStatus()&CarryBit == 0 {
+		t.Errorf("0xFF+0x01 gave A=%02X PSW=%02X", c.Accum(), c.ProgStatus())
+	}
+	c.InstrADDC(0x00)
+	if c.Accum() != 0x01 {
+		t.Errorf("ADDC did not consume carry, A=%02X", c.Accum())
+	}
+}
@@ -0,0 +1,92 @@
+package mu51
+
+//DataPointers describes the data pointers of a derivative with more
+//than one DPTR. Each pointer has its own pair of registers and a field
+//of a select register, DPS or AUXR1, chooses the pointer every DPTR
+//instruction uses. Some parts can also toggle the selection or step the
+//selected pointer after each use to speed up block copies
+type DataPointers struct {
+	Low, High []uint8 //registers of each pointer, the first being DPL and DPH
+
+	Select     uint8 //register holding the selection
+	SelectMask uint8 //low bits of Select numbering the active pointer
+
+	//Toggle is the bit of Select which, when set, advances the selection
+	//after every instruction using DPTR, 0 when not supported
+	Toggle uint8
+
+	//AutoStep is the bit of Select which, when set, increments the
+	//active pointer after each MOVX @DPTR or MOVC @A+DPTR, 0 when not
+	//supported. Decrement holds a bit for each pointer which reverses it
+	AutoStep  uint8
+	Decrement []uint8
+}
+
+//active returns the number of the selected data pointer
+func (d *DataPointers) active(a *ALU) int {
+	n := int(a.SFR(d.Select) & d.SelectMask)
+	if n >= len(d.Low) {
+		return 0
+	}
+	return n
+}
+
+//dptrRegs returns the registers of the selected data pointer
+func (a *ALU) dptrRegs() (uint8, uint8) {
+	if a.DPTRs == nil {
+		return DPL, DPH
+	}
+	n := a.DPTRs.active(a)
+	return a.DPTRs.Low[n], a.DPTRs.High[n]
+}
+
+//ActiveDataPtr returns the number of the selected data pointer,
+//always 0 on parts with a single DPTR
+func (a *ALU) ActiveDataPtr() int {
+	if a.DPTRs == nil {
+		return 0
+	}
+	return a.DPTRs.active(a)
+}
+
+//usesDPTR reports whether an instruction uses the data pointer and
+//whether it accesses memory through it
+func usesDPTR(in Instruction) (bool, bool) {
+	for _, o := range in.Operands {
+		switch o.Kind {
+		case OperandDPTR:
+			return true, false
+		case OperandAtDPTR:
+			return true, true
+		case OperandAtADPTR:
+			return in.Op == MOVC, in.Op == MOVC
+		}
+	}
+	return false, false
+}
+
+//stepDataPointers applies any auto increment and auto toggle after
+//an instruction has used the data pointer
+func (c *CPU) stepDataPointers(in Instruction) {
+	d := c.DPTRs
+	if d == nil {
+		return
+	}
+	used, access := usesDPTR(in)
+	if !used {
+		return
+	}
+	sel := c.SFR(d.Select)
+	if access && d.AutoStep != 0 && sel&d.AutoStep != 0 {
+		n := d.active(c.ALU)
+		if n < len(d.Decrement) && sel&d.Decrement[n] != 0 {
+			c.SetDataPtr(c.DataPtr() - 1)
+		} else {
+			c.SetDataPtr(c.DataPtr() + 1)
+		}
+	}
+	if d.Toggle != 0 && sel&d.Toggle != 0 {
+		n := (d.active(c.ALU) + 1) % len(d.Low)
+		c.SetSFR(d.Select, sel&^d.SelectMask|uint8(n))
+	}
+}
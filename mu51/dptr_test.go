@@ -0,0 +1,61 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestDataPointerSelect(t *testing.T) {
+	c := ProfileAT89S52.NewCPU(Memory{
+		0x90, 0x12, 0x34, //MOV DPTR,#1234h
+		0x75, 0xA2, 0x01, //MOV AUXR1,#01h
+		0x90, 0x56, 0x78, //MOV DPTR,#5678h
+		0xA3, //INC DPTR
+	})
+	for i := 0; i < 4; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.SFR(DPH) != 0x12 || c.SFR(DPL) != 0x34 {
+		t.Errorf("DPTR0 changed to 0x%02X%02X", c.SFR(DPH), c.SFR(DPL))
+	}
+	if c.DataPtr() != 0x5679 || c.ActiveDataPtr() != 1 {
+		t.Errorf("DPTR%d is 0x%04X", c.ActiveDataPtr(), c.DataPtr())
+	}
+}
+
+func TestDataPointerAutoStep(t *testing.T) {
+	c := ProfileDS89C4x0.NewCPU(Memory{
+		0xE0, //MOVX A,@DPTR
+		0xF0, //MOVX @DPTR,A
+		0xE0, //MOVX A,@DPTR
+		0xF0, //MOVX @DPTR,A
+	})
+	xram := c.ExtRAM.(Memory)
+	xram[0x10], xram[0x11] = 0xAA, 0xBB
+	c.SetSFR(DPL, 0x10)
+	c.SetSFR(0x84, 0x21) //DPL1
+	c.SetSFR(0x86, 0xB0) //ID1 TSL AID, copying downwards into DPTR1
+	for i := 0; i < 4; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if xram[0x21] != 0xAA || xram[0x20] != 0xBB {
+		t.Errorf("block copy wrote 0x%02X 0x%02X", xram[0x21], xram[0x20])
+	}
+	if c.SFR(DPL) != 0x12 || c.SFR(0x84) != 0x1F || c.ActiveDataPtr() != 0 {
+		t.Errorf("pointers left at 0x%02X 0x%02X", c.SFR(DPL), c.SFR(0x84))
+	}
+}
+
+func TestDataPointerJMPDoesNotStep(t *testing.T) {
+	c := ProfileDS89C4x0.NewCPU(make(Memory, 0x100))
+	copy(c.ProgMem.(Memory), []byte{0x73}) //JMP @A+DPTR
+	c.SetSFR(DPL, 0x40)
+	c.SetSFR(0x86, 0x30)
+	c.Step()
+	if c.ProgCount != 0x40 || c.DataPtr() != 0x40 || c.ActiveDataPtr() != 0 {
+		t.Errorf("JMP @A+DPTR stepped the data pointers")
+	}
+}
@@ -0,0 +1,342 @@
+package mu51
+
+//Operation is a decoded instruction ready to be applied to a CPU
+type Operation func(*CPU) error
+
+//load returns the value of a byte sized source operand
+func (c *CPU) load(o Operand) uint8 {
+	switch o.Kind {
+	case OperandA:
+		return c.Accum()
+	case OperandReg:
+		return c.Reg(uint8(o.Value))
+	case OperandInd:
+		return c.ReadIndirect(c.Reg(uint8(o.Value)))
+	case OperandDirect:
+		return c.ReadDirect(uint8(o.Value))
+	}
+	return uint8(o.Value)
+}
+
+//store writes a byte sized destination operand
+func (c *CPU) store(o Operand, val uint8) {
+	switch o.Kind {
+	case OperandA:
+		c.SetAccum(val)
+	case OperandReg:
+		c.SetReg(uint8(o.Value), val)
+	case OperandInd:
+		c.WriteIndirect(c.Reg(uint8(o.Value)), val)
+	case OperandDirect:
+		c.WriteDirect(uint8(o.Value), val)
+	}
+}
+
+//loadBit returns the value of a carry, bit or complemented bit operand
+func (c *CPU) loadBit(o Operand) bool {
+	switch o.Kind {
+	case OperandC:
+		return c.Carry()
+	case OperandNotBit:
+		return !c.ReadBit(uint8(o.Value))
+	}
+	return c.ReadBit(uint8(o.Value))
+}
+
+//storeBit writes a carry or bit destination operand
+func (c *CPU) storeBit(o Operand, set bool) {
+	if o.Kind == OperandC {
+		c.SetCarry(set)
+		return
+	}
+	c.WriteBit(uint8(o.Value), set)
+}
+
+//xdataAddr returns the external ram address of a MOVX operand
+func (c *CPU) xdataAddr(o Operand) uint16 {
+	if o.Kind == OperandAtDPTR {
+		return c.DataPtr()
+	}
+	return c.xdataInd(uint8(o.Value))
+}
+
+//logic builds the operation shared by ANL, ORL and XRL which
+//either combine bytes or, for ANL and ORL, the carry with a bit
+func logic(ops []Operand, byteOp func(x, y uint8) uint8, bitOp func(x, y bool) bool) Operation {
+	if ops[0].Kind == OperandC {
+		return func(c *CPU) error {
+			c.SetCarry(bitOp(c.Carry(), c.loadBit(ops[1])))
+			return nil
+		}
+	}
+	return func(c *CPU) error {
+		c.store(ops[0], byteOp(c.load(ops[0]), c.load(ops[1])))
+		return nil
+	}
+}
+
+//convert a decoded instruction into a permutation function
+//the program counter will already point at the following instruction
+//by the time the returned operation is executed
+func DecodeInstruction(in Instruction) Operation {
+	ops := in.Operands
+	switch in.Op {
+	case ACALL:
+		return func(c *CPU) error {
+			c.InstrACALL(ops[0].Value)
+			return nil
+		}
+	case ADD:
+		return func(c *CPU) error {
+			c.InstrADD(c.load(ops[1]))
+			return nil
+		}
+	case ADDC:
+		return func(c *CPU) error {
+			c.InstrADDC(c.load(ops[1]))
+			return nil
+		}
+	case AJMP:
+		return func(c *CPU) error {
+			c.InstrAJMP(ops[0].Value)
+			return nil
+		}
+	case ANL:
+		return logic(ops,
+			func(x, y uint8) uint8 { return x & y },
+			func(x, y bool) bool { return x && y })
+	case CJNE:
+		return func(c *CPU) error {
+			c.InstrCJNE(c.load(ops[0]), c.load(ops[1]), ops[2].Value)
+			return nil
+		}
+	case CLR:
+		if ops[0].Kind == OperandA {
+			return func(c *CPU) error {
+				c.SetAccum(0)
+				return nil
+			}
+		}
+		return func(c *CPU) error {
+			c.storeBit(ops[0], false)
+			return nil
+		}
+	case CPL:
+		if ops[0].Kind == OperandA {
+			return func(c *CPU) error {
+				c.SetAccum(^c.Accum())
+				return nil
+			}
+		}
+		return func(c *CPU) error {
+			c.storeBit(ops[0], !c.loadBit(ops[0]))
+			return nil
+		}
+	case DA:
+		return func(c *CPU) error {
+			c.InstrDA()
+			return nil
+		}
+	case DEC:
+		return func(c *CPU) error {
+			c.store(ops[0], c.load(ops[0])-1)
+			return nil
+		}
+	case DIV:
+		return func(c *CPU) error {
+			c.InstrDIV()
+			return nil
+		}
+	case DJNZ:
+		return func(c *CPU) error {
+			c.InstrDJNZ(ops[0], ops[1].Value)
+			return nil
+		}
+	case INC:
+		if ops[0].Kind == OperandDPTR {
+			return func(c *CPU) error {
+				c.SetDataPtr(c.DataPtr() + 1)
+				return nil
+			}
+		}
+		return func(c *CPU) error {
+			c.store(ops[0], c.load(ops[0])+1)
+			return nil
+		}
+	case JB:
+		return func(c *CPU) error {
+			c.InstrJB(uint8(ops[0].Value), ops[1].Value)
+			return nil
+		}
+	case JBC:
+		return func(c *CPU) error {
+			c.InstrJBC(uint8(ops[0].Value), ops[1].Value)
+			return nil
+		}
+	case JC:
+		return func(c *CPU) error {
+			c.InstrJC(ops[0].Value)
+			return nil
+		}
+	case JMP:
+		return func(c *CPU) error {
+			c.InstrJMPIndexed()
+			return nil
+		}
+	case JNB:
+		return func(c *CPU) error {
+			c.InstrJNB(uint8(ops[0].Value), ops[1].Value)
+			return nil
+		}
+	case JNC:
+		return func(c *CPU) error {
+			c.InstrJNC(ops[0].Value)
+			return nil
+		}
+	case JNZ:
+		return func(c *CPU) error {
+			c.InstrJNZ(ops[0].Value)
+			return nil
+		}
+	case JZ:
+		return func(c *CPU) error {
+			c.InstrJZ(ops[0].Value)
+			return nil
+		}
+	case LCALL:
+		return func(c *CPU) error {
+			c.InstrLCALL(ops[0].Value)
+			return nil
+		}
+	case LJMP:
+		return func(c *CPU) error {
+			c.InstrLJMP(ops[0].Value)
+			return nil
+		}
+	case MOV:
+		switch {
+		case ops[0].Kind == OperandDPTR:
+			return func(c *CPU) error {
+				c.SetDataPtr(ops[1].Value)
+				return nil
+			}
+		case ops[0].Kind == OperandC || ops[1].Kind == OperandC:
+			return func(c *CPU) error {
+				c.storeBit(ops[0], c.loadBit(ops[1]))
+				return nil
+			}
+		}
+		return func(c *CPU) error {
+			c.store(ops[0], c.load(ops[1]))
+			return nil
+		}
+	case MOVC:
+		if ops[1].Kind == OperandAtADPTR {
+			return func(c *CPU) error {
+				return c.InstrMOVC(c.DataPtr())
+			}
+		}
+		return func(c *CPU) error {
+			return c.InstrMOVC(c.ProgCount)
+		}
+	case MOVX:
+		if ops[0].Kind == OperandA {
+			return func(c *CPU) error {
+				return c.InstrMOVXLoad(c.xdataAddr(ops[1]))
+			}
+		}
+		return func(c *CPU) error {
+			return c.InstrMOVXStore(c.xdataAddr(ops[0]))
+		}
+	case MUL:
+		return func(c *CPU) error {
+			c.InstrMUL()
+			return nil
+		}
+	case NOP:
+		return func(c *CPU) error {
+			return nil
+		}
+	case ORL:
+		return logic(ops,
+			func(x, y uint8) uint8 { return x | y },
+			func(x, y bool) bool { return x || y })
+	case POP:
+		return func(c *CPU) error {
+			c.InstrPOP(uint8(ops[0].Value))
+			return nil
+		}
+	case PUSH:
+		return func(c *CPU) error {
+			c.InstrPUSH(uint8(ops[0].Value))
+			return nil
+		}
+	case RET:
+		return func(c *CPU) error {
+			c.InstrRET()
+			return nil
+		}
+	case RETI:
+		return func(c *CPU) error {
+			c.InstrRETI()
+			return nil
+		}
+	case RL:
+		return func(c *CPU) error {
+			c.InstrRL()
+			return nil
+		}
+	case RLC:
+		return func(c *CPU) error {
+			c.InstrRLC()
+			return nil
+		}
+	case RR:
+		return func(c *CPU) error {
+			c.InstrRR()
+			return nil
+		}
+	case RRC:
+		return func(c *CPU) error {
+			c.InstrRRC()
+			return nil
+		}
+	case SJMP:
+		return func(c *CPU) error {
+			c.InstrSJMP(ops[0].Value)
+			return nil
+		}
+	case SETB:
+		return func(c *CPU) error {
+			c.storeBit(ops[0], true)
+			return nil
+		}
+	case SUBB:
+		return func(c *CPU) error {
+			c.InstrSUBB(c.load(ops[1]))
+			return nil
+		}
+	case SWAP:
+		return func(c *CPU) error {
+			c.InstrSWAP()
+			return nil
+		}
+	case XCH:
+		return func(c *CPU) error {
+			val := c.load(ops[1])
+			c.store(ops[1], c.Accum())
+			c.SetAccum(val)
+			return nil
+		}
+	case XCHD:
+		return func(c *CPU) error {
+			c.InstrXCHD(ops[1].Value != 0)
+			return nil
+		}
+	case XRL:
+		return logic(ops,
+			func(x, y uint8) uint8 { return x ^ y },
+			nil)
+	}
+	return nil
+}
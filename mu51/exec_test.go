@@ -0,0 +1,41 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"MUL", []byte{0xA4}, func(c *CPU) {
+			c.SetAccum(80)
+			c.SetBReg(160)
+		}, 0x1001, func(c *CPU) bool {
+			return c.Accum() == 0x00 && c.BReg() == 0x32 && c.ProgStatus()&OverFlowBit != 0
+		}},
+		{"INC DPTR", []byte{0xA3}, func(c *CPU) { c.SetDataPtr(0x12FF) }, 0x1001, func(c *CPU) bool { return c.DataPtr() == 0x1300 }},
+		{"DEC @Ri", []byte{0x17}, func(c *CPU) { c.SetReg(1, 0xC0) }, 0x1001, func(c *CPU) bool { return c.InternalRAM[0xC0] == 0xFF }},
+		{"SWAP", []byte{0xC4}, func(c *CPU) { c.SetAccum(0x12) }, 0x1001, func(c *CPU) bool { return c.Accum() == 0x21 }},
+	})
+}
+
+func TestLogic(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"ANL A,#data", []byte{0x54, 0x0F}, func(c *CPU) { c.SetAccum(0x3C) }, 0x1002, func(c *CPU) bool { return c.Accum() == 0x0C }},
+		{"ORL direct,#data", []byte{0x43, 0x30, 0x81}, func(c *CPU) { c.InternalRAM[0x30] = 0x10 }, 0x1003,
+			func(c *CPU) bool { return c.InternalRAM[0x30] == 0x91 }},
+		{"XRL direct,A", []byte{0x62, 0xF0}, func(c *CPU) {
+			c.SetAccum(0xFF)
+			c.SetBReg(0x0F)
+		}, 0x1002, func(c *CPU) bool { return c.BReg() == 0xF0 }},
+		{"ANL C,/bit", []byte{0xB0, 0x00}, setCarry, 0x1002, carry},
+		{"ORL C,bit", []byte{0x72, 0x00}, nil, 0x1002, func(c *CPU) bool { return !carry(c) }},
+		{"CPL bit", []byte{0xB2, 0x07}, nil, 0x1002, func(c *CPU) bool { return c.InternalRAM[0x20] == 0x80 }},
+		{"SETB C", []byte{0xD3}, nil, 0x1001, carry},
+		{"CLR A", []byte{0xE4}, func(c *CPU) { c.SetAccum(0x55) }, 0x1001, func(c *CPU) bool { return c.Accum() == 0 }},
+		{"CPL A", []byte{0xF4}, func(c *CPU) { c.SetAccum(0x55) }, 0x1001, func(c *CPU) bool { return c.Accum() == 0xAA }},
+		{"XCH A,direct", []byte{0xC5, 0xF0}, func(c *CPU) {
+			c.SetAccum(1)
+			c.SetBReg(2)
+		}, 0x1002, func(c *CPU) bool { return c.Accum() == 2 && c.BReg() == 1 }},
+	})
+}
@@ -0,0 +1,42 @@
+package mu51
+
+//ExtInterrupts samples the INT0 and INT1 pins (P3.2 and P3.3) once
+//every machine cycle. With IT0/IT1 set a falling edge between two
+//samples latches IE0/IE1, which is cleared again on vectoring. With
+//IT0/IT1 clear IE0/IE1 simply follow the inverted pin level
+type ExtInterrupts struct {
+	last [2]bool //pin levels at the previous sample
+}
+
+//Attach samples the interrupt pins
+func (e *ExtInterrupts) Attach(c *CPU) {
+	e.last[0] = c.pinLevel(P3, 2)
+	e.last[1] = c.pinLevel(P3, 3)
+}
+
+//Reset resamples the interrupt pins
+func (e *ExtInterrupts) Reset(c *CPU) {
+	e.Attach(c)
+}
+
+//Tick samples the interrupt pins and updates IE0 and IE1
+func (e *ExtInterrupts) Tick(c *CPU) {
+	tcon := c.SFR(TCON)
+	for n := uint(0); n < 2; n++ {
+		it := uint8(0x01) << (2 * n) //IT0, IT1
+		ie := uint8(0x02) << (2 * n) //IE0, IE1
+		level := c.pinLevel(P3, 2+n)
+		switch {
+		case tcon&it == 0:
+			if level {
+				tcon &^= ie
+			} else {
+				tcon |= ie
+			}
+		case e.last[n] && !level:
+			tcon |= ie
+		}
+		e.last[n] = level
+	}
+	c.SetSFR(TCON, tcon)
+}
@@ -0,0 +1,77 @@
+package mu51
+
+import (
+	"testing"
+)
+
+//newExtIntCPU returns a cpu spinning on SJMP $ with Ports ticked
+//ahead of ExtInterrupts so scheduled pulses are sampled on time
+func newExtIntCPU(tcon uint8) (*CPU, *Ports) {
+	c, p := newPortCPU(0x80, 0xFE) //SJMP $
+	c.SetSFR(TCON, tcon)
+	c.AddPeripheral(&ExtInterrupts{})
+	return c, p
+}
+
+func TestExtInterruptEdge(t *testing.T) {
+	c, p := newExtIntCPU(0x05) //IT0 IT1
+	p.Pulse(3, 3, 2, 1)
+	c.advance(2)
+	if c.SFR(TCON)&0x02 != 0 {
+		t.Fatal("IE0 set before the falling edge")
+	}
+	c.advance(1)
+	if c.SFR(TCON)&0x02 == 0 {
+		t.Fatal("falling edge on INT0 not latched")
+	}
+	c.advance(5)
+	if c.SFR(TCON)&0x02 == 0 {
+		t.Error("edge triggered IE0 cleared when the pin rose")
+	}
+
+	//holding the pin low raises only one request
+	c.SetSFR(TCON, 0x05)
+	p.Drive(3, 3, false)
+	c.advance(5)
+	if c.SFR(TCON)&0x08 == 0 {
+		t.Fatal("falling edge on INT1 not latched")
+	}
+	c.SetSFR(TCON, 0x05)
+	c.advance(5)
+	if c.SFR(TCON)&0x08 != 0 {
+		t.Error("held low pin raised a second edge")
+	}
+}
+
+func TestExtInterruptLevel(t *testing.T) {
+	c, p := newExtIntCPU(0x00)
+	p.Drive(3, 2, false)
+	c.advance(1)
+	if c.SFR(TCON)&0x02 == 0 {
+		t.Fatal("low level on INT0 not requested")
+	}
+	p.Release(3, 2)
+	c.advance(1)
+	if c.SFR(TCON)&0x02 != 0 {
+		t.Error("IE0 did not follow the pin high")
+	}
+}
+
+func TestExtInterruptVectoring(t *testing.T) {
+	c, p := newExtIntCPU(0x01)
+	c.SetSFR(IE, 0x81)
+	p.Pulse(5, 3, 2, 1)
+	for i := 0; i < 3; i++ {
+		c.Step()
+	}
+	if c.ProgCount != 0x1000 {
+		t.Fatalf("interrupt serviced before the pulse, PC 0x%04X", c.ProgCount)
+	}
+	c.Step()
+	if c.ProgCount != 0x0003 {
+		t.Fatalf("INT0 pulse not serviced, PC 0x%04X", c.ProgCount)
+	}
+	if c.SFR(TCON)&0x02 != 0 {
+		t.Error("edge triggered IE0 not cleared on vectoring")
+	}
+}
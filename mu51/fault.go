@@ -0,0 +1,175 @@
+package mu51
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+//ErrStackWrap is the cause of a FaultStack, the stack pointer would
+//run past the end of internal ram and wrap into the register banks
+var ErrStackWrap = errors.New("stack wrapped around internal ram")
+
+//ErrStackBounds is the cause of a FaultStack, the stack would use ram
+//outside the StackFloor and StackCeiling of the CPU
+var ErrStackBounds = errors.New("stack outside its bounds")
+
+//FaultKind classifies the faults firmware can run into
+type FaultKind int
+
+const (
+	//FaultIllegalOpcode is the execution of the undefined opcode 0xA5
+	FaultIllegalOpcode FaultKind = iota
+
+	//FaultCodeBounds is an instruction fetch or MOVC outside code memory
+	FaultCodeBounds
+
+	//FaultStack is a push, call or interrupt entry overflowing the top
+	//of internal ram or the stack ceiling, or writing below the stack
+	//floor into the register banks or bit area, or a pop or return
+	//underflowing the floor
+	FaultStack
+
+	//FaultXDATA is a MOVX to missing, unmapped or read only external ram
+	FaultXDATA
+)
+
+//faultNames are the names of each FaultKind
+var faultNames = []string{"illegal opcode", "code bounds", "stack", "xdata"}
+
+func (k FaultKind) String() string {
+	if k < 0 || int(k) >= len(faultNames) {
+		return fmt.Sprintf("fault %d", int(k))
+	}
+	return faultNames[k]
+}
+
+//Fault is the error returned by Step when firmware faults, Err holds
+//the underlying cause such as ErrUnknownOpCode or ErrNoExtRAM
+type Fault struct {
+	Kind  FaultKind
+	PC    uint16 //address of the faulting instruction
+	Addr  uint16 //address accessed, the stack pointer for FaultStack
+	Cycle uint64 //machine cycle the instruction started on
+	Err   error
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s fault at 0x%04X accessing 0x%04X: %v", f.Kind, f.PC, f.Addr, f.Err)
+}
+
+//Unwrap returns the underlying cause so errors.Is finds it
+func (f *Fault) Unwrap() error {
+	return f.Err
+}
+
+//FaultPolicy selects how the CPU responds to a kind of fault
+type FaultPolicy int
+
+const (
+	//FaultHalt stops execution, Step returns the fault
+	FaultHalt FaultPolicy = iota
+
+	//FaultNOP carries on as if the faulting instruction were a NOP
+	FaultNOP
+
+	//FaultLog writes the fault to FaultLog and carries on, letting
+	//the instruction complete where it can
+	FaultLog
+
+	//FaultCallback passes the fault to OnFault, execution carries on
+	//as with FaultLog unless it returns an error for Step to return
+	FaultCallback
+)
+
+//raise applies the configured policy to a fault. It reports whether
+//the faulting instruction should be skipped and the error, if any,
+//which Step should return
+func (c *CPU) raise(f *Fault) (bool, error) {
+	switch c.FaultPolicies[f.Kind] {
+	case FaultNOP:
+		return true, nil
+	case FaultLog:
+		if c.FaultLog != nil {
+			c.FaultLog.Print(f)
+		} else {
+			log.Print(f)
+		}
+		return false, nil
+	case FaultCallback:
+		if c.OnFault == nil {
+			return false, f
+		}
+		return false, c.OnFault(f)
+	}
+	return false, f
+}
+
+//iramSize returns the bytes of internal ram present
+func (a *ALU) iramSize() int {
+	if a.IRAMSize == 0 {
+		return 256
+	}
+	return a.IRAMSize
+}
+
+//stackDelta returns the bytes an instruction pushes on, or when
+//negative pops off, the stack
+func stackDelta(in Instruction) int {
+	switch in.Op {
+	case PUSH:
+		return 1
+	case ACALL, LCALL:
+		return 2
+	case POP:
+		return -1
+	case RET, RETI:
+		return -2
+	}
+	return 0
+}
+
+//stackBounds returns the lowest and highest internal ram addresses
+//the stack may use
+func (c *CPU) stackBounds() (int, int) {
+	ceiling := c.iramSize() - 1
+	if c.StackCeiling != 0 && int(c.StackCeiling) < ceiling {
+		ceiling = int(c.StackCeiling)
+	}
+	return int(c.StackFloor), ceiling
+}
+
+//stackError returns why moving the stack pointer by d, pushing when
+//positive and popping when negative, would fault or nil if it would not
+func (c *CPU) stackError(d int) error {
+	sp := int(c.StackPtr())
+	top := sp + d
+	if top < 0 || top >= c.iramSize() {
+		return ErrStackWrap
+	}
+
+	//the bytes written by a push or read by a pop
+	lo, hi := sp+1, top
+	if d < 0 {
+		lo, hi = top+1, sp
+	}
+	floor, ceiling := c.stackBounds()
+	if lo < floor || hi > ceiling {
+		return ErrStackBounds
+	}
+	return nil
+}
+
+//checkStack raises a FaultStack when an instruction would wrap the
+//stack around internal ram or take it outside its bounds
+func (c *CPU) checkStack(in Instruction, pc uint16, cycle uint64) (bool, error) {
+	d := stackDelta(in)
+	if d == 0 {
+		return false, nil
+	}
+	err := c.stackError(d)
+	if err == nil {
+		return false, nil
+	}
+	return c.raise(&Fault{Kind: FaultStack, PC: pc, Addr: uint16(c.StackPtr()), Cycle: cycle, Err: err})
+}
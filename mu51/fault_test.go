@@ -0,0 +1,169 @@
+package mu51
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestIllegalOpcodeFault(t *testing.T) {
+	c := newTestCPU(0x1000, 0xA5, 0x04) //illegal, INC A
+	err := c.Step()
+	var f *Fault
+	if !errors.As(err, &f) || f.Kind != FaultIllegalOpcode || f.PC != 0x1000 {
+		t.Fatalf("illegal opcode gave %v", err)
+	}
+	if !errors.Is(err, ErrUnknownOpCode) || c.ProgCount != 0x1000 {
+		t.Error("halting fault moved on or lost its cause")
+	}
+
+	c.FaultPolicies = map[FaultKind]FaultPolicy{FaultIllegalOpcode: FaultNOP}
+	for i := 0; i < 2; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Accum() != 1 || c.Cycles != 2 {
+		t.Errorf("illegal opcode not skipped as a NOP, A=%d cycles %d", c.Accum(), c.Cycles)
+	}
+}
+
+func TestCodeBoundsFault(t *testing.T) {
+	c := NewCPU(Memory{0x00}, nil)
+	c.Step()
+	err := c.Step()
+	var f *Fault
+	if !errors.As(err, &f) || f.Kind != FaultCodeBounds || f.PC != 0x0001 {
+		t.Fatalf("running off the end of code gave %v", err)
+	}
+
+	c = NewCPU(Memory{0x74, 0x10, 0x93}, nil) //MOV A,#10h, MOVC A,@A+DPTR
+	c.SetSFR(DPL, 0x80)
+	c.Step()
+	err = c.Step()
+	if !errors.As(err, &f) || f.Kind != FaultCodeBounds || f.PC != 0x0002 || f.Addr != 0x0090 {
+		t.Errorf("MOVC past the end of code gave %v", err)
+	}
+}
+
+func TestStackFault(t *testing.T) {
+	c := newTestCPU(0x1000, 0xC0, 0xE0, 0xC0, 0xE0) //PUSH ACC twice
+	c.SetStackPtr(0xFE)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Step()
+	var f *Fault
+	if !errors.As(err, &f) || f.Kind != FaultStack || f.Addr != 0xFF {
+		t.Fatalf("stack overflow gave %v", err)
+	}
+	if c.StackPtr() != 0xFF || c.InternalRAM[0x00] != 0 {
+		t.Error("faulting push wrote the register banks")
+	}
+
+	c = Profile8051.NewCPU(Memory{0x12, 0x00, 0x00}) //LCALL 0000h
+	c.SetStackPtr(0x7F)
+	if err := c.Step(); !errors.Is(err, ErrStackWrap) {
+		t.Errorf("call past 128 bytes of ram gave %v", err)
+	}
+}
+
+func TestStackBounds(t *testing.T) {
+	c := newTestCPU(0x1000, 0xC0, 0xE0) //PUSH ACC
+	c.StackFloor = 0x30
+	err := c.Step()
+	var f *Fault
+	if !errors.As(err, &f) || f.Kind != FaultStack || !errors.Is(err, ErrStackBounds) {
+		t.Fatalf("push into the register banks gave %v", err)
+	}
+	if c.InternalRAM[0x08] != 0 || c.StackPtr() != 0x07 {
+		t.Error("faulting push wrote below the floor")
+	}
+
+	c = newTestCPU(0x1000, 0x22) //RET
+	c.StackFloor = 0x30
+	c.SetStackPtr(0x30)
+	if err := c.Step(); !errors.Is(err, ErrStackBounds) {
+		t.Errorf("return below the floor gave %v", err)
+	}
+
+	c = newTestCPU(0x1000, 0x12, 0x00, 0x00) //LCALL 0000h
+	c.StackCeiling = 0x7F
+	c.SetStackPtr(0x7E)
+	if err := c.Step(); !errors.Is(err, ErrStackBounds) {
+		t.Errorf("call past the ceiling gave %v", err)
+	}
+	c.SetStackPtr(0x7D)
+	c.ProgCount = 0x1000
+	if err := c.Step(); err != nil || c.StackPtr() != 0x7F {
+		t.Errorf("call up to the ceiling gave %v", err)
+	}
+}
+
+func TestInterruptStackFault(t *testing.T) {
+	c := newTestCPU(0x1000, 0x00) //NOP
+	c.SetSFR(IE, 0x82)            //EA and ET0
+	c.SetSFR(TCON, 0x20)          //TF0
+	c.SetStackPtr(0xFE)
+	err := c.Step()
+	var f *Fault
+	if !errors.As(err, &f) || f.Kind != FaultStack || f.PC != 0x1000 || f.Addr != 0xFE {
+		t.Fatalf("interrupt entry past the top of ram gave %v", err)
+	}
+	if c.ProgCount != 0x1000 || c.InServiceLevel() != -1 {
+		t.Error("faulting interrupt entry vectored")
+	}
+
+	//skipping the entry runs the next instruction and leaves it pending
+	c.FaultPolicies = map[FaultKind]FaultPolicy{FaultStack: FaultNOP}
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0x1001 || c.SFR(TCON)&0x20 == 0 {
+		t.Error("skipped interrupt entry was taken")
+	}
+
+	c = newTestCPU(0x1000, 0x00)
+	c.SetSFR(IE, 0x82)
+	c.SetSFR(TCON, 0x20)
+	c.StackFloor = 0x30
+	if err := c.Step(); !errors.Is(err, ErrStackBounds) {
+		t.Errorf("interrupt entry below the floor gave %v", err)
+	}
+}
+
+func TestXDATAFaultPolicies(t *testing.T) {
+	code := []byte{0xE0, 0x04} //MOVX A,@DPTR, INC A
+
+	var buf bytes.Buffer
+	c := newTestCPU(0x1000, code...)
+	c.FaultPolicies = map[FaultKind]FaultPolicy{FaultXDATA: FaultLog}
+	c.FaultLog = log.New(&buf, "", 0)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "xdata fault at 0x1000") {
+		t.Errorf("fault logged as %q", buf.String())
+	}
+
+	var seen []*Fault
+	stop := errors.New("stop")
+	c = newTestCPU(0x1000, code...)
+	c.FaultPolicies = map[FaultKind]FaultPolicy{FaultXDATA: FaultCallback}
+	c.OnFault = func(f *Fault) error {
+		seen = append(seen, f)
+		return stop
+	}
+	if err := c.Step(); err != stop || len(seen) != 1 || seen[0].Kind != FaultXDATA {
+		t.Errorf("callback policy gave %v", err)
+	}
+	c.OnFault = func(f *Fault) error { return nil }
+	c.ProgCount = 0x1000
+	c.Step()
+	c.Step()
+	if c.Accum() != 1 {
+		t.Error("execution did not carry on after the callback")
+	}
+}
@@ -2,10 +2,16 @@ package mu51
 
 import (
 	"errors"
+	"io"
+	"strings"
 )
 
 var ErrUnknownOpCode = errors.New("usage of unknown opcode 0xA5")
 
+//ErrCodeBounds is returned when an instruction extends
+//past the end of code memory
+var ErrCodeBounds = errors.New("instruction read past end of code memory")
+
 type OpCode uint8
 
 const (
@@ -56,327 +62,528 @@ const (
 	ERR
 )
 
-type decoded struct {
-	len uint8
-	op  OpCode
+//mnemonics holds the assembler mnemonic for each OpCode
+var mnemonics = [...]string{
+	ACALL: "ACALL",
+	ADD:   "ADD",
+	ADDC:  "ADDC",
+	AJMP:  "AJMP",
+	ANL:   "ANL",
+	CJNE:  "CJNE",
+	CLR:   "CLR",
+	CPL:   "CPL",
+	DA:    "DA",
+	DEC:   "DEC",
+	DIV:   "DIV",
+	DJNZ:  "DJNZ",
+	INC:   "INC",
+	JB:    "JB",
+	JBC:   "JBC",
+	JC:    "JC",
+	JMP:   "JMP",
+	JNB:   "JNB",
+	JNC:   "JNC",
+	JNZ:   "JNZ",
+	JZ:    "JZ",
+	LCALL: "LCALL",
+	LJMP:  "LJMP",
+	MOV:   "MOV",
+	MOVC:  "MOVC",
+	MOVX:  "MOVX",
+	MUL:   "MUL",
+	NOP:   "NOP",
+	ORL:   "ORL",
+	POP:   "POP",
+	PUSH:  "PUSH",
+	RET:   "RET",
+	RETI:  "RETI",
+	RL:    "RL",
+	RLC:   "RLC",
+	RR:    "RR",
+	RRC:   "RRC",
+	SJMP:  "SJMP",
+	SETB:  "SETB",
+	SUBB:  "SUBB",
+	SWAP:  "SWAP",
+	XCH:   "XCH",
+	XCHD:  "XCHD",
+	XRL:   "XRL",
+	ERR:   "???",
+}
+
+//String returns the assembler mnemonic of the opcode
+func (o OpCode) String() string {
+	if int(o) < len(mnemonics) {
+		return mnemonics[o]
+	}
+	return "???"
+}
+
+//ParseOpCode returns the OpCode with the assembler mnemonic name,
+//the comparison ignores case
+func ParseOpCode(name string) (OpCode, bool) {
+	for op, v := range mnemonics[:ERR] {
+		if strings.EqualFold(v, name) {
+			return OpCode(op), true
+		}
+	}
+	return ERR, false
+}
+
+//OperandKind identifies the addressing mode of an instruction operand
+type OperandKind uint8
+
+const (
+	//OperandA is the accumulator
+	OperandA OperandKind = iota
+
+	//OperandAB is the A and B register pair used by MUL and DIV
+	OperandAB
+
+	//OperandC is the carry flag
+	OperandC
+
+	//OperandDPTR is the data pointer
+	OperandDPTR
+
+	//OperandReg is a register R0-R7 of the active bank
+	OperandReg
+
+	//OperandInd is internal ram addressed indirectly through R0 or R1
+	OperandInd
+
+	//OperandImm is an 8 bit literal
+	OperandImm
+
+	//OperandImm16 is a 16 bit literal
+	OperandImm16
+
+	//OperandDirect is a directly addressed internal ram location or SFR
+	OperandDirect
+
+	//OperandBit is a bit address
+	OperandBit
+
+	//OperandNotBit is the complement of a bit address
+	OperandNotBit
+
+	//OperandRel is a signed offset relative to the following instruction
+	OperandRel
+
+	//OperandAddr11 is an address within the 2KiB page of the following instruction
+	OperandAddr11
+
+	//OperandAddr16 is an absolute code address
+	OperandAddr16
+
+	//OperandAtDPTR is external ram addressed by the data pointer
+	OperandAtDPTR
+
+	//OperandAtADPTR is code memory indexed by the accumulator and data pointer
+	OperandAtADPTR
+
+	//OperandAtAPC is code memory indexed by the accumulator and program counter
+	OperandAtAPC
+)
+
+//size returns the number of instruction bytes used to encode the operand
+func (k OperandKind) size() uint8 {
+	switch k {
+	case OperandImm, OperandDirect, OperandBit, OperandNotBit, OperandRel, OperandAddr11:
+		return 1
+	case OperandImm16, OperandAddr16:
+		return 2
+	}
+	return 0
+}
+
+//arithFlags are the flags affected by ADD, ADDC and SUBB
+const arithFlags = CarryBit | AuxCarryBit | OverFlowBit
+
+//Descriptor statically describes one of the 256 opcodes
+type Descriptor struct {
+	Op     OpCode        //mnemonic of the instruction
+	Len    uint8         //encoded length in bytes, including the opcode
+	Cycles uint8         //machine cycles taken on a classic 12 clock core
+	Kinds  []OperandKind //operands in assembly order
+	Flags  uint8         //mask of the PSW flags the instruction may alter
 }
 
 //a jump table to quickly decode which opcode we are dealing with
 //and how much more data we should read
-var decodeTable = [256]decoded{
-	{len: 1, op: NOP},   //0x00
-	{len: 2, op: AJMP},  //0x01
-	{len: 3, op: LJMP},  //0x02
-	{len: 1, op: RR},    //0x03
-	{len: 1, op: INC},   //0x04
-	{len: 2, op: INC},   //0x05
-	{len: 1, op: INC},   //0x06
-	{len: 1, op: INC},   //0x07
-	{len: 1, op: INC},   //0x08
-	{len: 1, op: INC},   //0x09
-	{len: 1, op: INC},   //0x0A
-	{len: 1, op: INC},   //0x0B
-	{len: 1, op: INC},   //0x0C
-	{len: 1, op: INC},   //0x0D
-	{len: 1, op: INC},   //0x0E
-	{len: 1, op: INC},   //0x0F
-	{len: 3, op: JBC},   //0x10
-	{len: 2, op: ACALL}, //0x11
-	{len: 3, op: LCALL}, //0x12
-	{len: 1, op: RRC},   //0x13
-	{len: 1, op: DEC},   //0x14
-	{len: 2, op: DEC},   //0x15
-	{len: 1, op: DEC},   //0x16
-	{len: 1, op: DEC},   //0x17
-	{len: 1, op: DEC},   //0x18
-	{len: 1, op: DEC},   //0x19
-	{len: 1, op: DEC},   //0x1A
-	{len: 1, op: DEC},   //0x1B
-	{len: 1, op: DEC},   //0x1C
-	{len: 1, op: DEC},   //0x1D
-	{len: 1, op: DEC},   //0x1E
-	{len: 1, op: DEC},   //0x1F
-	{len: 3, op: JB},    //0x20
-	{len: 2, op: AJMP},  //0x21
-	{len: 1, op: RET},   //0x22
-	{len: 1, op: RL},    //0x23
-	{len: 2, op: ADD},   //0x24
-	{len: 2, op: ADD},   //0x25
-	{len: 1, op: ADD},   //0x26
-	{len: 1, op: ADD},   //0x27
-	{len: 1, op: ADD},   //0x28
-	{len: 1, op: ADD},   //0x29
-	{len: 1, op: ADD},   //0x2A
-	{len: 1, op: ADD},   //0x2B
-	{len: 1, op: ADD},   //0x2C
-	{len: 1, op: ADD},   //0x2D
-	{len: 1, op: ADD},   //0x2E
-	{len: 1, op: ADD},   //0x2F
-	{len: 3, op: JNB},   //0x30
-	{len: 2, op: ACALL}, //0x31
-	{len: 1, op: RETI},  //0x32
-	{len: 1, op: RLC},   //0x33
-	{len: 2, op: ADDC},  //0x34
-	{len: 2, op: ADDC},  //0x35
-	{len: 1, op: ADDC},  //0x36
-	{len: 1, op: ADDC},  //0x37
-	{len: 1, op: ADDC},  //0x38
-	{len: 1, op: ADDC},  //0x39
-	{len: 1, op: ADDC},  //0x3A
-	{len: 1, op: ADDC},  //0x3B
-	{len: 1, op: ADDC},  //0x3C
-	{len: 1, op: ADDC},  //0x3D
-	{len: 1, op: ADDC},  //0x3E
-	{len: 1, op: ADDC},  //0x3F
-	{len: 2, op: JC},    //0x40
-	{len: 2, op: AJMP},  //0x41
-	{len: 2, op: ORL},   //0x42
-	{len: 3, op: ORL},   //0x43
-	{len: 2, op: ORL},   //0x44
-	{len: 2, op: ORL},   //0x45
-	{len: 1, op: ORL},   //0x46
-	{len: 1, op: ORL},   //0x47
-	{len: 1, op: ORL},   //0x48
-	{len: 1, op: ORL},   //0x49
-	{len: 1, op: ORL},   //0x4A
-	{len: 1, op: ORL},   //0x4B
-	{len: 1, op: ORL},   //0x4C
-	{len: 1, op: ORL},   //0x4D
-	{len: 1, op: ORL},   //0x4E
-	{len: 1, op: ORL},   //0x4F
-	{len: 2, op: JNC},   //0x50
-	{len: 2, op: ACALL}, //0x51
-	{len: 2, op: ANL},   //0x52
-	{len: 3, op: ANL},   //0x53
-	{len: 2, op: ANL},   //0x54
-	{len: 2, op: ANL},   //0x55
-	{len: 1, op: ANL},   //0x56
-	{len: 1, op: ANL},   //0x57
-	{len: 1, op: ANL},   //0x58
-	{len: 1, op: ANL},   //0x59
-	{len: 1, op: ANL},   //0x5A
-	{len: 1, op: ANL},   //0x5B
-	{len: 1, op: ANL},   //0x5C
-	{len: 1, op: ANL},   //0x5D
-	{len: 1, op: ANL},   //0x5E
-	{len: 1, op: ANL},   //0x5F
-	{len: 2, op: JZ},    //0x60
-	{len: 2, op: AJMP},  //0x61
-	{len: 2, op: XRL},   //0x62
-	{len: 3, op: XRL},   //0x63
-	{len: 2, op: XRL},   //0x64
-	{len: 2, op: XRL},   //0x65
-	{len: 1, op: XRL},   //0x66
-	{len: 1, op: XRL},   //0x67
-	{len: 1, op: XRL},   //0x68
-	{len: 1, op: XRL},   //0x69
-	{len: 1, op: XRL},   //0x6A
-	{len: 1, op: XRL},   //0x6B
-	{len: 1, op: XRL},   //0x6C
-	{len: 1, op: XRL},   //0x6D
-	{len: 1, op: XRL},   //0x6E
-	{len: 1, op: XRL},   //0x6F
-	{len: 2, op: JNZ},   //0x70
-	{len: 2, op: ACALL}, //0x71
-	{len: 2, op: ORL},   //0x72
-	{len: 1, op: JMP},   //0x73
-	{len: 2, op: MOV},   //0x74
-	{len: 3, op: MOV},   //0x75
-	{len: 2, op: MOV},   //0x76
-	{len: 2, op: MOV},   //0x77
-	{len: 2, op: MOV},   //0x78
-	{len: 2, op: MOV},   //0x79
-	{len: 2, op: MOV},   //0x7A
-	{len: 2, op: MOV},   //0x7B
-	{len: 2, op: MOV},   //0x7C
-	{len: 2, op: MOV},   //0x7D
-	{len: 2, op: MOV},   //0x7E
-	{len: 2, op: MOV},   //0x7F
-	{len: 2, op: SJMP},  //0x80
-	{len: 2, op: AJMP},  //0x81
-	{len: 2, op: ANL},   //0x82
-	{len: 1, op: MOVC},  //0x83
-	{len: 1, op: DIV},   //0x84
-	{len: 3, op: MOV},   //0x85
-	{len: 2, op: MOV},   //0x86
-	{len: 2, op: MOV},   //0x87
-	{len: 2, op: MOV},   //0x88
-	{len: 2, op: MOV},   //0x89
-	{len: 2, op: MOV},   //0x8A
-	{len: 2, op: MOV},   //0x8B
-	{len: 2, op: MOV},   //0x8C
-	{len: 2, op: MOV},   //0x8D
-	{len: 2, op: MOV},   //0x8E
-	{len: 2, op: MOV},   //0x8F
-	{len: 3, op: MOV},   //0x90
-	{len: 2, op: ACALL}, //0x91
-	{len: 2, op: MOV},   //0x92
-	{len: 1, op: MOVC},  //0x93
-	{len: 2, op: SUBB},  //0x94
-	{len: 2, op: SUBB},  //0x95
-	{len: 1, op: SUBB},  //0x96
-	{len: 1, op: SUBB},  //0x97
-	{len: 1, op: SUBB},  //0x98
-	{len: 1, op: SUBB},  //0x99
-	{len: 1, op: SUBB},  //0x9A
-	{len: 1, op: SUBB},  //0x9B
-	{len: 1, op: SUBB},  //0x9C
-	{len: 1, op: SUBB},  //0x9D
-	{len: 1, op: SUBB},  //0x9E
-	{len: 1, op: SUBB},  //0x9F
-	{len: 2, op: ORL},   //0xA0
-	{len: 2, op: AJMP},  //0xA1
-	{len: 2, op: MOV},   //0xA2
-	{len: 1, op: INC},   //0xA3
-	{len: 1, op: MUL},   //0xA4
-	{len: 1, op: ERR},   //0xA5
-	{len: 2, op: MOV},   //0xA6
-	{len: 2, op: MOV},   //0xA7
-	{len: 2, op: MOV},   //0xA8
-	{len: 2, op: MOV},   //0xA9
-	{len: 2, op: MOV},   //0xAA
-	{len: 2, op: MOV},   //0xAB
-	{len: 2, op: MOV},   //0xAC
-	{len: 2, op: MOV},   //0xAD
-	{len: 2, op: MOV},   //0xAE
-	{len: 2, op: MOV},   //0xAF
-	{len: 2, op: ANL},   //0xB0
-	{len: 2, op: ACALL}, //0xB1
-	{len: 2, op: CPL},   //0xB2
-	{len: 1, op: CPL},   //0xB3
-	{len: 3, op: CJNE},  //0xB4
-	{len: 3, op: CJNE},  //0xB5
-	{len: 3, op: CJNE},  //0xB6
-	{len: 3, op: CJNE},  //0xB7
-	{len: 3, op: CJNE},  //0xB8
-	{len: 3, op: CJNE},  //0xB9
-	{len: 3, op: CJNE},  //0xBA
-	{len: 3, op: CJNE},  //0xBB
-	{len: 3, op: CJNE},  //0xBC
-	{len: 3, op: CJNE},  //0xBD
-	{len: 3, op: CJNE},  //0xBE
-	{len: 3, op: CJNE},  //0xBF
-	{len: 2, op: PUSH},  //0xC0
-	{len: 2, op: AJMP},  //0xC1
-	{len: 2, op: CLR},   //0xC2
-	{len: 1, op: CLR},   //0xC3
-	{len: 1, op: SWAP},  //0xC4
-	{len: 2, op: XCH},   //0xC5
-	{len: 1, op: XCH},   //0xC6
-	{len: 1, op: XCH},   //0xC7
-	{len: 1, op: XCH},   //0xC8
-	{len: 1, op: XCH},   //0xC9
-	{len: 1, op: XCH},   //0xCA
-	{len: 1, op: XCH},   //0xCB
-	{len: 1, op: XCH},   //0xCC
-	{len: 1, op: XCH},   //0xCD
-	{len: 1, op: XCH},   //0xCE
-	{len: 1, op: XCH},   //0xCF
-	{len: 2, op: POP},   //0xD0
-	{len: 2, op: ACALL}, //0xD1
-	{len: 2, op: SETB},  //0xD2
-	{len: 1, op: SETB},  //0xD3
-	{len: 1, op: DA},    //0xD4
-	{len: 3, op: DJNZ},  //0xD5
-	{len: 1, op: XCHD},  //0xD6
-	{len: 1, op: XCHD},  //0xD7
-	{len: 2, op: DJNZ},  //0xD8
-	{len: 2, op: DJNZ},  //0xD9
-	{len: 2, op: DJNZ},  //0xDA
-	{len: 2, op: DJNZ},  //0xDB
-	{len: 2, op: DJNZ},  //0xDC
-	{len: 2, op: DJNZ},  //0xDD
-	{len: 2, op: DJNZ},  //0xDE
-	{len: 2, op: DJNZ},  //0xDF
-	{len: 1, op: MOVX},  //0xE0
-	{len: 2, op: AJMP},  //0xE1
-	{len: 1, op: MOVX},  //0xE2
-	{len: 1, op: MOVX},  //0xE3
-	{len: 1, op: CLR},   //0xE4
-	{len: 2, op: MOV},   //0xE5
-	{len: 1, op: MOV},   //0xE6
-	{len: 1, op: MOV},   //0xE7
-	{len: 1, op: MOV},   //0xE8
-	{len: 1, op: MOV},   //0xE9
-	{len: 1, op: MOV},   //0xEA
-	{len: 1, op: MOV},   //0xEB
-	{len: 1, op: MOV},   //0xEC
-	{len: 1, op: MOV},   //0xED
-	{len: 1, op: MOV},   //0xEE
-	{len: 1, op: MOV},   //0xEF
-	{len: 1, op: MOVX},  //0xF0
-	{len: 2, op: ACALL}, //0xF1
-	{len: 1, op: MOVX},  //0xF2
-	{len: 1, op: MOVX},  //0xF3
-	{len: 1, op: CPL},   //0xF4
-	{len: 2, op: MOV},   //0xF5
-	{len: 1, op: MOV},   //0xF6
-	{len: 1, op: MOV},   //0xF7
-	{len: 1, op: MOV},   //0xF8
-	{len: 1, op: MOV},   //0xF9
-	{len: 1, op: MOV},   //0xFA
-	{len: 1, op: MOV},   //0xFB
-	{len: 1, op: MOV},   //0xFC
-	{len: 1, op: MOV},   //0xFD
-	{len: 1, op: MOV},   //0xFE
-	{len: 1, op: MOV},   //0xFF
+var decodeTable = [256]Descriptor{
+	{Op: NOP, Len: 1, Cycles: 1}, //0x00 NOP
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x01 AJMP addr11
+	{Op: LJMP, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandAddr16}}, //0x02 LJMP addr16
+	{Op: RR, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0x03 RR A
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0x04 INC A
+	{Op: INC, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandDirect}}, //0x05 INC direct
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandInd}}, //0x06 INC @Ri
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandInd}}, //0x07 INC @Ri
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x08 INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x09 INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x0A INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x0B INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x0C INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x0D INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x0E INC Rn
+	{Op: INC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x0F INC Rn
+	{Op: JBC, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandBit, OperandRel}}, //0x10 JBC bit,rel
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x11 ACALL addr11
+	{Op: LCALL, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandAddr16}}, //0x12 LCALL addr16
+	{Op: RRC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}, Flags: CarryBit}, //0x13 RRC A
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0x14 DEC A
+	{Op: DEC, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandDirect}}, //0x15 DEC direct
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandInd}}, //0x16 DEC @Ri
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandInd}}, //0x17 DEC @Ri
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x18 DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x19 DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x1A DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x1B DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x1C DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x1D DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x1E DEC Rn
+	{Op: DEC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg}}, //0x1F DEC Rn
+	{Op: JB, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandBit, OperandRel}}, //0x20 JB bit,rel
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x21 AJMP addr11
+	{Op: RET, Len: 1, Cycles: 2}, //0x22 RET
+	{Op: RL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0x23 RL A
+	{Op: ADD, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}, Flags: arithFlags}, //0x24 ADD A,#data
+	{Op: ADD, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}, Flags: arithFlags}, //0x25 ADD A,direct
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}, Flags: arithFlags}, //0x26 ADD A,@Ri
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}, Flags: arithFlags}, //0x27 ADD A,@Ri
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x28 ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x29 ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x2A ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x2B ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x2C ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x2D ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x2E ADD A,Rn
+	{Op: ADD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x2F ADD A,Rn
+	{Op: JNB, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandBit, OperandRel}}, //0x30 JNB bit,rel
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x31 ACALL addr11
+	{Op: RETI, Len: 1, Cycles: 2}, //0x32 RETI
+	{Op: RLC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}, Flags: CarryBit}, //0x33 RLC A
+	{Op: ADDC, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}, Flags: arithFlags}, //0x34 ADDC A,#data
+	{Op: ADDC, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}, Flags: arithFlags}, //0x35 ADDC A,direct
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}, Flags: arithFlags}, //0x36 ADDC A,@Ri
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}, Flags: arithFlags}, //0x37 ADDC A,@Ri
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x38 ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x39 ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x3A ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x3B ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x3C ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x3D ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x3E ADDC A,Rn
+	{Op: ADDC, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x3F ADDC A,Rn
+	{Op: JC, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandRel}}, //0x40 JC rel
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x41 AJMP addr11
+	{Op: ORL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandDirect, OperandA}}, //0x42 ORL direct,A
+	{Op: ORL, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandImm}}, //0x43 ORL direct,#data
+	{Op: ORL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}}, //0x44 ORL A,#data
+	{Op: ORL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}}, //0x45 ORL A,direct
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0x46 ORL A,@Ri
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0x47 ORL A,@Ri
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x48 ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x49 ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x4A ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x4B ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x4C ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x4D ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x4E ORL A,Rn
+	{Op: ORL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x4F ORL A,Rn
+	{Op: JNC, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandRel}}, //0x50 JNC rel
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x51 ACALL addr11
+	{Op: ANL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandDirect, OperandA}}, //0x52 ANL direct,A
+	{Op: ANL, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandImm}}, //0x53 ANL direct,#data
+	{Op: ANL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}}, //0x54 ANL A,#data
+	{Op: ANL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}}, //0x55 ANL A,direct
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0x56 ANL A,@Ri
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0x57 ANL A,@Ri
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x58 ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x59 ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x5A ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x5B ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x5C ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x5D ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x5E ANL A,Rn
+	{Op: ANL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x5F ANL A,Rn
+	{Op: JZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandRel}}, //0x60 JZ rel
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x61 AJMP addr11
+	{Op: XRL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandDirect, OperandA}}, //0x62 XRL direct,A
+	{Op: XRL, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandImm}}, //0x63 XRL direct,#data
+	{Op: XRL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}}, //0x64 XRL A,#data
+	{Op: XRL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}}, //0x65 XRL A,direct
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0x66 XRL A,@Ri
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0x67 XRL A,@Ri
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x68 XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x69 XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x6A XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x6B XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x6C XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x6D XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x6E XRL A,Rn
+	{Op: XRL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0x6F XRL A,Rn
+	{Op: JNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandRel}}, //0x70 JNZ rel
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x71 ACALL addr11
+	{Op: ORL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandC, OperandBit}, Flags: CarryBit}, //0x72 ORL C,bit
+	{Op: JMP, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandAtADPTR}}, //0x73 JMP @A+DPTR
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}}, //0x74 MOV A,#data
+	{Op: MOV, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandImm}}, //0x75 MOV direct,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandInd, OperandImm}}, //0x76 MOV @Ri,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandInd, OperandImm}}, //0x77 MOV @Ri,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x78 MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x79 MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x7A MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x7B MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x7C MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x7D MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x7E MOV Rn,#data
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandImm}}, //0x7F MOV Rn,#data
+	{Op: SJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandRel}}, //0x80 SJMP rel
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x81 AJMP addr11
+	{Op: ANL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandC, OperandBit}, Flags: CarryBit}, //0x82 ANL C,bit
+	{Op: MOVC, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandA, OperandAtAPC}}, //0x83 MOVC A,@A+PC
+	{Op: DIV, Len: 1, Cycles: 4, Kinds: []OperandKind{OperandAB}, Flags: CarryBit | OverFlowBit}, //0x84 DIV AB
+	{Op: MOV, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandDirect}}, //0x85 MOV direct,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandInd}}, //0x86 MOV direct,@Ri
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandInd}}, //0x87 MOV direct,@Ri
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x88 MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x89 MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x8A MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x8B MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x8C MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x8D MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x8E MOV direct,Rn
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandReg}}, //0x8F MOV direct,Rn
+	{Op: MOV, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDPTR, OperandImm16}}, //0x90 MOV DPTR,#data16
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0x91 ACALL addr11
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandBit, OperandC}}, //0x92 MOV bit,C
+	{Op: MOVC, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandA, OperandAtADPTR}}, //0x93 MOVC A,@A+DPTR
+	{Op: SUBB, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandImm}, Flags: arithFlags}, //0x94 SUBB A,#data
+	{Op: SUBB, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}, Flags: arithFlags}, //0x95 SUBB A,direct
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}, Flags: arithFlags}, //0x96 SUBB A,@Ri
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}, Flags: arithFlags}, //0x97 SUBB A,@Ri
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x98 SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x99 SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x9A SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x9B SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x9C SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x9D SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x9E SUBB A,Rn
+	{Op: SUBB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}, Flags: arithFlags}, //0x9F SUBB A,Rn
+	{Op: ORL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandC, OperandNotBit}, Flags: CarryBit}, //0xA0 ORL C,/bit
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0xA1 AJMP addr11
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandC, OperandBit}, Flags: CarryBit}, //0xA2 MOV C,bit
+	{Op: INC, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandDPTR}}, //0xA3 INC DPTR
+	{Op: MUL, Len: 1, Cycles: 4, Kinds: []OperandKind{OperandAB}, Flags: CarryBit | OverFlowBit}, //0xA4 MUL AB
+	{Op: ERR, Len: 1, Cycles: 1}, //0xA5 reserved
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandInd, OperandDirect}}, //0xA6 MOV @Ri,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandInd, OperandDirect}}, //0xA7 MOV @Ri,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xA8 MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xA9 MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xAA MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xAB MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xAC MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xAD MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xAE MOV Rn,direct
+	{Op: MOV, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandDirect}}, //0xAF MOV Rn,direct
+	{Op: ANL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandC, OperandNotBit}, Flags: CarryBit}, //0xB0 ANL C,/bit
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0xB1 ACALL addr11
+	{Op: CPL, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandBit}}, //0xB2 CPL bit
+	{Op: CPL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandC}, Flags: CarryBit}, //0xB3 CPL C
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandA, OperandImm, OperandRel}, Flags: CarryBit}, //0xB4 CJNE A,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandA, OperandDirect, OperandRel}, Flags: CarryBit}, //0xB5 CJNE A,direct,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandInd, OperandImm, OperandRel}, Flags: CarryBit}, //0xB6 CJNE @Ri,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandInd, OperandImm, OperandRel}, Flags: CarryBit}, //0xB7 CJNE @Ri,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xB8 CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xB9 CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xBA CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xBB CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xBC CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xBD CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xBE CJNE Rn,#data,rel
+	{Op: CJNE, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandImm, OperandRel}, Flags: CarryBit}, //0xBF CJNE Rn,#data,rel
+	{Op: PUSH, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect}}, //0xC0 PUSH direct
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0xC1 AJMP addr11
+	{Op: CLR, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandBit}}, //0xC2 CLR bit
+	{Op: CLR, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandC}, Flags: CarryBit}, //0xC3 CLR C
+	{Op: SWAP, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0xC4 SWAP A
+	{Op: XCH, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}}, //0xC5 XCH A,direct
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0xC6 XCH A,@Ri
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0xC7 XCH A,@Ri
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xC8 XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xC9 XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xCA XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xCB XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xCC XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xCD XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xCE XCH A,Rn
+	{Op: XCH, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xCF XCH A,Rn
+	{Op: POP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandDirect}}, //0xD0 POP direct
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0xD1 ACALL addr11
+	{Op: SETB, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandBit}}, //0xD2 SETB bit
+	{Op: SETB, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandC}, Flags: CarryBit}, //0xD3 SETB C
+	{Op: DA, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}, Flags: CarryBit}, //0xD4 DA A
+	{Op: DJNZ, Len: 3, Cycles: 2, Kinds: []OperandKind{OperandDirect, OperandRel}}, //0xD5 DJNZ direct,rel
+	{Op: XCHD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0xD6 XCHD A,@Ri
+	{Op: XCHD, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0xD7 XCHD A,@Ri
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xD8 DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xD9 DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xDA DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xDB DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xDC DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xDD DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xDE DJNZ Rn,rel
+	{Op: DJNZ, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandReg, OperandRel}}, //0xDF DJNZ Rn,rel
+	{Op: MOVX, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandA, OperandAtDPTR}}, //0xE0 MOVX A,@DPTR
+	{Op: AJMP, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0xE1 AJMP addr11
+	{Op: MOVX, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandA, OperandInd}}, //0xE2 MOVX A,@Ri
+	{Op: MOVX, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandA, OperandInd}}, //0xE3 MOVX A,@Ri
+	{Op: CLR, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0xE4 CLR A
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandA, OperandDirect}}, //0xE5 MOV A,direct
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0xE6 MOV A,@Ri
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandInd}}, //0xE7 MOV A,@Ri
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xE8 MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xE9 MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xEA MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xEB MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xEC MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xED MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xEE MOV A,Rn
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA, OperandReg}}, //0xEF MOV A,Rn
+	{Op: MOVX, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandAtDPTR, OperandA}}, //0xF0 MOVX @DPTR,A
+	{Op: ACALL, Len: 2, Cycles: 2, Kinds: []OperandKind{OperandAddr11}}, //0xF1 ACALL addr11
+	{Op: MOVX, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandInd, OperandA}}, //0xF2 MOVX @Ri,A
+	{Op: MOVX, Len: 1, Cycles: 2, Kinds: []OperandKind{OperandInd, OperandA}}, //0xF3 MOVX @Ri,A
+	{Op: CPL, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandA}}, //0xF4 CPL A
+	{Op: MOV, Len: 2, Cycles: 1, Kinds: []OperandKind{OperandDirect, OperandA}}, //0xF5 MOV direct,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandInd, OperandA}}, //0xF6 MOV @Ri,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandInd, OperandA}}, //0xF7 MOV @Ri,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xF8 MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xF9 MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xFA MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xFB MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xFC MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xFD MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xFE MOV Rn,A
+	{Op: MOV, Len: 1, Cycles: 1, Kinds: []OperandKind{OperandReg, OperandA}}, //0xFF MOV Rn,A
+}
+
+//Lookup returns the descriptor of an opcode
+func Lookup(opcode uint8) Descriptor {
+	return decodeTable[opcode]
+}
+
+//Operand is a single decoded instruction operand. Value holds the
+//register number for Rn and @Ri, the address for direct and bit
+//operands, the literal for immediates and the resolved target
+//address for all jump operands
+type Operand struct {
+	Kind  OperandKind
+	Value uint16
+}
+
+//Instruction is a single decoded instruction along with the
+//descriptor of its opcode
+type Instruction struct {
+	Descriptor
+	Address  uint16    //code address the instruction was read from
+	Bytes    []byte    //raw encoding, starting with the opcode
+	Operands []Operand //decoded operands in assembly order
 }
 
-func ReadInstruction(c CodeMemory, offset int64) (OpCode, []byte, error) {
+//Opcode returns the opcode byte of the instruction
+func (in Instruction) Opcode() uint8 {
+	return in.Bytes[0]
+}
+
+//Next returns the address of the following instruction
+func (in Instruction) Next() uint16 {
+	return in.Address + uint16(in.Len)
+}
+
+//Decode decodes the instruction encoded at the start of b, which
+//was located at addr in code memory
+func Decode(addr uint16, b []byte) (Instruction, error) {
+	if len(b) == 0 {
+		return Instruction{}, ErrCodeBounds
+	}
+	d := decodeTable[b[0]]
+	if len(b) < int(d.Len) {
+		return Instruction{}, ErrCodeBounds
+	}
+	in := Instruction{
+		Descriptor: d,
+		Address:    addr,
+		Bytes:      b[:d.Len],
+		Operands:   make([]Operand, len(d.Kinds)),
+	}
+	next := in.Next()
+	rest := in.Bytes[1:]
+	for i, k := range d.Kinds {
+		//MOV direct,direct is the one instruction which
+		//encodes its source ahead of its destination
+		j := i
+		if b[0] == 0x85 {
+			j = 1 - i
+		}
+		o := &in.Operands[j]
+		o.Kind = k
+		switch k {
+		case OperandReg:
+			o.Value = uint16(b[0] & 0x07)
+		case OperandInd:
+			o.Value = uint16(b[0] & 0x01)
+		case OperandImm, OperandDirect, OperandBit, OperandNotBit:
+			o.Value = uint16(rest[0])
+		case OperandRel:
+			o.Value = next + uint16(int8(rest[0]))
+		case OperandAddr11:
+			o.Value = next&0xF800 | uint16(b[0]&0xE0)<<3 | uint16(rest[0])
+		case OperandImm16, OperandAddr16:
+			o.Value = uint16(rest[0])<<8 | uint16(rest[1])
+		}
+		rest = rest[k.size():]
+	}
+	return in, nil
+}
+
+//ReadInstruction reads and decodes the instruction at offset in code
+//memory. ErrCodeBounds is returned if the instruction is cut short
+//by the end of code memory
+func ReadInstruction(c CodeMemory, offset int64) (Instruction, error) {
 
 	//max instruction size is 3
 	b := make([]byte, 3)
 
 	//suck in the first byte which contains the opcode
-	c.ReadAt(b[:1], offset) //TODO: handle read errors
+	if err := readCode(c, b[:1], offset); err != nil {
+		return Instruction{}, err
+	}
 
 	//decode the opcode and instruction length
 	d := decodeTable[b[0]]
 
 	//read in remainder of data if multibyte instruction
-	if d.len > 1 {
-		c.ReadAt(b[1:d.len-1], offset) //TODO: handle read errors
+	if d.Len > 1 {
+		if err := readCode(c, b[1:d.Len], offset+1); err != nil {
+			return Instruction{}, err
+		}
 	}
 
-	return d.op, b[:d.len], nil
+	return Decode(uint16(offset), b[:d.Len])
 }
 
-type Operation func(*CPU) error
-
-//convert opcode and extra data pair into a permutation function
-func DecodeInstruction(op OpCode, data []byte) Operation {
-	switch op {
-	case ANL:
-	case CJNE:
-	case CLR:
-	case CPL:
-	case DA:
-	case DEC:
-	case DIV:
-	case DJNZ:
-	case INC:
-	case JB:
-	case JBC:
-	case JC:
-	case JMP:
-	case JNB:
-	case JNC:
-	case JNZ:
-	case JZ:
-	case MOV:
-	case MOVC:
-	case MOVX:
-	case NOP:
-	case ORL:
-	case RL:
-	case RLC:
-	case RR:
-	case RRC:
-	case SJMP:
-	case SETB:
-	case SUBB:
-	case XCHD:
-	case XRL:
+//readCode fills b from code memory, a short read at the end
+//of code memory is reported as ErrCodeBounds
+func readCode(c CodeMemory, b []byte, offset int64) error {
+	n, err := c.ReadAt(b, offset)
+	if n == len(b) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return ErrCodeBounds
 	}
-	return nil
+	return err
 }
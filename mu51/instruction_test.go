@@ -0,0 +1,77 @@
+package mu51
+
+import (
+	"testing"
+)
+
+func TestDescriptorLengths(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		d := Lookup(uint8(i))
+		var l uint8 = 1
+		for _, k := range d.Kinds {
+			l += k.size()
+		}
+		if l != d.Len {
+			t.Errorf("opcode 0x%02X %s has length %d but operands need %d", i, d.Op, d.Len, l)
+		}
+		if d.Cycles != 1 && d.Cycles != 2 && d.Cycles != 4 {
+			t.Errorf("opcode 0x%02X has %d cycles", i, d.Cycles)
+		}
+	}
+}
+
+func TestDecodeOperands(t *testing.T) {
+	cases := []struct {
+		addr  uint16
+		code  []byte
+		op    OpCode
+		ops   []Operand
+		flags uint8
+	}{
+		{0, []byte{0x24, 0x10}, ADD, []Operand{{OperandA, 0}, {OperandImm, 0x10}}, arithFlags},
+		{0, []byte{0x25, 0x10}, ADD, []Operand{{OperandA, 0}, {OperandDirect, 0x10}}, arithFlags},
+		{0, []byte{0x27}, ADD, []Operand{{OperandA, 0}, {OperandInd, 1}}, arithFlags},
+		{0, []byte{0x2D}, ADD, []Operand{{OperandA, 0}, {OperandReg, 5}}, arithFlags},
+		{0, []byte{0x85, 0x30, 0xE0}, MOV, []Operand{{OperandDirect, 0xE0}, {OperandDirect, 0x30}}, 0},
+		{0, []byte{0x75, 0x30, 0xE0}, MOV, []Operand{{OperandDirect, 0x30}, {OperandImm, 0xE0}}, 0},
+		{0, []byte{0x90, 0x12, 0x34}, MOV, []Operand{{OperandDPTR, 0}, {OperandImm16, 0x1234}}, 0},
+		{0x0100, []byte{0x80, 0xFE}, SJMP, []Operand{{OperandRel, 0x0100}}, 0},
+		{0x0100, []byte{0x20, 0xD7, 0x10}, JB, []Operand{{OperandBit, 0xD7}, {OperandRel, 0x0113}}, 0},
+		{0x07FE, []byte{0xB1, 0x23}, ACALL, []Operand{{OperandAddr11, 0x0D23}}, 0},
+		{0, []byte{0x02, 0xAB, 0xCD}, LJMP, []Operand{{OperandAddr16, 0xABCD}}, 0},
+		{0, []byte{0xB0, 0x22}, ANL, []Operand{{OperandC, 0}, {OperandNotBit, 0x22}}, CarryBit},
+		{0, []byte{0xBA, 0x05, 0x02}, CJNE, []Operand{{OperandReg, 2}, {OperandImm, 5}, {OperandRel, 0x0005}}, CarryBit},
+		{0, []byte{0x83}, MOVC, []Operand{{OperandA, 0}, {OperandAtAPC, 0}}, 0},
+		{0, []byte{0xF3}, MOVX, []Operand{{OperandInd, 1}, {OperandA, 0}}, 0},
+	}
+	for _, v := range cases {
+		in, err := Decode(v.addr, v.code)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if in.Op != v.op || in.Flags != v.flags || len(in.Operands) != len(v.ops) {
+			t.Errorf("0x%02X decoded as %s with %d operands", v.code[0], in.Op, len(in.Operands))
+			continue
+		}
+		for i := range v.ops {
+			if in.Operands[i] != v.ops[i] {
+				t.Errorf("0x%02X operand %d decoded as %v, expected %v", v.code[0], i, in.Operands[i], v.ops[i])
+			}
+		}
+	}
+}
+
+func TestReadInstructionBounds(t *testing.T) {
+	rom := testROM{0x00, 0x02, 0x12}
+	in, err := ReadInstruction(rom, 0)
+	if err != nil || in.Op != NOP || in.Next() != 1 {
+		t.Error("failed to read NOP")
+	}
+	if _, err := ReadInstruction(rom, 1); err != ErrCodeBounds {
+		t.Errorf("truncated LJMP returned %v", err)
+	}
+	if _, err := ReadInstruction(rom, 3); err != ErrCodeBounds {
+		t.Errorf("read past end returned %v", err)
+	}
+}
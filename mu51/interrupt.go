@@ -0,0 +1,163 @@
+package mu51
+
+//Interrupt sources of the standard 8051/8052 in their fixed polling
+//order, which is also the order of their IE and IP bits
+const (
+	IntExt0   = iota //external interrupt 0, IE0
+	IntTimer0        //timer 0 overflow, TF0
+	IntExt1          //external interrupt 1, IE1
+	IntTimer1        //timer 1 overflow, TF1
+	IntSerial        //serial port, RI or TI
+	IntTimer2        //timer 2, TF2 or EXF2
+	numInterrupts
+)
+
+//InterruptVector returns the code address an interrupt source vectors to
+func InterruptVector(src int) uint16 {
+	return 0x0003 + 8*uint16(src)
+}
+
+//eaMask is the global enable bit of IE
+const eaMask = 0x80
+
+//interruptRequests returns a mask of the raised interrupt
+//flags indexed by source
+func (c *CPU) interruptRequests() uint8 {
+	var req uint8
+	tcon := c.SFR(TCON)
+	if tcon&0x02 != 0 {
+		req |= 1 << IntExt0
+	}
+	if tcon&0x20 != 0 {
+		req |= 1 << IntTimer0
+	}
+	if tcon&0x08 != 0 {
+		req |= 1 << IntExt1
+	}
+	if tcon&0x80 != 0 {
+		req |= 1 << IntTimer1
+	}
+	if c.SFR(SCON)&0x03 != 0 {
+		req |= 1 << IntSerial
+	}
+	if c.hasTimer2() && c.SFR(T2CON)&0xC0 != 0 {
+		req |= 1 << IntTimer2
+	}
+	return req
+}
+
+//PendingInterrupt returns the source which would be serviced next,
+//taking account of the enables, priorities and any interrupt
+//already in progress
+func (c *CPU) PendingInterrupt() (int, bool) {
+	ie := c.SFR(IE)
+	if ie&eaMask == 0 || c.inService&2 != 0 {
+		return 0, false
+	}
+	active := c.interruptRequests() & ie
+	if active == 0 {
+		return 0, false
+	}
+	ip := c.SFR(IP)
+
+	//high priority sources may interrupt a low priority handler
+	for src := 0; src < numInterrupts; src++ {
+		if active&ip&(1<<uint(src)) != 0 {
+			return src, true
+		}
+	}
+	if c.inService != 0 {
+		return 0, false
+	}
+	for src := 0; src < numInterrupts; src++ {
+		if active&(1<<uint(src)) != 0 {
+			return src, true
+		}
+	}
+	return 0, false
+}
+
+//serviceInterrupt vectors to the pending interrupt if any, returning
+//whether it did. An interrupt is never serviced directly after RETI or
+//a write to IE or IP, at least one more instruction executes first.
+//The return address is pushed like a call so a stack which would fault
+//raises a FaultStack, a skipped entry leaves the interrupt pending
+func (c *CPU) serviceInterrupt() (bool, error) {
+	if c.holdoff {
+		c.holdoff = false
+		return false, nil
+	}
+	src, ok := c.PendingInterrupt()
+	if !ok {
+		return false, nil
+	}
+	if serr := c.stackError(2); serr != nil {
+		f := &Fault{Kind: FaultStack, PC: c.ProgCount, Addr: uint16(c.StackPtr()), Cycle: c.Cycles, Err: serr}
+		skip, err := c.raise(f)
+		if skip || err != nil {
+			return false, err
+		}
+	}
+
+	pc := c.ProgCount
+	if c.Observer != nil {
+		c.Observer.BeforeInterrupt(c, pc, src)
+	}
+
+	//timer overflow flags are cleared by hardware when vectoring, as
+	//are the external flags but only when they are edge triggered
+	tcon := c.SFR(TCON)
+	switch src {
+	case IntExt0:
+		if tcon&0x01 != 0 {
+			c.SetSFR(TCON, tcon&^0x02)
+		}
+	case IntTimer0:
+		c.SetSFR(TCON, tcon&^0x20)
+	case IntExt1:
+		if tcon&0x04 != 0 {
+			c.SetSFR(TCON, tcon&^0x08)
+		}
+	case IntTimer1:
+		c.SetSFR(TCON, tcon&^0x80)
+	}
+
+	if c.SFR(IP)&(1<<uint(src)) != 0 {
+		c.inService |= 2
+	} else {
+		c.inService |= 1
+	}
+	c.PushWord(pc)
+	c.ProgCount = InterruptVector(src)
+	c.advance(2)
+	if c.Observer != nil {
+		c.Observer.AfterInterrupt(c, pc, src)
+	}
+	return true, nil
+}
+
+//InServiceLevel returns the priority level of the interrupt handler
+//currently executing, 1 for high, 0 for low and -1 when none is
+func (c *CPU) InServiceLevel() int {
+	switch {
+	case c.inService&2 != 0:
+		return 1
+	case c.inService&1 != 0:
+		return 0
+	}
+	return -1
+}
+
+//InstrRETI executes a return from interrupt
+//it acts like a RET instruction but also ends the
+//highest priority interrupt in progress, allowing
+//interrupts of that level to be serviced again
+func (c *CPU) InstrRETI() {
+	c.ProgCount = c.PopWord()
+	if c.inService&2 != 0 {
+		c.inService &^= 2
+	} else {
+		c.inService &^= 1
+	}
+	c.holdoff = true
+}
@@ -0,0 +1,196 @@
+package mu51
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInterruptVectoring(t *testing.T) {
+	c := newTestCPU(0x1000, 0x00) //NOP
+	c.WriteDirect(IE, 0x82)       //EA ET0
+	c.WriteDirect(TCON, 0x20)     //TF0
+	c.holdoff = false
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0x000B {
+		t.Fatalf("expected timer 0 vector, got PC 0x%04X", c.ProgCount)
+	}
+	if c.StackPtr() != 0x09 || c.InternalRAM[0x08] != 0x00 || c.InternalRAM[0x09] != 0x10 {
+		t.Error("return address not pushed like LCALL")
+	}
+	if c.ReadDirect(TCON)&0x20 != 0 {
+		t.Error("TF0 not cleared when vectoring")
+	}
+	if c.Cycles != 2 || c.InServiceLevel() != 0 {
+		t.Errorf("cycles %d level %d after vectoring", c.Cycles, c.InServiceLevel())
+	}
+}
+
+func TestInterruptPollingOrder(t *testing.T) {
+	cases := []struct {
+		ie, ip, tcon, scon uint8
+		vector             uint16
+		taken              bool
+	}{
+		{0x8F, 0x00, 0x8A, 0x00, 0x0003, true},  //IE0 beats IE1 and TF1
+		{0x8F, 0x08, 0x8A, 0x00, 0x001B, true},  //high priority TF1 first
+		{0x90, 0x00, 0x00, 0x02, 0x0023, true},  //TI
+		{0x0F, 0x00, 0x8A, 0x00, 0x0000, false}, //EA clear
+		{0x8C, 0x00, 0x02, 0x00, 0x0000, false}, //EX0 clear
+	}
+	for i, v := range cases {
+		c := newTestCPU(0x1000, 0x00)
+		c.WriteDirect(IE, v.ie)
+		c.WriteDirect(IP, v.ip)
+		c.WriteDirect(TCON, v.tcon)
+		c.WriteDirect(SCON, v.scon)
+		c.holdoff = false
+		c.Step()
+		if v.taken && c.ProgCount != v.vector {
+			t.Errorf("case %d: expected vector 0x%04X, got PC 0x%04X", i, v.vector, c.ProgCount)
+		}
+		if !v.taken && c.ProgCount != 0x1001 {
+			t.Errorf("case %d: unexpected interrupt to 0x%04X", i, c.ProgCount)
+		}
+	}
+}
+
+func TestExternalFlagClearing(t *testing.T) {
+	for _, edge := range []bool{false, true} {
+		c := newTestCPU(0x1000, 0x00)
+		tcon := uint8(0x02)
+		if edge {
+			tcon |= 0x01 //IT0
+		}
+		c.WriteDirect(IE, 0x81)
+		c.WriteDirect(TCON, tcon)
+		c.holdoff = false
+		c.Step()
+		if c.ProgCount != 0x0003 {
+			t.Fatalf("INT0 not serviced, PC 0x%04X", c.ProgCount)
+		}
+		if cleared := c.ReadDirect(TCON)&0x02 == 0; cleared != edge {
+			t.Errorf("edge triggered %t: IE0 cleared %t", edge, cleared)
+		}
+	}
+}
+
+func TestInterruptNesting(t *testing.T) {
+	rom := make(testROM, 0x10000)
+	rom[0x0003] = 0x00 //INT0 handler: NOP
+	rom[0x000B] = 0x00 //timer 0 handler: NOP
+	rom[0x000C] = 0x32 //RETI
+	rom[0x1000] = 0x00
+	c := &CPU{ALU: &ALU{}, ProgMem: rom}
+	c.ProgCount = 0x1000
+	c.SetStackPtr(0x07)
+	c.WriteDirect(IE, 0x83) //EA ET0 EX0
+	c.WriteDirect(IP, 0x01) //PX0
+	c.WriteDirect(TCON, 0x20)
+	c.holdoff = false
+
+	//low priority timer 0 is serviced
+	c.Step()
+	if c.ProgCount != 0x000B || c.InServiceLevel() != 0 {
+		t.Fatalf("timer 0 not serviced, PC 0x%04X", c.ProgCount)
+	}
+
+	//a second low priority request must wait for the handler
+	c.SetSFR(TCON, 0x20)
+	c.Step()
+	if c.ProgCount != 0x000C {
+		t.Fatalf("low priority interrupt nested inside a low priority handler, PC 0x%04X", c.ProgCount)
+	}
+
+	//RETI returns, then the pending request waits one instruction
+	c.Step()
+	if c.ProgCount != 0x1000 || c.InServiceLevel() != -1 {
+		t.Fatalf("RETI returned to 0x%04X level %d", c.ProgCount, c.InServiceLevel())
+	}
+	c.Step()
+	if c.ProgCount != 0x1001 {
+		t.Fatalf("interrupt serviced directly after RETI, PC 0x%04X", c.ProgCount)
+	}
+	c.Step()
+	if c.ProgCount != 0x000B {
+		t.Fatalf("pending interrupt not serviced after RETI, PC 0x%04X", c.ProgCount)
+	}
+
+	//high priority INT0 preempts the low priority handler
+	c.SetSFR(TCON, 0x02)
+	c.Step()
+	if c.ProgCount != 0x0003 || c.InServiceLevel() != 1 {
+		t.Fatalf("high priority did not preempt, PC 0x%04X", c.ProgCount)
+	}
+
+	//nothing preempts a high priority handler
+	c.SetSFR(TCON, 0x22)
+	c.Step()
+	if c.ProgCount != 0x0004 {
+		t.Errorf("interrupt nested inside a high priority handler, PC 0x%04X", c.ProgCount)
+	}
+}
+
+func TestIEWriteHoldoff(t *testing.T) {
+	c := newTestCPU(0x1000,
+		0x75, 0xA8, 0x82, //MOV IE,#82h
+		0x00, //NOP
+	)
+	c.WriteDirect(TCON, 0x20)
+	c.Step()
+	c.Step()
+	if c.ProgCount != 0x1004 {
+		t.Fatalf("interrupt serviced directly after IE write, PC 0x%04X", c.ProgCount)
+	}
+	c.Step()
+	if c.ProgCount != 0x000B {
+		t.Errorf("interrupt not serviced, PC 0x%04X", c.ProgCount)
+	}
+}
+
+//observed records the calls made to an Observer
+type observed []string
+
+func (o *observed) BeforeInstruction(c *CPU, pc uint16, in Instruction) {
+	*o = append(*o, fmt.Sprintf("before %04X", pc))
+}
+
+func (o *observed) AfterInstruction(c *CPU, pc uint16, in Instruction, err error) {
+	*o = append(*o, fmt.Sprintf("after %04X", pc))
+}
+
+func (o *observed) BeforeInterrupt(c *CPU, pc uint16, src int) {
+	*o = append(*o, fmt.Sprintf("interrupt %d at %04X SP=%02X", src, pc, c.StackPtr()))
+}
+
+func (o *observed) AfterInterrupt(c *CPU, pc uint16, src int) {
+	*o = append(*o, fmt.Sprintf("vectored %d to %04X SP=%02X", src, c.ProgCount, c.StackPtr()))
+}
+
+func TestInterruptObserved(t *testing.T) {
+	var o observed
+	c := newTestCPU(0x1000, 0x00) //NOP
+	c.Observer = &o
+	var writes int
+	c.OnAccess = func(a Access) {
+		if a.Write && a.Space == SpaceIRAM {
+			writes++
+		}
+	}
+	c.SetSFR(IE, 0x82)   //EA and ET0
+	c.SetSFR(TCON, 0x20) //TF0
+	for i := 0; i < 2; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := observed{"interrupt 1 at 1000 SP=07", "vectored 1 to 000B SP=09", "before 000B", "after 000B"}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("observed %q", o)
+	}
+	if writes != 2 {
+		t.Errorf("vectoring made %d stack writes", writes)
+	}
+}
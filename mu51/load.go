@@ -0,0 +1,94 @@
+package mu51
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/JonathanFraser/go51/ihex"
+)
+
+//ErrImageTooLarge is returned when a hex file holds data beyond the
+//end of the memory it is loaded into
+var ErrImageTooLarge = errors.New("image does not fit in memory")
+
+//DefaultFill is the value of unprogrammed code memory, as left by an
+//erased eprom or flash
+const DefaultFill = 0xFF
+
+//HexImage flattens a parsed hex file into size bytes of memory, any
+//location the file does not program is set to fill
+func HexImage(f ihex.File, size int, fill byte) (Memory, error) {
+	if f.Size() > int64(size) {
+		return nil, ErrImageTooLarge
+	}
+	m := make(Memory, size)
+	f.Retrieve(0, m, fill)
+	return m, nil
+}
+
+//LoadHex parses an intel hex stream into size bytes of memory
+func LoadHex(r io.Reader, size int, fill byte) (Memory, error) {
+	f, err := ihex.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return HexImage(f, size, fill)
+}
+
+//InitRAM writes the data records of a parsed hex file into ram,
+//locations the file does not program keep their contents
+func InitRAM(ram RAM, f ihex.File) error {
+	for _, rec := range f.Memory {
+		if int64(rec.Offset)+int64(len(rec.Data)) > ram.Size() {
+			return ErrImageTooLarge
+		}
+		if _, err := ram.WriteAt(rec.Data, int64(rec.Offset)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//parseHexFile parses the intel hex file at path
+func parseHexFile(path string) (ihex.File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return ihex.File{}, err
+	}
+	defer fd.Close()
+	return ihex.Parse(fd)
+}
+
+//LoadHexFile replaces the code memory with the intel hex file at path.
+//The memory is sized to the code memory of the profile, or the full
+//64KiB without one, and unprogrammed locations read as DefaultFill
+func (c *CPU) LoadHexFile(path string) error {
+	f, err := parseHexFile(path)
+	if err != nil {
+		return err
+	}
+	size := 0x10000
+	if c.Profile != nil && c.Profile.CodeSize > 0 {
+		size = c.Profile.CodeSize
+	}
+	m, err := HexImage(f, size, DefaultFill)
+	if err != nil {
+		return err
+	}
+	c.ProgMem = m
+	return nil
+}
+
+//LoadXDATAFile initializes external ram from the intel hex file at path,
+//a full 64KiB of ram is attached first if there is none
+func (c *CPU) LoadXDATAFile(path string) error {
+	f, err := parseHexFile(path)
+	if err != nil {
+		return err
+	}
+	if c.ExtRAM == nil {
+		c.ExtRAM = make(Memory, 0x10000)
+	}
+	return InitRAM(c.ExtRAM, f)
+}
@@ -0,0 +1,75 @@
+package mu51
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JonathanFraser/go51/ihex"
+)
+
+//blinkHex is MOV A,#5Ah at the reset vector and two bytes at 0010h
+const blinkHex = `:02000000745A30
+:020010001234A8
+:00000001FF
+`
+
+func TestLoadHex(t *testing.T) {
+	m, err := LoadHex(strings.NewReader(blinkHex), 0x20, DefaultFill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m[0] != 0x74 || m[1] != 0x5A || m[2] != 0xFF || m[0x10] != 0x12 || m[0x11] != 0x34 {
+		t.Errorf("image % X", []byte(m))
+	}
+	if _, err := m.ReadAt(make([]byte, 2), 0x1F); err == nil {
+		t.Error("read past the end of the image succeeded")
+	}
+	if _, err := LoadHex(strings.NewReader(blinkHex), 0x10, 0); err != ErrImageTooLarge {
+		t.Errorf("oversized image gave %v", err)
+	}
+}
+
+func TestLoadHexFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mu51")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blink.hex")
+	if err := ioutil.WriteFile(path, []byte(blinkHex), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := Profile8051.NewCPU(nil)
+	if err := c.LoadHexFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgMem.Size() != 0x1000 {
+		t.Errorf("code memory of %d bytes", c.ProgMem.Size())
+	}
+	if err := c.Step(); err != nil || c.Accum() != 0x5A {
+		t.Errorf("loaded code not run, %v", err)
+	}
+
+	if err := c.LoadXDATAFile(path); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 2)
+	c.ExtRAM.ReadAt(b, 0x10)
+	if b[0] != 0x12 || b[1] != 0x34 {
+		t.Errorf("xdata initialized to % X", b)
+	}
+}
+
+func TestInitRAMBounds(t *testing.T) {
+	f, err := ihex.Parse(strings.NewReader(blinkHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRAM(make(Memory, 0x08), f); err != ErrImageTooLarge {
+		t.Errorf("oversized initializer gave %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package mu51
+
+import (
+	"io"
+)
+
+//Memory is a plain byte slice usable as either code memory or ram,
+//reads past the end return io.EOF and writes past the end are lost
+type Memory []byte
+
+//ReadAt copies memory starting at off into b
+func (m Memory) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(m)) {
+		return 0, io.EOF
+	}
+	n := copy(b, m[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+//WriteAt copies b into memory starting at off
+func (m Memory) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(m)) {
+		return 0, io.EOF
+	}
+	n := copy(m[off:], b)
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+//Size returns the length of the memory in bytes
+func (m Memory) Size() int64 {
+	return int64(len(m))
+}
@@ -0,0 +1,21 @@
+package mu51
+
+//Observer is notified around every instruction Step executes and every
+//interrupt it vectors to, such as to record a trace. Instructions
+//skipped by a fault policy are not reported
+type Observer interface {
+	//BeforeInstruction is called once the instruction at pc has been
+	//fetched, before it executes
+	BeforeInstruction(c *CPU, pc uint16, in Instruction)
+
+	//AfterInstruction is called once it has executed, with the error
+	//Step will return
+	AfterInstruction(c *CPU, pc uint16, in Instruction, err error)
+
+	//BeforeInterrupt is called once the interrupt from src has been
+	//accepted, before the return address pc is pushed
+	BeforeInterrupt(c *CPU, pc uint16, src int)
+
+	//AfterInterrupt is called once the CPU has vectored to its handler
+	AfterInterrupt(c *CPU, pc uint16, src int)
+}
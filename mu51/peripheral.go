@@ -0,0 +1,27 @@
+package mu51
+
+//Peripheral is an on chip device clocked alongside the CPU core
+type Peripheral interface {
+	//Attach connects the peripheral to the CPU, installing any
+	//special function register callbacks it needs
+	Attach(c *CPU)
+
+	//Tick advances the peripheral by a single machine cycle
+	Tick(c *CPU)
+}
+
+//AddPeripheral attaches p and clocks it from then on
+func (c *CPU) AddPeripheral(p Peripheral) {
+	p.Attach(c)
+	c.Peripherals = append(c.Peripherals, p)
+}
+
+//pinLevel returns the level of a port pin as seen by the on chip
+//peripherals, port is the SFR address of the port latch. Without a
+//port model reading the pins, such as Ports, the latch is used
+func (c *CPU) pinLevel(port uint8, bit uint) bool {
+	if read := c.ReadCallbacks[port]; read != nil {
+		return read()&(1<<bit) != 0
+	}
+	return c.SFR(port)&(1<<bit) != 0
+}
@@ -0,0 +1,207 @@
+package mu51
+
+import (
+	"time"
+)
+
+//PinEvent records a change in the level of a port pin
+type PinEvent struct {
+	Port  int  //port number 0-3
+	Pin   int  //pin number 0-7
+	Level bool //new level of the pin
+	Cycle uint64
+	Time  time.Duration //simulated time of the change
+}
+
+//Ports models the pins of ports P0-P3. The latches stay in the port
+//special function registers while the pins combine them with any
+//external drive. P1-P3 are quasi-bidirectional, a latch of 0 pulls the
+//pin low and a latch of 1 is a weak pull-up which external devices may
+//pull low. P0 is open drain, a latch of 1 leaves the pin floating.
+//Read-modify-write instructions read the latches, all other reads see
+//the pins. Ports is not safe for use from multiple goroutines
+type Ports struct {
+	//OnChange, when set, is called for every pin which changes level
+	OnChange func(PinEvent)
+
+	c        *CPU
+	driven   [4]uint8 //mask of pins driven externally
+	drive    [4]uint8 //level driven onto those pins
+	last     [4]uint8 //pin levels at the last change notification
+	watchers map[int][]func(PinEvent)
+	pending  []scheduledDrive
+}
+
+//scheduledDrive is a change to an external drive due at a given cycle
+type scheduledDrive struct {
+	cycle     uint64
+	port, pin int
+	level     bool
+	release   bool
+}
+
+//portAddr maps a port number onto the SFR address of its latch
+var portAddr = [4]uint8{P0, P1, P2, P3}
+
+//isPort reports whether addr is the SFR of one of the four ports
+func isPort(addr uint8) bool {
+	return addr&0xCF == 0x80
+}
+
+//Attach installs the port callbacks, reads return the pin levels
+//while writes update the latches
+func (p *Ports) Attach(c *CPU) {
+	p.c = c
+	for n, addr := range portAddr {
+		n, addr := n, addr
+		c.ReadCallbacks[addr] = func() uint8 {
+			return p.Levels(n)
+		}
+		c.WriteCallbacks[addr] = func(val uint8) {
+			c.SetSFR(addr, val)
+			p.notify(n)
+		}
+		p.last[n] = p.Levels(n)
+	}
+}
+
+//Reset reports the pins which changed as the latches returned high
+func (p *Ports) Reset(c *CPU) {
+	for n := range portAddr {
+		p.notify(n)
+	}
+}
+
+//Tick applies any scheduled drive changes which have fallen due,
+//the new levels are seen by peripherals sampling in the same cycle.
+//Changes scheduled by a watcher while they are applied are kept for
+//the following ticks
+func (p *Ports) Tick(c *CPU) {
+	due := p.pending
+	p.pending = nil
+	for _, d := range due {
+		switch {
+		case d.cycle > c.Cycles:
+			p.pending = append(p.pending, d)
+		case d.release:
+			p.Release(d.port, d.pin)
+		default:
+			p.Drive(d.port, d.pin, d.level)
+		}
+	}
+}
+
+//Levels returns the levels of all eight pins of a port, floating
+//pins of P0 read as high
+func (p *Ports) Levels(port int) uint8 {
+	latch := p.c.SFR(portAddr[port])
+	return latch & (^p.driven[port] | p.drive[port])
+}
+
+//Pin returns the level of a single pin
+func (p *Ports) Pin(port, pin int) bool {
+	return p.Levels(port)&(1<<uint(pin)) != 0
+}
+
+//Latch returns the output latch of a port
+func (p *Ports) Latch(port int) uint8 {
+	return p.c.SFR(portAddr[port])
+}
+
+//Floating reports whether a pin of the open drain P0 is neither
+//pulled low by its latch nor driven externally
+func (p *Ports) Floating(port, pin int) bool {
+	mask := uint8(1) << uint(pin)
+	return port == 0 && p.Latch(0)&mask != 0 && p.driven[0]&mask == 0
+}
+
+//Drive drives a pin from outside the chip, a pin whose latch is 0
+//remains low whatever is driven onto it
+func (p *Ports) Drive(port, pin int, level bool) {
+	mask := uint8(1) << uint(pin)
+	p.driven[port] |= mask
+	if level {
+		p.drive[port] |= mask
+	} else {
+		p.drive[port] &^= mask
+	}
+	p.notify(port)
+}
+
+//Release stops driving a pin, leaving it to its latch and pull-up
+func (p *Ports) Release(port, pin int) {
+	mask := uint8(1) << uint(pin)
+	p.driven[port] &^= mask
+	p.drive[port] &^= mask
+	p.notify(port)
+}
+
+//DriveAt schedules Drive to take place during the given machine cycle
+func (p *Ports) DriveAt(cycle uint64, port, pin int, level bool) {
+	p.pending = append(p.pending, scheduledDrive{cycle: cycle, port: port, pin: pin, level: level})
+}
+
+//ReleaseAt schedules Release to take place during the given machine cycle
+func (p *Ports) ReleaseAt(cycle uint64, port, pin int) {
+	p.pending = append(p.pending, scheduledDrive{cycle: cycle, port: port, pin: pin, release: true})
+}
+
+//Pulse drives a pin low for width machine cycles starting at the
+//given cycle, then releases it to its pull-up
+func (p *Ports) Pulse(cycle uint64, port, pin int, width uint64) {
+	p.DriveAt(cycle, port, pin, false)
+	p.ReleaseAt(cycle+width, port, pin)
+}
+
+//Watch calls fn whenever the level of a pin changes
+func (p *Ports) Watch(port, pin int, fn func(PinEvent)) {
+	if p.watchers == nil {
+		p.watchers = make(map[int][]func(PinEvent))
+	}
+	key := port*8 + pin
+	p.watchers[key] = append(p.watchers[key], fn)
+}
+
+//notify reports any pins of a port which changed level
+func (p *Ports) notify(port int) {
+	levels := p.Levels(port)
+	changed := levels ^ p.last[port]
+	p.last[port] = levels
+	for pin := 0; pin < 8 && changed != 0; pin++ {
+		mask := uint8(1) << uint(pin)
+		if changed&mask == 0 {
+			continue
+		}
+		ev := PinEvent{
+			Port:  port,
+			Pin:   pin,
+			Level: levels&mask != 0,
+			Cycle: p.c.Cycles,
+			Time:  p.c.Elapsed(),
+		}
+		if p.OnChange != nil {
+			p.OnChange(ev)
+		}
+		for _, fn := range p.watchers[port*8+pin] {
+			fn(ev)
+		}
+	}
+}
+
+//readModifyWrite reports whether an instruction reads a port through
+//its latch, as do those which read a byte or bit and write it back
+func readModifyWrite(in Instruction) bool {
+	if len(in.Operands) == 0 {
+		return false
+	}
+	dst := in.Operands[0].Kind
+	switch in.Op {
+	case ANL, ORL, XRL, INC, DEC, DJNZ:
+		return dst == OperandDirect
+	case CPL, CLR, SETB, MOV:
+		return dst == OperandBit
+	case JBC:
+		return true
+	}
+	return false
+}
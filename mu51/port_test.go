@@ -0,0 +1,134 @@
+package mu51
+
+import (
+	"testing"
+)
+
+//newPortCPU returns a cpu with all port latches high and a Ports model
+func newPortCPU(code ...byte) (*CPU, *Ports) {
+	c := newTestCPU(0x1000, code...)
+	for _, addr := range portAddr {
+		c.SetSFR(addr, 0xFF)
+	}
+	p := &Ports{}
+	c.AddPeripheral(p)
+	return c, p
+}
+
+func TestPortPinLevels(t *testing.T) {
+	c, p := newPortCPU()
+	p.Drive(1, 3, false)
+	if c.ReadDirect(P1) != 0xF7 || p.Latch(1) != 0xFF {
+		t.Errorf("driven low pin read 0x%02X latch 0x%02X", c.ReadDirect(P1), p.Latch(1))
+	}
+
+	//a low latch wins over an external high
+	c.WriteDirect(P1, 0xFE)
+	p.Drive(1, 0, true)
+	if p.Pin(1, 0) {
+		t.Error("pin with a low latch read high")
+	}
+	p.Release(1, 3)
+	if c.ReadDirect(P1) != 0xFE {
+		t.Errorf("released pins read 0x%02X", c.ReadDirect(P1))
+	}
+
+	//P0 is open drain
+	if !p.Floating(0, 5) || p.Floating(1, 5) {
+		t.Error("only undriven P0 pins should float")
+	}
+	p.Drive(0, 5, true)
+	if p.Floating(0, 5) {
+		t.Error("driven P0 pin reported floating")
+	}
+}
+
+func TestPortReadModifyWrite(t *testing.T) {
+	c, p := newPortCPU(
+		0x53, 0x90, 0xFF, //ANL P1,#0FFh
+		0xB2, 0x91, //CPL P1.1
+		0xE5, 0x90, //MOV A,P1
+		0xA2, 0x90, //MOV C,P1.0
+	)
+	p.Drive(1, 0, false)
+	for i := 0; i < 4; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.Latch(1) != 0xFD {
+		t.Errorf("read-modify-write used the pins, latch 0x%02X", p.Latch(1))
+	}
+	if c.Accum() != 0xFC {
+		t.Errorf("MOV read 0x%02X rather than the pins", c.Accum())
+	}
+	if c.Carry() {
+		t.Error("MOV C,bit read the latch rather than the pin")
+	}
+}
+
+func TestPortWatch(t *testing.T) {
+	c, p := newPortCPU(
+		0x00,             //NOP
+		0x75, 0x90, 0x0F, //MOV P1,#0Fh
+	)
+	var events []PinEvent
+	p.Watch(1, 7, func(ev PinEvent) {
+		events = append(events, ev)
+	})
+	var all int
+	p.OnChange = func(PinEvent) {
+		all++
+	}
+	c.Step()
+	c.Step()
+	if len(events) != 1 || events[0].Level || events[0].Cycle != 1 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events[0].Time != c.CycleTime() {
+		t.Errorf("event at %s, expected %s", events[0].Time, c.CycleTime())
+	}
+	if all != 4 {
+		t.Errorf("expected 4 pin changes, got %d", all)
+	}
+	p.Drive(1, 7, true)
+	if len(events) != 1 {
+		t.Error("driving a pin held low by its latch reported a change")
+	}
+}
+
+func TestPortWatcherSchedules(t *testing.T) {
+	c, p := newPortCPU(0x00, 0x00, 0x00, 0x00, 0x00, 0x00) //NOPs
+	var levels []bool
+	//a device answering the pin going low by releasing it two cycles later
+	p.Watch(1, 0, func(ev PinEvent) {
+		levels = append(levels, ev.Level)
+		if !ev.Level {
+			p.ReleaseAt(ev.Cycle+2, 1, 0)
+		}
+	})
+	p.DriveAt(1, 1, 0, false)
+	p.DriveAt(20, 1, 5, false)
+	for i := 0; i < 6; i++ {
+		c.Step()
+	}
+	if len(levels) != 2 || levels[0] || !levels[1] || !p.Pin(1, 0) {
+		t.Errorf("scheduled release from a watcher lost, levels %v", levels)
+	}
+	if len(p.pending) != 1 || p.pending[0].pin != 5 {
+		t.Errorf("pending drives %+v", p.pending)
+	}
+}
+
+func TestPortTimerGate(t *testing.T) {
+	//the timer GATE input follows the pin, not the latch
+	c, p := newPortCPU()
+	c.SetSFR(TMOD, 0x09)
+	c.SetSFR(TCON, 0x10)
+	c.AddPeripheral(&Timer01{})
+	p.Drive(3, 2, false)
+	c.advance(2)
+	if c.SFR(TL0) != 0 {
+		t.Error("timer ran with INT0 driven low")
+	}
+}
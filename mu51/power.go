@@ -0,0 +1,125 @@
+package mu51
+
+import (
+	"errors"
+	"time"
+)
+
+//ErrPowerDown is returned while the CPU is in power down mode with
+//nothing able to wake it
+var ErrPowerDown = errors.New("cpu is powered down")
+
+//power control bits of PCON
+const (
+	pconIDL = 0x01
+	pconPD  = 0x02
+)
+
+//PowerState is the operating mode selected by PCON
+type PowerState int
+
+const (
+	//PowerActive is normal execution
+	PowerActive PowerState = iota
+
+	//PowerIdle halts the core while peripherals and interrupts run,
+	//any serviced interrupt ends idle mode
+	PowerIdle
+
+	//PowerDown stops the oscillator, only a reset or on derivatives
+	//which allow it an enabled external interrupt restarts it
+	PowerDown
+)
+
+//PowerStats accumulates the time spent in each power state. The
+//oscillator is stopped in power down mode so Cycles does not advance,
+//instead each Step made while powered down counts as a machine cycle
+//of time in PowerDown
+type PowerStats struct {
+	Active     uint64 //machine cycles spent executing
+	Idle       uint64 //machine cycles spent in idle mode
+	PowerDown  uint64 //machine cycles of time spent in power down mode
+	PowerDowns uint64 //number of times power down mode was entered
+}
+
+//PowerState returns the power mode selected by PCON
+func (c *CPU) PowerState() PowerState {
+	pcon := c.SFR(PCON)
+	switch {
+	case pcon&pconPD != 0:
+		return PowerDown
+	case pcon&pconIDL != 0:
+		return PowerIdle
+	}
+	return PowerActive
+}
+
+//ActiveTime returns the simulated time spent executing
+func (c *CPU) ActiveTime() time.Duration {
+	return time.Duration(c.Power.Active) * c.CycleTime()
+}
+
+//IdleTime returns the simulated time spent in idle mode
+func (c *CPU) IdleTime() time.Duration {
+	return time.Duration(c.Power.Idle) * c.CycleTime()
+}
+
+//PowerDownTime returns the simulated time spent in power down mode,
+//which is not part of Elapsed as the clock was stopped
+func (c *CPU) PowerDownTime() time.Duration {
+	return time.Duration(c.Power.PowerDown) * c.CycleTime()
+}
+
+//idleUntil clocks the peripherals of an idle CPU until an interrupt
+//is pending or end cycles have passed, returning whether idle ended
+func (c *CPU) idleUntil(end uint64) bool {
+	c.idling = true
+	defer func() { c.idling = false }()
+	for {
+		if _, ok := c.PendingInterrupt(); ok {
+			c.SetSFR(PCON, c.SFR(PCON)&^pconIDL)
+			return true
+		}
+		if c.Cycles >= end {
+			return false
+		}
+		c.advance(1)
+	}
+}
+
+//wake attempts to leave power down mode through an enabled external
+//interrupt whose pin is held low, latching its request flag
+func (c *CPU) wake() bool {
+	if !c.WakeFromPowerDown {
+		return false
+	}
+	ie := c.SFR(IE)
+	if ie&eaMask == 0 {
+		return false
+	}
+	for n := uint(0); n < 2; n++ {
+		if ie&(1<<(2*n)) != 0 && !c.pinLevel(P3, 2+n) {
+			c.SetSFR(TCON, c.SFR(TCON)|0x02<<(2*n))
+			c.SetSFR(PCON, c.SFR(PCON)&^(pconPD|pconIDL))
+			c.poweredDown = false
+			return true
+		}
+	}
+	return false
+}
+
+//Run steps the CPU until at least cycles machine cycles have passed.
+//Time spent in idle mode is fast-forwarded by clocking the peripherals
+//alone. Run stops early on any error, including ErrPowerDown
+func (c *CPU) Run(cycles uint64) error {
+	end := c.Cycles + cycles
+	for c.Cycles < end {
+		if c.PowerState() == PowerIdle && !c.idleUntil(end) {
+			return nil
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
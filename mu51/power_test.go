@@ -0,0 +1,112 @@
+package mu51
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleWakesOnInterrupt(t *testing.T) {
+	c := newTestCPU(0x1000,
+		0x43, 0x87, 0x01, //ORL PCON,#01h
+		0x00, //NOP
+	)
+	c.SetSFR(TMOD, 0x01)
+	c.SetSFR(TH0, 0xFF)
+	c.SetSFR(TL0, 0x9C) //overflows after 100 cycles
+	c.SetSFR(TCON, 0x10)
+	c.SetSFR(IE, 0x82)
+	c.AddPeripheral(&Timer01{})
+
+	if err := c.Step(); err != nil || c.PowerState() != PowerIdle {
+		t.Fatalf("idle not entered: %v", err)
+	}
+	c.Step()
+	if c.ProgCount != 0x1003 || c.Cycles != 3 {
+		t.Fatalf("idle step executed code, PC 0x%04X cycles %d", c.ProgCount, c.Cycles)
+	}
+
+	if err := c.Run(97); err != nil {
+		t.Fatal(err)
+	}
+	if c.ProgCount != 0x000B || c.PowerState() != PowerActive {
+		t.Fatalf("timer interrupt did not end idle, PC 0x%04X", c.ProgCount)
+	}
+	if c.Power.Idle != 98 || c.Power.Active != 4 {
+		t.Errorf("power stats %+v", c.Power)
+	}
+	if c.IdleTime() != 98*c.CycleTime() {
+		t.Errorf("idle time %s", c.IdleTime())
+	}
+}
+
+func TestRunFastForwardsIdle(t *testing.T) {
+	c := newTestCPU(0x1000, 0x43, 0x87, 0x01) //ORL PCON,#01h
+	if err := c.Run(1000); err != nil {
+		t.Fatal(err)
+	}
+	if c.Cycles != 1000 || c.Power.Idle != 998 || c.ProgCount != 0x1003 {
+		t.Errorf("cycles %d stats %+v PC 0x%04X", c.Cycles, c.Power, c.ProgCount)
+	}
+}
+
+func TestPowerDown(t *testing.T) {
+	c, p := newPortCPU(0x43, 0x87, 0x02) //ORL PCON,#02h
+	c.SetSFR(IE, 0x81)
+	c.Step()
+	if err := c.Run(100); err != ErrPowerDown {
+		t.Fatalf("expected ErrPowerDown, got %v", err)
+	}
+	if c.Step() != ErrPowerDown || c.Cycles != 2 || c.Power.PowerDowns != 1 {
+		t.Fatalf("power down ran the clock, cycles %d stats %+v", c.Cycles, c.Power)
+	}
+
+	//a low INT0 only wakes derivatives which allow it
+	p.Drive(3, 2, false)
+	if c.Step() != ErrPowerDown {
+		t.Fatal("woke from power down without WakeFromPowerDown")
+	}
+	c.WakeFromPowerDown = true
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.PowerState() != PowerActive || c.ProgCount != 0x0003 {
+		t.Errorf("external interrupt did not wake, PC 0x%04X", c.ProgCount)
+	}
+}
+
+func TestPowerStatsAddUp(t *testing.T) {
+	c, p := newPortCPU(
+		0x43, 0x87, 0x01, //ORL PCON,#01h
+		0x43, 0x87, 0x02, //ORL PCON,#02h
+		0x00, //NOP
+	)
+	c.SetSFR(IE, 0x81) //EA and EX0
+	c.WakeFromPowerDown = true
+	c.Step()
+	for i := 0; i < 10; i++ {
+		c.Step()
+	}
+	c.SetSFR(PCON, 0) //leave idle as an interrupt would
+	c.Step()
+	for i := 0; i < 5; i++ {
+		if err := c.Step(); err != ErrPowerDown {
+			t.Fatalf("expected ErrPowerDown, got %v", err)
+		}
+	}
+	p.Drive(3, 2, false)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := PowerStats{Active: 6, Idle: 10, PowerDown: 5, PowerDowns: 1}
+	if c.Power != want {
+		t.Errorf("power stats %+v, expected %+v", c.Power, want)
+	}
+	if c.Power.Active+c.Power.Idle != c.Cycles {
+		t.Errorf("active and idle cycles %d do not add up to %d", c.Power.Active+c.Power.Idle, c.Cycles)
+	}
+	total := c.ActiveTime() + c.IdleTime() + c.PowerDownTime()
+	if total != time.Duration(c.Cycles+c.Power.PowerDown)*c.CycleTime() {
+		t.Errorf("times add up to %s over %d cycles and %d powered down", total, c.Cycles, c.Power.PowerDown)
+	}
+}
@@ -0,0 +1,313 @@
+package mu51
+
+import (
+	"sort"
+	"strings"
+)
+
+//Profile describes an 8051 derivative, the resources it has on chip and
+//how fast its core runs, so that the same CPU can emulate each part.
+//Only the features shared with the 8051 and 8052 are modelled, registers
+//unique to a derivative are named but behave as plain storage
+type Profile struct {
+	Name           string
+	IRAMSize       int     //bytes of internal ram, 128 or 256
+	XRAMSize       int     //bytes of on chip ram reached with MOVX
+	CodeSize       int     //bytes of on chip code memory
+	ClocksPerCycle int     //oscillator clocks per machine cycle
+	OscillatorHz   float64 //typical oscillator frequency
+	Timer2         bool    //an 8052 compatible timer 2 is present
+	UARTs          int     //serial ports, only the first is modelled
+
+	DataPointers *DataPointers //extra data pointers, nil for a single DPTR
+
+	//SFRs names the registers the part adds to the standard set
+	SFRs        map[uint8]string
+	ResetValues ResetTable
+
+	WakeFromPowerDown bool //external interrupts end power down mode
+}
+
+//timer2SFRs are the registers of the 8052 timer 2
+var timer2SFRs = []uint8{T2CON, T2MOD, RCAP2L, RCAP2H, TL2, TH2}
+
+//isTimer2SFR reports whether addr is one of the timer 2 registers
+func isTimer2SFR(addr uint8) bool {
+	for _, v := range timer2SFRs {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+//HasSFR reports whether the part implements the special function
+//register at the direct address addr
+func (p *Profile) HasSFR(addr uint8) bool {
+	if _, ok := p.SFRs[addr]; ok {
+		return true
+	}
+	if isTimer2SFR(addr) {
+		return p.Timer2
+	}
+	_, ok := sfrNames[addr]
+	return ok
+}
+
+//absentSFR reports whether the special function register at addr is
+//missing from the part being emulated, reads of it return 0xFF and
+//writes are lost. A register with a callback installed is taken to be
+//modelled by a peripheral and is always present
+func (c *CPU) absentSFR(addr uint8) bool {
+	if c.Profile == nil || c.ReadCallbacks[addr] != nil || c.WriteCallbacks[addr] != nil {
+		return false
+	}
+	return !c.Profile.HasSFR(addr)
+}
+
+//hasTimer2 reports whether the timer 2 interrupt exists, it does
+//unless the profile being emulated lacks timer 2
+func (c *CPU) hasTimer2() bool {
+	return c.Profile == nil || c.Profile.Timer2
+}
+
+//inCode reports whether n bytes of code starting at addr lie within
+//the on chip code memory of the profile. Without a profile, or one
+//with no code size, code is bounded by ProgMem alone
+func (c *CPU) inCode(addr uint16, n int) bool {
+	if c.Profile == nil || c.Profile.CodeSize <= 0 {
+		return true
+	}
+	return int(addr)+n <= c.Profile.CodeSize
+}
+
+//SFRName returns the name of a special function register on this
+//part, including those the part adds to the standard set
+func (p *Profile) SFRName(addr uint8) (string, bool) {
+	if name, ok := p.SFRs[addr]; ok {
+		return name, true
+	}
+	if !p.HasSFR(addr) {
+		return "", false
+	}
+	return SFRName(addr)
+}
+
+//NewCPU returns a powered on CPU emulating the part and running code.
+//The on chip external ram, ports, external interrupts, timers and
+//serial port are attached as the part provides them. A nil code is
+//replaced by erased code memory of the part's code size, and larger
+//code memory is only fetched from up to that size
+func (p *Profile) NewCPU(code CodeMemory) *CPU {
+	if code == nil && p.CodeSize > 0 {
+		m := make(Memory, p.CodeSize)
+		for i := range m {
+			m[i] = DefaultFill
+		}
+		code = m
+	}
+	c := &CPU{
+		ALU:               &ALU{IRAMSize: p.IRAMSize, DPTRs: p.DataPointers},
+		ProgMem:           code,
+		ClocksPerCycle:    p.ClocksPerCycle,
+		OscillatorHz:      p.OscillatorHz,
+		ResetValues:       p.ResetValues,
+		WakeFromPowerDown: p.WakeFromPowerDown,
+		Profile:           p,
+	}
+	if p.XRAMSize > 0 {
+		c.ExtRAM = make(Memory, p.XRAMSize)
+	}
+	c.AddPeripheral(&Ports{})
+	c.AddPeripheral(&ExtInterrupts{})
+	t1 := &Timer01{}
+	c.AddPeripheral(t1)
+	var t2 *Timer2
+	if p.Timer2 {
+		t2 = &Timer2{}
+		c.AddPeripheral(t2)
+	}
+	if p.UARTs > 0 {
+		c.AddPeripheral(&Serial{Timer1: t1, Timer2: t2})
+	}
+	c.PowerOn()
+	return c
+}
+
+//Profile8051 is the original 8051 with 4KiB of code and 128 bytes of ram
+var Profile8051 = &Profile{
+	Name:           "8051",
+	IRAMSize:       128,
+	CodeSize:       0x1000,
+	ClocksPerCycle: 12,
+	OscillatorHz:   DefaultOscillatorHz,
+	UARTs:          1,
+	ResetValues:    Reset8051,
+}
+
+//Profile8052 adds timer 2, 8KiB of code and the upper 128 bytes of ram
+var Profile8052 = &Profile{
+	Name:           "8052",
+	IRAMSize:       256,
+	CodeSize:       0x2000,
+	ClocksPerCycle: 12,
+	OscillatorHz:   DefaultOscillatorHz,
+	Timer2:         true,
+	UARTs:          1,
+	ResetValues:    Reset8051,
+}
+
+//ProfileAT89S52 is the Atmel flash 8052 with its watchdog and second
+//data pointer registers
+var ProfileAT89S52 = &Profile{
+	Name:           "AT89S52",
+	IRAMSize:       256,
+	CodeSize:       0x2000,
+	ClocksPerCycle: 12,
+	OscillatorHz:   DefaultOscillatorHz,
+	Timer2:         true,
+	UARTs:          1,
+	DataPointers: &DataPointers{
+		Low: []uint8{DPL, 0x84}, High: []uint8{DPH, 0x85},
+		Select: 0xA2, SelectMask: 0x01, //AUXR1.DPS
+	},
+	SFRs: map[uint8]string{
+		0x84: "DP1L", 0x85: "DP1H", 0x8E: "AUXR", 0xA2: "AUXR1", 0xA6: "WDTRST",
+	},
+	//AUXR, AUXR1 and the second data pointer reset to zero and
+	//WDTRST is write only, leaving the standard reset state
+	ResetValues:       Reset8051,
+	WakeFromPowerDown: true,
+}
+
+//ProfileDS89C4x0 is the Maxim single cycle DS89C430/450 family, modelled
+//on the DS89C450 with 64KiB of flash and 1KiB of on chip MOVX ram
+var ProfileDS89C4x0 = &Profile{
+	Name:           "DS89C4x0",
+	IRAMSize:       256,
+	XRAMSize:       0x400,
+	CodeSize:       0x10000,
+	ClocksPerCycle: 1,
+	OscillatorHz:   33000000,
+	Timer2:         true,
+	UARTs:          2,
+	DataPointers: &DataPointers{
+		Low: []uint8{DPL, 0x84}, High: []uint8{DPH, 0x85},
+		Select: 0x86, SelectMask: 0x01, //DPS.SEL
+		Toggle:    0x20,                //DPS.TSL
+		AutoStep:  0x10,                //DPS.AID
+		Decrement: []uint8{0x40, 0x80}, //DPS.ID0 and DPS.ID1
+	},
+	SFRs: map[uint8]string{
+		0x84: "DPL1", 0x85: "DPH1", 0x86: "DPS", 0x8E: "CKCON", 0x96: "CKMOD",
+		0xC0: "SCON1", 0xC1: "SBUF1", 0xC2: "ROMSIZE", 0xC4: "PMR",
+		0xC5: "STATUS", 0xC7: "TA", 0xD8: "WDCON",
+	},
+	ResetValues: derivativeReset(ResetTable{
+		0x8E: 0x01, //CKCON, MOVX stretched by one cycle
+	}),
+	WakeFromPowerDown: true,
+}
+
+//ProfileC8051F3xx is the Silicon Labs pipelined C8051F3xx family,
+//modelled on the C8051F310. Its timers 2 and 3 are not 8052 compatible
+//so are left as plain registers
+var ProfileC8051F3xx = &Profile{
+	Name:           "C8051F3xx",
+	IRAMSize:       256,
+	XRAMSize:       0x400,
+	CodeSize:       0x4000,
+	ClocksPerCycle: 1,
+	OscillatorHz:   24500000,
+	UARTs:          1,
+	SFRs: map[uint8]string{
+		0x8E: "CKCON", 0x8F: "PSCTL", 0xA4: "P0MDOUT", 0xA5: "P1MDOUT",
+		0xB2: "OSCICN", 0xD9: "PCA0MD", 0xE1: "XBR0", 0xE2: "XBR1", 0xEF: "RSTSRC",
+		0xC8: "TMR2CN", 0xCA: "TMR2RLL", 0xCB: "TMR2RLH", 0xCC: "TMR2L", 0xCD: "TMR2H",
+	},
+	ResetValues: derivativeReset(ResetTable{
+		0xD9: 0x40, //PCA0MD, the watchdog is enabled out of reset
+	}),
+}
+
+//ProfileNRF24LE1 is the Nordic nRF24LE1 radio SoC with its single
+//cycle core, 16KiB of flash and 1KiB of MOVX ram
+var ProfileNRF24LE1 = &Profile{
+	Name:           "nRF24LE1",
+	IRAMSize:       256,
+	XRAMSize:       0x400,
+	CodeSize:       0x4000,
+	ClocksPerCycle: 1,
+	OscillatorHz:   16000000,
+	Timer2:         true,
+	UARTs:          1,
+	DataPointers: &DataPointers{
+		Low: []uint8{DPL, 0x84}, High: []uint8{DPH, 0x85},
+		Select: 0x92, SelectMask: 0x01, //DPS
+	},
+	SFRs: map[uint8]string{
+		0x84: "DPL1", 0x85: "DPH1", 0x92: "DPS", 0x93: "P0DIR", 0x94: "P1DIR",
+		0xA3: "CLKCTRL", 0xAD: "CLKLFCTRL", 0xE5: "SPIRCON0", 0xE6: "SPIRCON1",
+		0xE7: "SPIRSTAT", 0xE8: "RFCON",
+	},
+	ResetValues: Reset8051,
+}
+
+//ProfileCC2530 is the TI CC2530 ZigBee SoC with its single cycle core,
+//modelled on the 32KiB flash part with 8KiB of MOVX ram. Flash banking
+//and the CC2530 timers and USARTs are not modelled, its USART 0 stands
+//in for the standard serial port
+var ProfileCC2530 = &Profile{
+	Name:           "CC2530",
+	IRAMSize:       256,
+	XRAMSize:       0x2000,
+	CodeSize:       0x8000,
+	ClocksPerCycle: 1,
+	OscillatorHz:   32000000,
+	UARTs:          2,
+	DataPointers: &DataPointers{
+		Low: []uint8{DPL, 0x84}, High: []uint8{DPH, 0x85},
+		Select: 0x92, SelectMask: 0x01, //DPS
+	},
+	SFRs: map[uint8]string{
+		0x84: "DPL1", 0x85: "DPH1", 0x92: "DPS", 0x93: "XPAGE", 0x9F: "FMAP",
+		0xC6: "CLKCONCMD", 0x9E: "CLKCONSTA", 0xC1: "U0DBUF", 0xF9: "U1DBUF",
+	},
+	ResetValues: derivativeReset(ResetTable{
+		0xC6: 0xC9, //CLKCONCMD, 16MHz RC oscillator with divided clocks
+		0x9E: 0xC9, //CLKCONSTA mirrors CLKCONCMD
+		0x9F: 0x01, //FMAP, flash bank 1 selected
+	}),
+}
+
+//Profiles holds the built in profiles by name
+var Profiles = map[string]*Profile{}
+
+func init() {
+	for _, p := range []*Profile{
+		Profile8051, Profile8052, ProfileAT89S52, ProfileDS89C4x0,
+		ProfileC8051F3xx, ProfileNRF24LE1, ProfileCC2530,
+	} {
+		Profiles[p.Name] = p
+	}
+}
+
+//LookupProfile returns the built in profile called name, ignoring case
+func LookupProfile(name string) (*Profile, bool) {
+	for n, p := range Profiles {
+		if strings.EqualFold(n, name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+//ProfileNames returns the names of the built in profiles in order
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
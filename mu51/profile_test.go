@@ -0,0 +1,173 @@
+package mu51
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProfiles(t *testing.T) {
+	for _, name := range ProfileNames() {
+		p, ok := LookupProfile(name)
+		if !ok {
+			t.Fatalf("profile %s not found", name)
+		}
+		c := p.NewCPU(make(Memory, p.CodeSize))
+		if c.SFR(SP) != 0x07 || c.ProgCount != 0 {
+			t.Errorf("%s: not reset", name)
+		}
+		if c.clocksPerCycle() != p.ClocksPerCycle {
+			t.Errorf("%s: %d clocks per cycle", name, c.clocksPerCycle())
+		}
+		hasXRAM := c.ExtRAM != nil && c.ExtRAM.Size() == int64(p.XRAMSize)
+		if hasXRAM != (p.XRAMSize > 0) {
+			t.Errorf("%s: wrong on chip xram", name)
+		}
+		var t2 bool
+		for _, per := range c.Peripherals {
+			if _, ok := per.(*Timer2); ok {
+				t2 = true
+			}
+		}
+		//parts without timer 2 may put their own register at T2CON
+		_, named := p.SFRs[T2CON]
+		if t2 != p.Timer2 || p.HasSFR(T2CON) != (p.Timer2 || named) {
+			t.Errorf("%s: timer 2 present %t", name, t2)
+		}
+	}
+	if _, ok := LookupProfile("at89s52"); !ok {
+		t.Error("profile lookup is case sensitive")
+	}
+}
+
+func TestProfileSFRNames(t *testing.T) {
+	if name, _ := ProfileDS89C4x0.SFRName(0x86); name != "DPS" {
+		t.Errorf("derivative register named %q", name)
+	}
+	if name, _ := ProfileDS89C4x0.SFRName(TCON); name != "TCON" {
+		t.Errorf("standard register named %q", name)
+	}
+	if _, ok := Profile8051.SFRName(T2CON); ok {
+		t.Error("8051 names timer 2 registers")
+	}
+}
+
+func TestUpperIRAM(t *testing.T) {
+	code := Memory{
+		0x78, 0x90, //MOV R0,#90h
+		0x76, 0x5A, //MOV @R0,#5Ah
+		0xE6, //MOV A,@R0
+	}
+	for _, v := range []struct {
+		p    *Profile
+		want uint8
+	}{{Profile8051, 0xFF}, {Profile8052, 0x5A}} {
+		c := v.p.NewCPU(code)
+		for i := 0; i < 3; i++ {
+			if err := c.Step(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.Accum() != v.want {
+			t.Errorf("%s: read 0x%02X from upper ram", v.p.Name, c.Accum())
+		}
+	}
+}
+
+func TestSingleCycleProfile(t *testing.T) {
+	c := ProfileDS89C4x0.NewCPU(Memory{0x00})
+	c.Step()
+	if c.Elapsed() != time.Second/33000000 {
+		t.Errorf("single cycle NOP took %v", c.Elapsed())
+	}
+}
+
+func TestProfileResetValues(t *testing.T) {
+	for _, v := range []struct {
+		p          *Profile
+		addr, want uint8
+	}{
+		{ProfileDS89C4x0, 0x8E, 0x01},
+		{ProfileC8051F3xx, 0xD9, 0x40},
+		{ProfileCC2530, 0xC6, 0xC9},
+		{ProfileCC2530, 0x9F, 0x01},
+		{ProfileAT89S52, 0x8E, 0x00},
+		{Profile8052, T2CON, 0x00},
+	} {
+		c := v.p.NewCPU(make(Memory, v.p.CodeSize))
+		c.SetSFR(v.addr, 0x5A)
+		c.Reset()
+		if got := c.SFR(v.addr); got != v.want || c.SFR(SP) != 0x07 || c.SFR(P1) != 0xFF {
+			t.Errorf("%s: SFR 0x%02X reset to 0x%02X, expected 0x%02X", v.p.Name, v.addr, got, v.want)
+		}
+	}
+}
+
+func TestProfileTimer2Absent(t *testing.T) {
+	c := Profile8051.NewCPU(nil)
+	c.WriteDirect(RCAP2L, 0x12)
+	if c.ReadDirect(RCAP2L) != 0xFF || c.SFR(RCAP2L) != 0 {
+		t.Error("8051 stored a timer 2 register")
+	}
+	c.SetSFR(IE, 0xA0) //EA and ET2
+	c.SetSFR(T2CON, 0x80)
+	if _, ok := c.PendingInterrupt(); ok {
+		t.Error("8051 raised the timer 2 interrupt")
+	}
+
+	//the C8051F3xx keeps its own register where T2CON would be
+	c = ProfileC8051F3xx.NewCPU(nil)
+	c.WriteDirect(0xC8, 0x04)
+	if c.ReadDirect(0xC8) != 0x04 {
+		t.Error("C8051F3xx lost TMR2CN")
+	}
+}
+
+func TestProfileAbsentSFRs(t *testing.T) {
+	//the second data pointer of the AT89S52 is missing from the 8051
+	c := Profile8051.NewCPU(nil)
+	c.WriteDirect(0x84, 0x12)
+	if c.ReadDirect(0x84) != 0xFF || c.SFR(0x84) != 0 {
+		t.Error("8051 stored DP1L")
+	}
+	c = ProfileAT89S52.NewCPU(nil)
+	c.WriteDirect(0x84, 0x12)
+	if c.ReadDirect(0x84) != 0x12 {
+		t.Error("AT89S52 lost DP1L")
+	}
+
+	//a register modelled by a peripheral is present whatever the profile
+	c = Profile8051.NewCPU(nil)
+	c.ReadCallbacks[0xF8] = func() uint8 { return 0x5A }
+	if c.ReadDirect(0xF8) != 0x5A {
+		t.Error("register with a callback read as absent")
+	}
+}
+
+func TestProfileCodeSize(t *testing.T) {
+	c := Profile8051.NewCPU(nil)
+	if c.ProgMem.Size() != 0x1000 {
+		t.Errorf("8051 given %d bytes of code", c.ProgMem.Size())
+	}
+
+	//code beyond the part's code size is never fetched
+	code := make(Memory, 0x2000)
+	c = Profile8051.NewCPU(code)
+	c.ProgCount = 0x1000
+	var f *Fault
+	if err := c.Step(); !errors.As(err, &f) || f.Kind != FaultCodeBounds {
+		t.Errorf("fetch past 4KiB gave %v", err)
+	}
+	c.ProgCount = 0x0FFF
+	code[0x0FFF] = 0x02 //LJMP split across the end of code
+	if err := c.Step(); !errors.Is(err, ErrCodeBounds) {
+		t.Errorf("instruction straddling 4KiB gave %v", err)
+	}
+	copy(code, []byte{0x90, 0x10, 0x00, 0xE4, 0x93}) //MOV DPTR,#1000h CLR A MOVC A,@A+DPTR
+	c.ProgCount = 0
+	c.Step()
+	c.Step()
+	if err := c.Step(); !errors.As(err, &f) || f.Kind != FaultCodeBounds || f.Addr != 0x1000 {
+		t.Errorf("MOVC past 4KiB gave %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package mu51
+
+import (
+	"io"
+	"math/rand"
+)
+
+//ResetTable holds the values special function registers take on
+//reset, any register not listed resets to zero
+type ResetTable map[uint8]uint8
+
+//Reset8051 is the reset state of the standard 8051. It is shared by
+//the 8052, whose timer 2 registers all reset to zero, and by any
+//derivative which adds no registers with a non zero reset value
+var Reset8051 = ResetTable{
+	SP: 0x07,
+	P0: 0xFF, P1: 0xFF, P2: 0xFF, P3: 0xFF,
+}
+
+//derivativeReset returns the standard reset state extended with the
+//registers a derivative adds which do not reset to zero
+func derivativeReset(extra ResetTable) ResetTable {
+	t := make(ResetTable, len(Reset8051)+len(extra))
+	for addr, v := range Reset8051 {
+		t[addr] = v
+	}
+	for addr, v := range extra {
+		t[addr] = v
+	}
+	return t
+}
+
+//Resetter is implemented by peripherals holding state beyond their
+//special function registers which must be cleared on reset
+type Resetter interface {
+	Reset(c *CPU)
+}
+
+//NewCPU returns a powered on CPU running code with optional external ram
+func NewCPU(code CodeMemory, xram RAM) *CPU {
+	c := &CPU{ALU: &ALU{}, ProgMem: code, ExtRAM: xram}
+	c.PowerOn()
+	return c
+}
+
+//Reset performs a warm reset through the RST pin. The program counter
+//and special function registers return to their reset values while
+//internal and external ram keep their contents
+func (c *CPU) Reset() {
+	if c.ALU == nil {
+		c.ALU = &ALU{}
+	}
+	c.ProgCount = 0
+	c.SpecialRegs = [128]byte{}
+	table := c.ResetValues
+	if table == nil {
+		table = Reset8051
+	}
+	for addr, v := range table {
+		c.SetSFR(addr, v)
+	}
+	c.inService = 0
+	c.holdoff = false
+	c.latchRead = false
+	c.idling = false
+	c.poweredDown = false
+	for _, p := range c.Peripherals {
+		if r, ok := p.(Resetter); ok {
+			r.Reset(c)
+		}
+	}
+}
+
+//PowerOn performs a power on reset. Ram contents are undefined at power
+//on, they are cleared or with RandomizeMemory set filled with random
+//values, seeded by RandomSeed so any failure can be reproduced. External
+//ram which can randomize itself, such as a Bus, fills only its ram. Any
+//error filling external ram is returned once the reset is complete
+func (c *CPU) PowerOn() error {
+	if c.ALU == nil {
+		c.ALU = &ALU{}
+	}
+	var err error
+	if c.RandomizeMemory {
+		rng := rand.New(rand.NewSource(c.RandomSeed))
+		rng.Read(c.InternalRAM[:])
+		err = c.randomizeXRAM(rng)
+	} else {
+		c.InternalRAM = [256]byte{}
+	}
+	c.Cycles = 0
+	c.Power = PowerStats{}
+	c.Reset()
+	return err
+}
+
+//randomizer is implemented by external ram holding more than plain
+//storage to randomize only the storage
+type randomizer interface {
+	Randomize(r io.Reader) error
+}
+
+//randomizeXRAM fills external ram with values read from rng
+func (c *CPU) randomizeXRAM(rng io.Reader) error {
+	switch m := c.ExtRAM.(type) {
+	case nil:
+		return nil
+	case randomizer:
+		return m.Randomize(rng)
+	}
+	b := make([]byte, c.ExtRAM.Size())
+	rng.Read(b)
+	_, err := c.ExtRAM.WriteAt(b, 0)
+	return err
+}
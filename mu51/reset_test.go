@@ -0,0 +1,110 @@
+package mu51
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResetValues(t *testing.T) {
+	c := NewCPU(make(testROM, 0x100), nil)
+	for addr, want := range map[uint8]uint8{SP: 0x07, P0: 0xFF, P1: 0xFF, P2: 0xFF, P3: 0xFF, PSW: 0, ACC: 0, IE: 0, TCON: 0} {
+		if got := c.ReadDirect(addr); got != want {
+			t.Errorf("SFR 0x%02X reset to 0x%02X, expected 0x%02X", addr, got, want)
+		}
+	}
+
+	c.ResetValues = ResetTable{SP: 0x07, 0x8E: 0x02}
+	c.Reset()
+	if c.SFR(0x8E) != 0x02 || c.SFR(P1) != 0x00 {
+		t.Error("derivative reset table not applied")
+	}
+}
+
+func TestWarmReset(t *testing.T) {
+	c := newTestCPU(0x1000, 0x00)
+	c.InternalRAM[0x40] = 0x5A
+	c.SetAccum(0x12)
+	c.SetSFR(IE, 0x82)
+	c.inService = 1
+	c.Cycles = 100
+	c.Reset()
+	if c.ProgCount != 0 || c.Accum() != 0 || c.SFR(IE) != 0 || c.InServiceLevel() != -1 {
+		t.Error("warm reset did not reset the core")
+	}
+	if c.InternalRAM[0x40] != 0x5A || c.Cycles != 100 {
+		t.Error("warm reset cleared ram or time")
+	}
+	c.PowerOn()
+	if c.InternalRAM[0x40] != 0 || c.Cycles != 0 {
+		t.Error("power on kept ram or time")
+	}
+}
+
+func TestRandomizedPowerOn(t *testing.T) {
+	image := func(seed int64) ([256]byte, []byte) {
+		c := &CPU{ExtRAM: make(testRAM, 64), RandomizeMemory: true, RandomSeed: seed}
+		c.PowerOn()
+		return c.InternalRAM, c.ExtRAM.(testRAM)
+	}
+	iram1, xram1 := image(1)
+	iram2, xram2 := image(1)
+	iram3, _ := image(2)
+	if iram1 != iram2 || !bytes.Equal(xram1, xram2) {
+		t.Error("randomized memory not reproducible from its seed")
+	}
+	if iram1 == iram3 || iram1 == [256]byte{} || bytes.Equal(xram1, make([]byte, 64)) {
+		t.Error("memory not randomized")
+	}
+}
+
+func TestRandomizedPowerOnBus(t *testing.T) {
+	var writes int
+	rom := Memory{0x01, 0x02, 0x03, 0x04}
+	ram := make(Memory, 0x100)
+	xdata := &Bus{}
+	xdata.MapROM(0x0000, rom)
+	xdata.MapRAM(0x1000, ram)
+	xdata.MapIO(0xF000, 0x10, &MMIO{
+		Len:   0x10,
+		Write: func(uint16, uint8) { writes++ },
+	})
+	c := &CPU{ExtRAM: xdata, RandomizeMemory: true, RandomSeed: 1}
+	if err := c.PowerOn(); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 0 || !bytes.Equal(rom, Memory{0x01, 0x02, 0x03, 0x04}) {
+		t.Errorf("power on wrote %d registers, rom % X", writes, rom)
+	}
+	if bytes.Equal(ram, make(Memory, 0x100)) {
+		t.Error("ram region not randomized")
+	}
+
+	c = &CPU{ExtRAM: failingRAM{}, RandomizeMemory: true}
+	if err := c.PowerOn(); err != ErrReadOnly || c.SFR(SP) != 0x07 {
+		t.Errorf("failed fill gave %v, SP 0x%02X", err, c.SFR(SP))
+	}
+}
+
+//failingRAM is external ram rejecting every write
+type failingRAM struct{ testRAM }
+
+func (failingRAM) WriteAt(p []byte, off int64) (int, error) {
+	return 0, ErrReadOnly
+}
+
+func TestResetPeripherals(t *testing.T) {
+	c, p := newPortCPU()
+	s := &Serial{}
+	c.AddPeripheral(s)
+	var changes int
+	p.OnChange = func(PinEvent) { changes++ }
+	c.WriteDirect(P1, 0x00)
+	c.WriteDirect(SBUF, 'x')
+	c.Reset()
+	if changes != 16 {
+		t.Errorf("expected 16 pin changes, got %d", changes)
+	}
+	if s.tx.bits != 0 {
+		t.Error("reset did not abandon the transmission")
+	}
+}
@@ -0,0 +1,348 @@
+package mu51
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+//Serial models the standard full duplex serial port in all four modes.
+//Received bytes are taken from a connected io.Reader or queued with
+//Receive and transmitted bytes are written to a connected io.Writer.
+//Modes 1 and 3 take their baud clock from the overflows of Timer1,
+//or of Timer2 when RCLK or TCLK select it, so those timers must be
+//clocked by the same CPU
+type Serial struct {
+	Timer1 *Timer01
+	Timer2 *Timer2
+
+	//OnTransmit, when set, is called with every transmitted frame
+	//along with the ninth data bit (TB8) of modes 2 and 3
+	OnTransmit func(data byte, bit9 bool)
+
+	once sync.Once
+	rx   chan serialFrame //frames waiting to arrive on RXD
+
+	mu       sync.Mutex
+	conn     *serialConn //stream currently connected, nil if none
+	out      io.Writer
+	err      error
+	overruns uint64
+
+	sbuf  uint8 //receive buffer, read through SBUF
+	tx    serialShift
+	recv  serialShift
+	last1 uint64 //timer overflow counts at the previous machine cycle
+	last2 uint64
+}
+
+//serialFrame is a single frame on the serial line
+type serialFrame struct {
+	data uint8
+	bit9 bool
+}
+
+//serialShift is a frame being shifted in or out of the port
+type serialShift struct {
+	frame serialFrame
+	bits  int //bits remaining, zero when idle
+	units int //progress through the current bit
+}
+
+//serial control bits of SCON and PCON
+const (
+	sconSM2 = 0x20
+	sconREN = 0x10
+	sconTB8 = 0x08
+	sconRB8 = 0x04
+	sconTI  = 0x02
+	sconRI  = 0x01
+
+	pconSMOD = 0x80
+)
+
+func (s *Serial) init() {
+	s.once.Do(func() {
+		s.rx = make(chan serialFrame, 256)
+	})
+}
+
+//Attach installs the SBUF callbacks, reads return the receive buffer
+//while writes start a transmission
+func (s *Serial) Attach(c *CPU) {
+	s.init()
+	c.ReadCallbacks[SBUF] = func() uint8 {
+		return s.sbuf
+	}
+	c.WriteCallbacks[SBUF] = func(val uint8) {
+		mode := c.SFR(SCON) >> 6
+		s.tx = serialShift{
+			frame: serialFrame{data: val, bit9: c.SFR(SCON)&sconTB8 != 0},
+			bits:  frameBits(mode),
+		}
+	}
+	if s.Timer1 != nil {
+		s.last1 = s.Timer1.Overflows[1]
+	}
+	if s.Timer2 != nil {
+		s.last2 = s.Timer2.Overflows
+	}
+}
+
+//Reset abandons any frame being shifted and clears the receive buffer,
+//frames still waiting on the line are kept
+func (s *Serial) Reset(c *CPU) {
+	s.tx = serialShift{}
+	s.recv = serialShift{}
+	s.sbuf = 0
+}
+
+//frameBits returns the number of bit times in a frame of the given mode
+func frameBits(mode uint8) int {
+	switch mode {
+	case 0:
+		return 8
+	case 1:
+		return 10
+	}
+	return 11
+}
+
+//serialConn is a byte stream connected to the port
+type serialConn struct {
+	s    *Serial
+	r    io.Reader
+	done chan struct{}
+	once sync.Once
+}
+
+//Close disconnects the stream from the port and stops its reader, a
+//reader which is also an io.Closer is closed so a blocked Read returns
+func (sc *serialConn) Close() error {
+	var err error
+	sc.once.Do(func() {
+		close(sc.done)
+		sc.s.mu.Lock()
+		if sc.s.conn == sc {
+			sc.s.conn = nil
+			sc.s.out = nil
+		}
+		sc.s.mu.Unlock()
+		if c, ok := sc.r.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+	return err
+}
+
+//Connect attaches a byte stream to the port, replacing any stream
+//connected before. Bytes read from r arrive as received frames, with
+//the ninth bit set in modes 2 and 3, and transmitted bytes are written
+//to w. Either may be nil. Close the returned io.Closer to disconnect
+func (s *Serial) Connect(r io.Reader, w io.Writer) io.Closer {
+	s.init()
+	sc := &serialConn{s: s, r: r, done: make(chan struct{})}
+	s.mu.Lock()
+	prev := s.conn
+	s.conn = sc
+	s.out = w
+	s.mu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+	if r == nil {
+		return sc
+	}
+	go func() {
+		b := make([]byte, 1)
+		for {
+			n, err := r.Read(b)
+			if n > 0 {
+				//wait for room on the line rather than drop
+				//bytes the reader can deliver faster than the
+				//port receives them
+				select {
+				case s.rx <- serialFrame{data: b[0], bit9: true}:
+				case <-sc.done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return sc
+}
+
+//ListenTCP accepts connections on addr, connecting each in turn to the
+//port as both its input and output. A new connection replaces and
+//closes the one before it. Close the returned listener to stop
+func (s *Serial) ListenTCP(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.Connect(conn, conn)
+		}
+	}()
+	return l, nil
+}
+
+//Receive queues a frame to arrive on the port, bit9 is the ninth
+//data bit of modes 2 and 3 used for multiprocessor addressing. It
+//never blocks, when the line is already full the frame is dropped as
+//an overrun and false is returned
+func (s *Serial) Receive(data byte, bit9 bool) bool {
+	s.init()
+	select {
+	case s.rx <- serialFrame{data: data, bit9: bit9}:
+		return true
+	default:
+		s.overrun()
+		return false
+	}
+}
+
+//overrun counts a received frame which was lost
+func (s *Serial) overrun() {
+	s.mu.Lock()
+	s.overruns++
+	s.mu.Unlock()
+}
+
+//Overruns returns the number of received frames lost, either because
+//RI was still set when they completed or the line was full
+func (s *Serial) Overruns() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overruns
+}
+
+//Err returns the first error encountered writing transmitted bytes
+func (s *Serial) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+//bitClock returns the progress made through a bit time this machine
+//cycle and the length of a bit time, in the same units
+func (s *Serial) bitClock(c *CPU, mode uint8, rx bool) (int, int) {
+	smod := c.SFR(PCON)&pconSMOD != 0
+	switch mode {
+	case 0:
+		return c.clocksPerCycle(), 12
+	case 2:
+		if smod {
+			return c.clocksPerCycle(), 32
+		}
+		return c.clocksPerCycle(), 64
+	}
+
+	//variable rate modes count timer overflows, 32 units a bit
+	//for timer 1 halved by SMOD and 16 units a bit for timer 2
+	t2con := c.SFR(T2CON)
+	useT2 := t2con&t2conTCLK != 0
+	if rx {
+		useT2 = t2con&t2conRCLK != 0
+	}
+	if useT2 {
+		if s.Timer2 == nil {
+			return 0, 32
+		}
+		return 2 * int(s.Timer2.Overflows-s.last2), 32
+	}
+	if s.Timer1 == nil {
+		return 0, 32
+	}
+	n := int(s.Timer1.Overflows[1] - s.last1)
+	if smod {
+		n *= 2
+	}
+	return n, 32
+}
+
+//shift advances a frame by units, reporting when it completes
+func (f *serialShift) shift(units, bitLen int) bool {
+	if f.bits == 0 {
+		return false
+	}
+	f.units += units
+	for f.units >= bitLen && f.bits > 0 {
+		f.units -= bitLen
+		f.bits--
+	}
+	return f.bits == 0
+}
+
+//Tick advances any transmission or reception by one machine cycle
+func (s *Serial) Tick(c *CPU) {
+	scon := c.SFR(SCON)
+	mode := scon >> 6
+
+	units, bitLen := s.bitClock(c, mode, false)
+	if s.tx.shift(units, bitLen) {
+		scon |= sconTI
+		s.transmit(s.tx.frame, mode)
+	}
+
+	//start receiving a waiting frame, mode 0 only receives
+	//while RI is clear as it shifts under our own clock
+	if s.recv.bits == 0 && scon&sconREN != 0 && (mode != 0 || scon&sconRI == 0) {
+		select {
+		case f := <-s.rx:
+			s.recv = serialShift{frame: f, bits: frameBits(mode)}
+		default:
+		}
+	}
+	units, bitLen = s.bitClock(c, mode, true)
+	if s.recv.shift(units, bitLen) {
+		f := s.recv.frame
+		switch {
+		case scon&sconRI != 0:
+			//overrun, the frame is lost
+			s.overrun()
+		case mode == 0:
+			s.sbuf = f.data
+			scon |= sconRI
+		case mode == 1:
+			//the stop bit is always valid so SM2 never filters
+			s.sbuf = f.data
+			scon = scon | sconRI | sconRB8
+		case scon&sconSM2 == 0 || f.bit9:
+			s.sbuf = f.data
+			scon = scon&^sconRB8 | sconRI
+			if f.bit9 {
+				scon |= sconRB8
+			}
+		}
+	}
+	c.SetSFR(SCON, scon)
+
+	if s.Timer1 != nil {
+		s.last1 = s.Timer1.Overflows[1]
+	}
+	if s.Timer2 != nil {
+		s.last2 = s.Timer2.Overflows
+	}
+}
+
+//transmit delivers a completed frame to the attached writer
+func (s *Serial) transmit(f serialFrame, mode uint8) {
+	if s.OnTransmit != nil {
+		s.OnTransmit(f.data, f.bit9 && mode >= 2)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil || s.err != nil {
+		return
+	}
+	_, s.err = s.out.Write([]byte{f.data})
+}
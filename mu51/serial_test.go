@@ -0,0 +1,176 @@
+package mu51
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+//newSerialCPU returns a cpu with timer 1 set up for 9600 baud at
+//11.0592MHz, giving a bit time of 96 machine cycles in mode 1
+func newSerialCPU(scon uint8) (*CPU, *Serial) {
+	c := newTestCPU(0x1000)
+	c.SetSFR(P3, 0xFF)
+	c.SetSFR(TMOD, 0x20)
+	c.SetSFR(TH1, 0xFD)
+	c.SetSFR(TL1, 0xFD)
+	c.SetSFR(TCON, 0x40)
+	c.SetSFR(SCON, scon)
+	t1 := &Timer01{}
+	s := &Serial{Timer1: t1}
+	c.AddPeripheral(t1)
+	c.AddPeripheral(s)
+	return c, s
+}
+
+func TestSerialTransmit(t *testing.T) {
+	c, s := newSerialCPU(0x40)
+	var out bytes.Buffer
+	s.Connect(nil, &out)
+	c.WriteDirect(SBUF, 'A')
+	c.advance(950)
+	if c.SFR(SCON)&sconTI != 0 || out.Len() != 0 {
+		t.Fatal("frame sent faster than 9600 baud")
+	}
+	c.advance(20)
+	if c.SFR(SCON)&sconTI == 0 || out.String() != "A" {
+		t.Errorf("frame not sent in 10 bit times, output %q", out.String())
+	}
+
+	//SMOD doubles the rate
+	c.SetSFR(SCON, 0x40)
+	c.SetSFR(PCON, 0x80)
+	c.WriteDirect(SBUF, 'B')
+	c.advance(485)
+	if c.SFR(SCON)&sconTI == 0 || out.String() != "AB" {
+		t.Errorf("SMOD did not double the baud rate, output %q", out.String())
+	}
+}
+
+func TestSerialReceive(t *testing.T) {
+	c, s := newSerialCPU(0x50)
+	s.Receive('h', true)
+	s.Receive('i', true)
+	c.advance(970)
+	if c.SFR(SCON)&sconRI == 0 || c.ReadDirect(SBUF) != 'h' {
+		t.Fatalf("first byte not received, SCON 0x%02X", c.SFR(SCON))
+	}
+
+	//the second frame is lost while RI is still set
+	c.advance(970)
+	c.SetSFR(SCON, 0x50)
+	if c.ReadDirect(SBUF) != 'h' {
+		t.Error("overrun replaced the receive buffer")
+	}
+	if s.Overruns() != 1 {
+		t.Errorf("counted %d overruns, expected 1", s.Overruns())
+	}
+
+	//REN clear ignores the line
+	c.SetSFR(SCON, 0x40)
+	s.Receive('x', true)
+	c.advance(970)
+	if c.SFR(SCON)&sconRI != 0 {
+		t.Error("received with REN clear")
+	}
+}
+
+func TestSerialMultiprocessor(t *testing.T) {
+	//mode 3 with SM2 only accepts frames with the ninth bit set
+	c, s := newSerialCPU(0xF0)
+	s.Receive(0x12, false)
+	c.advance(1100)
+	if c.SFR(SCON)&sconRI != 0 {
+		t.Fatal("data frame accepted with SM2 set")
+	}
+	s.Receive(0x34, true)
+	c.advance(1100)
+	if c.SFR(SCON)&(sconRI|sconRB8) != sconRI|sconRB8 || c.ReadDirect(SBUF) != 0x34 {
+		t.Errorf("address frame not accepted, SCON 0x%02X", c.SFR(SCON))
+	}
+}
+
+func TestSerialFixedModes(t *testing.T) {
+	//mode 0 shifts a bit every machine cycle
+	c, s := newSerialCPU(0x00)
+	var frames []byte
+	s.OnTransmit = func(data byte, bit9 bool) {
+		frames = append(frames, data)
+	}
+	c.WriteDirect(SBUF, 0x55)
+	c.advance(8)
+	if c.SFR(SCON)&sconTI == 0 || len(frames) != 1 {
+		t.Error("mode 0 frame not sent in 8 cycles")
+	}
+
+	//mode 2 takes 64 clocks a bit, 11 bits at 12 clocks a cycle
+	c.SetSFR(SCON, 0x88)
+	var ninth bool
+	s.OnTransmit = func(data byte, bit9 bool) {
+		ninth = bit9
+	}
+	c.WriteDirect(SBUF, 0xAA)
+	c.advance(58)
+	if c.SFR(SCON)&sconTI != 0 {
+		t.Fatal("mode 2 frame sent early")
+	}
+	c.advance(1)
+	if c.SFR(SCON)&sconTI == 0 || !ninth {
+		t.Errorf("mode 2 frame not sent with TB8, SCON 0x%02X", c.SFR(SCON))
+	}
+}
+
+func TestSerialConnectReader(t *testing.T) {
+	c, s := newSerialCPU(0x50)
+	s.Connect(strings.NewReader("ok"), nil)
+	var got []byte
+	for i := 0; i < 1000000 && len(got) < 2; i++ {
+		c.advance(1)
+		if c.SFR(SCON)&sconRI != 0 {
+			got = append(got, c.ReadDirect(SBUF))
+			c.SetSFR(SCON, 0x50)
+		}
+	}
+	if string(got) != "ok" {
+		t.Errorf("received %q from the reader", got)
+	}
+}
+
+func TestSerialReceiveFull(t *testing.T) {
+	_, s := newSerialCPU(0x50)
+	for i := 0; i < 256; i++ {
+		if !s.Receive(byte(i), true) {
+			t.Fatalf("frame %d dropped before the line was full", i)
+		}
+	}
+	if s.Receive(0xAA, true) || s.Overruns() != 1 {
+		t.Errorf("frame on a full line not dropped, %d overruns", s.Overruns())
+	}
+}
+
+func TestSerialConnectClose(t *testing.T) {
+	c, s := newSerialCPU(0x40)
+	r, w := io.Pipe()
+	var out bytes.Buffer
+	conn := s.Connect(r, &out)
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{'x'}); err != io.ErrClosedPipe {
+		t.Errorf("reader still open after Close, write gave %v", err)
+	}
+	c.WriteDirect(SBUF, 'A')
+	c.advance(970)
+	if out.Len() != 0 {
+		t.Errorf("closed connection still transmitted %q", out.String())
+	}
+
+	//a new connection replaces the old one
+	r, w = io.Pipe()
+	s.Connect(r, &out)
+	s.Connect(nil, nil)
+	if _, err := w.Write([]byte{'x'}); err != io.ErrClosedPipe {
+		t.Errorf("replaced reader still open, write gave %v", err)
+	}
+}
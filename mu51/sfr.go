@@ -0,0 +1,174 @@
+package mu51
+
+import (
+	"fmt"
+)
+
+//Direct addresses of the standard 8051 special function registers
+const (
+	P0     = 0x80 //Port 0 latch
+	SP     = 0x81 //Stack pointer
+	DPL    = 0x82 //Data pointer low byte
+	DPH    = 0x83 //Data pointer high byte
+	PCON   = 0x87 //Power control
+	TCON   = 0x88 //Timer control
+	TMOD   = 0x89 //Timer mode
+	TL0    = 0x8A //Timer 0 low byte
+	TL1    = 0x8B //Timer 1 low byte
+	TH0    = 0x8C //Timer 0 high byte
+	TH1    = 0x8D //Timer 1 high byte
+	P1     = 0x90 //Port 1 latch
+	SCON   = 0x98 //Serial control
+	SBUF   = 0x99 //Serial data buffer
+	P2     = 0xA0 //Port 2 latch
+	IE     = 0xA8 //Interrupt enable
+	P3     = 0xB0 //Port 3 latch
+	IP     = 0xB8 //Interrupt priority
+	T2CON  = 0xC8 //Timer 2 control
+	T2MOD  = 0xC9 //Timer 2 mode, on derivatives
+	RCAP2L = 0xCA //Timer 2 capture/reload low byte
+	RCAP2H = 0xCB //Timer 2 capture/reload high byte
+	TL2    = 0xCC //Timer 2 low byte
+	TH2    = 0xCD //Timer 2 high byte
+	PSW    = 0xD0 //Program status word
+	ACC    = 0xE0 //Accumulator
+	B      = 0xF0 //B register
+)
+
+//sfrNames maps the standard special function registers to their names
+var sfrNames = map[uint8]string{
+	P0: "P0", SP: "SP", DPL: "DPL", DPH: "DPH", PCON: "PCON",
+	TCON: "TCON", TMOD: "TMOD", TL0: "TL0", TL1: "TL1", TH0: "TH0", TH1: "TH1",
+	P1: "P1", SCON: "SCON", SBUF: "SBUF", P2: "P2", IE: "IE", P3: "P3", IP: "IP",
+	T2CON: "T2CON", T2MOD: "T2MOD", RCAP2L: "RCAP2L", RCAP2H: "RCAP2H", TL2: "TL2", TH2: "TH2",
+	PSW: "PSW", ACC: "ACC", B: "B",
+}
+
+//bitNames maps the individually named bits of the standard
+//bit addressable special function registers to their names
+var bitNames = map[uint8]string{
+	0x88: "IT0", 0x89: "IE0", 0x8A: "IT1", 0x8B: "IE1",
+	0x8C: "TR0", 0x8D: "TF0", 0x8E: "TR1", 0x8F: "TF1",
+	0x90: "T2", 0x91: "T2EX",
+	0x98: "RI", 0x99: "TI", 0x9A: "RB8", 0x9B: "TB8",
+	0x9C: "REN", 0x9D: "SM2", 0x9E: "SM1", 0x9F: "SM0",
+	0xA8: "EX0", 0xA9: "ET0", 0xAA: "EX1", 0xAB: "ET1", 0xAC: "ES", 0xAD: "ET2", 0xAF: "EA",
+	0xB0: "RXD", 0xB1: "TXD", 0xB2: "INT0", 0xB3: "INT1",
+	0xB4: "T0", 0xB5: "T1", 0xB6: "WR", 0xB7: "RD",
+	0xB8: "PX0", 0xB9: "PT0", 0xBA: "PX1", 0xBB: "PT1", 0xBC: "PS", 0xBD: "PT2",
+	0xC8: "CP_RL2", 0xC9: "C_T2", 0xCA: "TR2", 0xCB: "EXEN2",
+	0xCC: "TCLK", 0xCD: "RCLK", 0xCE: "EXF2", 0xCF: "TF2",
+	0xD0: "P", 0xD2: "OV", 0xD3: "RS0", 0xD4: "RS1", 0xD5: "F0", 0xD6: "AC", 0xD7: "CY",
+}
+
+//SFRName returns the name of the special function register at the
+//direct address addr, if it is one of the standard registers
+func SFRName(addr uint8) (string, bool) {
+	name, ok := sfrNames[addr]
+	return name, ok
+}
+
+//BitName returns the name of a bit address within the special function
+//registers. Individually named bits such as TR0 are returned as is, any
+//other bit of a named register is returned in the REG.n form
+func BitName(bit uint8) (string, bool) {
+	if name, ok := bitNames[bit]; ok {
+		return name, true
+	}
+	if bit < 0x80 {
+		return "", false
+	}
+	addr, _ := BitLocation(bit)
+	name, ok := sfrNames[addr]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s.%d", name, bit&0x07), true
+}
+
+//SFRAddress returns the direct address of the standard special
+//function register called name, the inverse of SFRName
+func SFRAddress(name string) (uint8, bool) {
+	for addr, v := range sfrNames {
+		if v == name {
+			return addr, true
+		}
+	}
+	return 0, false
+}
+
+//BitAddress returns the bit address of the individually named
+//special function register bit called name, such as TR0
+func BitAddress(name string) (uint8, bool) {
+	for bit, v := range bitNames {
+		if v == name {
+			return bit, true
+		}
+	}
+	return 0, false
+}
+
+//coreRegister reports whether addr is one of the special function
+//registers implemented by the core itself, these never trigger callbacks
+func coreRegister(addr uint8) bool {
+	switch addr {
+	case SP, DPL, DPH, PSW, ACC, B:
+		return true
+	}
+	return false
+}
+
+//ReadDirect reads a byte using direct addressing. Addresses below
+//0x80 refer to the lower half of internal ram, the remainder are
+//special function registers. Any register other than those of the
+//core with a read callback installed is read through it, except that
+//read-modify-write instructions read the port latches directly
+func (c *CPU) ReadDirect(addr uint8) uint8 {
+	if addr < 0x80 {
+		c.access(SpaceIRAM, uint16(addr), false, c.InternalRAM[addr])
+		return c.InternalRAM[addr]
+	}
+	val := c.readSFR(addr)
+	c.access(SpaceSFR, uint16(addr), false, val)
+	return val
+}
+
+//readSFR reads a special function register for ReadDirect
+func (c *CPU) readSFR(addr uint8) uint8 {
+	if addr == PSW {
+		return c.ProgStatus()
+	}
+	if c.absentSFR(addr) {
+		return 0xFF
+	}
+	if c.latchRead && isPort(addr) {
+		return c.SFR(addr)
+	}
+	if !coreRegister(addr) && c.ReadCallbacks[addr] != nil {
+		return c.ReadCallbacks[addr]()
+	}
+	return c.SFR(addr)
+}
+
+//WriteDirect writes a byte using direct addressing, the counterpart
+//of ReadDirect. Write callbacks are used in place of the backing
+//store for any special function register which has one installed
+func (c *CPU) WriteDirect(addr uint8, val uint8) {
+	if addr < 0x80 {
+		c.InternalRAM[addr] = val
+		c.access(SpaceIRAM, uint16(addr), true, val)
+		return
+	}
+	c.access(SpaceSFR, uint16(addr), true, val)
+	if addr == IE || addr == IP {
+		c.holdoff = true
+	}
+	if c.absentSFR(addr) {
+		return
+	}
+	if !coreRegister(addr) && c.WriteCallbacks[addr] != nil {
+		c.WriteCallbacks[addr](val)
+		return
+	}
+	c.SetSFR(addr, val)
+}
@@ -0,0 +1,131 @@
+package mu51
+
+//Timer01 models the standard timer/counters 0 and 1. Their state lives
+//entirely in TMOD, TCON and TH0/TL0/TH1/TL1 so firmware and debuggers
+//see the counts directly
+type Timer01 struct {
+	//Overflows counts every overflow of each timer, including those
+	//of timer 1 which do not set TF1 while timer 0 is in mode 3.
+	//The serial port derives its baud clock from these
+	Overflows [2]uint64
+
+	lastT [2]bool //T0/T1 pin levels at the previous machine cycle
+}
+
+//timer control bits of TCON and TMOD
+const (
+	tconTF0 = 0x20
+	tconTR0 = 0x10
+	tconTF1 = 0x80
+	tconTR1 = 0x40
+
+	tmodGate = 0x08 //per timer nibble
+	tmodCT   = 0x04
+	tmodMode = 0x03
+)
+
+//Attach samples the counter input pins
+func (t *Timer01) Attach(c *CPU) {
+	t.lastT[0] = c.pinLevel(P3, 4)
+	t.lastT[1] = c.pinLevel(P3, 5)
+}
+
+//Reset resamples the counter inputs
+func (t *Timer01) Reset(c *CPU) {
+	t.Attach(c)
+}
+
+//Tick advances both timers by one machine cycle
+func (t *Timer01) Tick(c *CPU) {
+	tmod := c.SFR(TMOD)
+	tcon := c.SFR(TCON)
+
+	//counters increment on a falling edge of their T pin
+	var edge [2]bool
+	for n, bit := range []uint{4, 5} {
+		level := c.pinLevel(P3, bit)
+		edge[n] = t.lastT[n] && !level
+		t.lastT[n] = level
+	}
+
+	if tmod&tmodMode == 3 {
+		//timer 0 splits into TL0, run by timer 0's controls and
+		//setting TF0, and TH0 which counts cycles under TR1 and
+		//sets TF1. Timer 1 keeps running without raising TF1
+		counting := tmod&tmodCT == 0 || edge[0]
+		if t.running(c, tmod, tcon, 0) && counting && t.inc8(c, TL0) {
+			t.Overflows[0]++
+			tcon |= tconTF0
+		}
+		if tcon&tconTR1 != 0 && t.inc8(c, TH0) {
+			tcon |= tconTF1
+		}
+		if t.gated(c, tmod>>4, 1) && t.step(c, tmod>>4, edge[1], TL1, TH1) {
+			t.Overflows[1]++
+		}
+		c.SetSFR(TCON, tcon)
+		return
+	}
+
+	if t.running(c, tmod, tcon, 0) && t.step(c, tmod, edge[0], TL0, TH0) {
+		t.Overflows[0]++
+		tcon |= tconTF0
+	}
+	if t.running(c, tmod>>4, tcon, 1) && t.step(c, tmod>>4, edge[1], TL1, TH1) {
+		t.Overflows[1]++
+		tcon |= tconTF1
+	}
+	c.SetSFR(TCON, tcon)
+}
+
+//gated reports whether the GATE control of timer n permits counting,
+//with GATE set the timer only runs while its INTn pin is high
+func (t *Timer01) gated(c *CPU, mode uint8, n uint) bool {
+	return mode&tmodGate == 0 || c.pinLevel(P3, 2+n)
+}
+
+//running reports whether timer n is switched on by TRn and GATE
+func (t *Timer01) running(c *CPU, mode uint8, tcon uint8, n uint) bool {
+	tr := uint8(tconTR0)
+	if n == 1 {
+		tr = tconTR1
+	}
+	return tcon&tr != 0 && t.gated(c, mode, n)
+}
+
+//step increments a timer in modes 0 to 2 and reports an overflow,
+//mode holds the timer's TMOD nibble. A timer in mode 3 holds its count
+func (t *Timer01) step(c *CPU, mode uint8, edge bool, tl, th uint8) bool {
+	if mode&tmodCT != 0 && !edge {
+		return false
+	}
+	switch mode & tmodMode {
+	case 0: //13 bit, the low 5 bits of TL prescale TH
+		low := c.SFR(tl)
+		count := (low + 1) & 0x1F
+		c.SetSFR(tl, low&0xE0|count)
+		if count != 0 {
+			return false
+		}
+		return t.inc8(c, th)
+	case 1: //16 bit
+		if !t.inc8(c, tl) {
+			return false
+		}
+		return t.inc8(c, th)
+	case 2: //8 bit auto reload from TH
+		if !t.inc8(c, tl) {
+			return false
+		}
+		c.SetSFR(tl, c.SFR(th))
+		return true
+	}
+	return false
+}
+
+//inc8 increments an 8 bit timer register and reports an overflow
+func (t *Timer01) inc8(c *CPU, addr uint8) bool {
+	v := c.SFR(addr) + 1
+	c.SetSFR(addr, v)
+	return v == 0
+}
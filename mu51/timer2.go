@@ -0,0 +1,139 @@
+package mu51
+
+//Timer2 models the 8052 timer/counter 2. Like Timer01 its state
+//lives entirely in T2CON, T2MOD, RCAP2H/RCAP2L and TH2/TL2
+type Timer2 struct {
+	//Overflows counts every overflow, including those in baud rate
+	//generator mode which do not set TF2. The serial port derives
+	//its baud clock from these when RCLK or TCLK is set
+	Overflows uint64
+
+	lastT2   bool //T2 and T2EX pin levels at the previous machine cycle
+	lastT2EX bool
+	clocks   int //oscillator clocks not yet counted in baud rate mode
+}
+
+//timer 2 control bits of T2CON and T2MOD
+const (
+	t2conTF2   = 0x80
+	t2conEXF2  = 0x40
+	t2conRCLK  = 0x20
+	t2conTCLK  = 0x10
+	t2conEXEN2 = 0x08
+	t2conTR2   = 0x04
+	t2conCT2   = 0x02
+	t2conCPRL2 = 0x01
+
+	t2modDCEN = 0x01
+)
+
+//Attach samples the T2 and T2EX input pins
+func (t *Timer2) Attach(c *CPU) {
+	t.lastT2 = c.pinLevel(P1, 0)
+	t.lastT2EX = c.pinLevel(P1, 1)
+}
+
+//Reset resamples the T2 and T2EX inputs and clears the baud prescaler
+func (t *Timer2) Reset(c *CPU) {
+	t.Attach(c)
+	t.clocks = 0
+}
+
+//Tick advances timer 2 by one machine cycle
+func (t *Timer2) Tick(c *CPU) {
+	t2con := c.SFR(T2CON)
+	t2Level, exLevel := c.pinLevel(P1, 0), c.pinLevel(P1, 1)
+	t2Edge := t.lastT2 && !t2Level
+	exEdge := t.lastT2EX && !exLevel
+	t.lastT2, t.lastT2EX = t2Level, exLevel
+
+	//the number of counts this cycle, a timer in baud rate mode
+	//counts every other oscillator clock rather than every cycle
+	counts := 0
+	baud := t2con&(t2conRCLK|t2conTCLK) != 0
+	switch {
+	case t2con&t2conTR2 == 0:
+	case t2con&t2conCT2 != 0:
+		if t2Edge {
+			counts = 1
+		}
+	case baud:
+		t.clocks += c.clocksPerCycle()
+		counts = t.clocks / 2
+		t.clocks %= 2
+	default:
+		counts = 1
+	}
+
+	count := uint16(c.SFR(TH2))<<8 | uint16(c.SFR(TL2))
+	rcap := uint16(c.SFR(RCAP2H))<<8 | uint16(c.SFR(RCAP2L))
+	exen := t2con&t2conEXEN2 != 0
+
+	switch {
+	case baud:
+		//overflows reload and clock the serial port without
+		//setting TF2, T2EX may still raise EXF2
+		for i := 0; i < counts; i++ {
+			count++
+			if count == 0 {
+				count = rcap
+				t.Overflows++
+			}
+		}
+		if exen && exEdge {
+			t2con |= t2conEXF2
+		}
+	case t2con&t2conCPRL2 != 0:
+		//capture, a T2EX falling edge latches the count
+		if counts > 0 {
+			count++
+			if count == 0 {
+				t2con |= t2conTF2
+				t.Overflows++
+			}
+		}
+		if exen && exEdge {
+			c.SetSFR(RCAP2H, uint8(count>>8))
+			c.SetSFR(RCAP2L, uint8(count))
+			t2con |= t2conEXF2
+		}
+	case c.SFR(T2MOD)&t2modDCEN != 0:
+		//up/down auto reload, T2EX selects the direction and
+		//EXF2 toggles on every overflow or underflow
+		if counts > 0 {
+			switch {
+			case exLevel:
+				count++
+				if count == 0 {
+					count = rcap
+					t2con = (t2con | t2conTF2) ^ t2conEXF2
+					t.Overflows++
+				}
+			case count == rcap:
+				count = 0xFFFF
+				t2con = (t2con | t2conTF2) ^ t2conEXF2
+				t.Overflows++
+			default:
+				count--
+			}
+		}
+	default:
+		//auto reload on overflow or on a T2EX falling edge
+		if counts > 0 {
+			count++
+			if count == 0 {
+				count = rcap
+				t2con |= t2conTF2
+				t.Overflows++
+			}
+		}
+		if exen && exEdge {
+			count = rcap
+			t2con |= t2conEXF2
+		}
+	}
+
+	c.SetSFR(TH2, uint8(count>>8))
+	c.SetSFR(TL2, uint8(count))
+	c.SetSFR(T2CON, t2con)
+}
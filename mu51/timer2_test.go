@@ -0,0 +1,87 @@
+package mu51
+
+import (
+	"testing"
+)
+
+//newTimer2CPU returns a cpu clocking a Timer2 with the given registers
+func newTimer2CPU(regs map[uint8]uint8) (*CPU, *Timer2) {
+	c := newTestCPU(0x1000)
+	c.SetSFR(P1, 0xFF)
+	for addr, v := range regs {
+		c.SetSFR(addr, v)
+	}
+	t := &Timer2{}
+	c.AddPeripheral(t)
+	return c, t
+}
+
+func timer2Count(c *CPU) uint16 {
+	return uint16(c.SFR(TH2))<<8 | uint16(c.SFR(TL2))
+}
+
+func TestTimer2AutoReload(t *testing.T) {
+	c, _ := newTimer2CPU(map[uint8]uint8{T2CON: 0x0C, TH2: 0xFF, TL2: 0xFF, RCAP2H: 0x12, RCAP2L: 0x34})
+	c.advance(1)
+	if timer2Count(c) != 0x1234 || c.SFR(T2CON) != 0x8C {
+		t.Errorf("overflow gave count 0x%04X T2CON 0x%02X", timer2Count(c), c.SFR(T2CON))
+	}
+
+	//a falling edge on T2EX reloads early and raises EXF2
+	c.SetSFR(T2CON, 0x0C)
+	c.advance(4)
+	c.SetSFR(P1, 0xFD)
+	c.advance(1)
+	if timer2Count(c) != 0x1234 || c.SFR(T2CON) != 0x4C {
+		t.Errorf("T2EX gave count 0x%04X T2CON 0x%02X", timer2Count(c), c.SFR(T2CON))
+	}
+}
+
+func TestTimer2Capture(t *testing.T) {
+	c, _ := newTimer2CPU(map[uint8]uint8{T2CON: 0x0D, TH2: 0x56, TL2: 0x70})
+	c.advance(8)
+	c.SetSFR(P1, 0xFD)
+	c.advance(1)
+	if c.SFR(RCAP2H) != 0x56 || c.SFR(RCAP2L) != 0x79 || c.SFR(T2CON)&0x40 == 0 {
+		t.Errorf("captured 0x%02X%02X T2CON 0x%02X", c.SFR(RCAP2H), c.SFR(RCAP2L), c.SFR(T2CON))
+	}
+	if timer2Count(c) != 0x5679 {
+		t.Errorf("capture disturbed the count 0x%04X", timer2Count(c))
+	}
+}
+
+func TestTimer2UpDown(t *testing.T) {
+	//T2EX low counts down, underflowing at RCAP2 to 0xFFFF
+	c, _ := newTimer2CPU(map[uint8]uint8{T2CON: 0x04, T2MOD: 0x01, TH2: 0x10, TL2: 0x01, RCAP2H: 0x10})
+	c.SetSFR(P1, 0xFD)
+	c.advance(1)
+	if timer2Count(c) != 0x1000 || c.SFR(T2CON) != 0x04 {
+		t.Fatalf("count down gave 0x%04X T2CON 0x%02X", timer2Count(c), c.SFR(T2CON))
+	}
+	c.advance(1)
+	if timer2Count(c) != 0xFFFF || c.SFR(T2CON) != 0xC4 {
+		t.Errorf("underflow gave 0x%04X T2CON 0x%02X", timer2Count(c), c.SFR(T2CON))
+	}
+
+	//T2EX high counts up, EXF2 toggles back on the overflow
+	c.SetSFR(P1, 0xFF)
+	c.advance(1)
+	if timer2Count(c) != 0x1000 || c.SFR(T2CON) != 0x84 {
+		t.Errorf("overflow gave 0x%04X T2CON 0x%02X", timer2Count(c), c.SFR(T2CON))
+	}
+}
+
+func TestTimer2BaudRate(t *testing.T) {
+	//in baud rate mode the timer counts every other oscillator
+	//clock, reloading from RCAP2 without raising TF2
+	c, tm := newTimer2CPU(map[uint8]uint8{T2CON: 0x34, TH2: 0xFF, TL2: 0xFA, RCAP2H: 0xFF, RCAP2L: 0xDC})
+	c.advance(1)
+	if timer2Count(c) != 0xFFDC || tm.Overflows != 1 || c.SFR(T2CON) != 0x34 {
+		t.Errorf("12T cycle gave 0x%04X overflows %d T2CON 0x%02X", timer2Count(c), tm.Overflows, c.SFR(T2CON))
+	}
+	c.ClocksPerCycle = 1
+	c.advance(2)
+	if timer2Count(c) != 0xFFDD {
+		t.Errorf("1T cycles gave 0x%04X", timer2Count(c))
+	}
+}
@@ -0,0 +1,118 @@
+package mu51
+
+import (
+	"testing"
+)
+
+//newTimerCPU returns a cpu clocking a Timer01 with the given setup
+func newTimerCPU(tmod, tcon uint8, regs map[uint8]uint8) (*CPU, *Timer01) {
+	c := newTestCPU(0x1000, 0x80, 0xFE) //SJMP $
+	c.SetSFR(P3, 0xFF)
+	for addr, v := range regs {
+		c.SetSFR(addr, v)
+	}
+	c.SetSFR(TMOD, tmod)
+	c.SetSFR(TCON, tcon)
+	t := &Timer01{}
+	c.AddPeripheral(t)
+	return c, t
+}
+
+func TestTimerModes(t *testing.T) {
+	cases := []struct {
+		name       string
+		tmod, tcon uint8
+		regs       map[uint8]uint8
+		ticks      int
+		after      map[uint8]uint8
+		expected   uint8 //TCON afterwards
+	}{
+		{"mode 1 count", 0x01, 0x10, map[uint8]uint8{TH0: 0x12, TL0: 0xFF}, 1,
+			map[uint8]uint8{TH0: 0x13, TL0: 0x00}, 0x10},
+		{"mode 1 overflow", 0x01, 0x10, map[uint8]uint8{TH0: 0xFF, TL0: 0xFE}, 2,
+			map[uint8]uint8{TH0: 0x00, TL0: 0x00}, 0x30},
+		{"mode 0 prescale", 0x00, 0x10, map[uint8]uint8{TH0: 0x12, TL0: 0x1F}, 1,
+			map[uint8]uint8{TH0: 0x13, TL0: 0x00}, 0x10},
+		{"mode 0 overflow", 0x00, 0x10, map[uint8]uint8{TH0: 0xFF, TL0: 0x1F}, 1,
+			map[uint8]uint8{TH0: 0x00, TL0: 0x00}, 0x30},
+		{"mode 2 reload", 0x02, 0x10, map[uint8]uint8{TH0: 0xF0, TL0: 0xFF}, 1,
+			map[uint8]uint8{TH0: 0xF0, TL0: 0xF0}, 0x30},
+		{"stopped", 0x01, 0x00, map[uint8]uint8{TH0: 0xFF, TL0: 0xFF}, 1,
+			map[uint8]uint8{TH0: 0xFF, TL0: 0xFF}, 0x00},
+		{"timer 1 mode 1", 0x10, 0x40, map[uint8]uint8{TH1: 0xFF, TL1: 0xFF}, 1,
+			map[uint8]uint8{TH1: 0x00, TL1: 0x00}, 0xC0},
+	}
+	for _, v := range cases {
+		c, _ := newTimerCPU(v.tmod, v.tcon, v.regs)
+		c.advance(v.ticks)
+		for addr, want := range v.after {
+			if got := c.SFR(addr); got != want {
+				t.Errorf("%s: SFR 0x%02X is 0x%02X, expected 0x%02X", v.name, addr, got, want)
+			}
+		}
+		if got := c.SFR(TCON); got != v.expected {
+			t.Errorf("%s: TCON is 0x%02X, expected 0x%02X", v.name, got, v.expected)
+		}
+	}
+}
+
+func TestTimerSplitMode(t *testing.T) {
+	//TL0 overflows into TF0, TH0 runs under TR1 into TF1 and
+	//timer 1 in mode 2 overflows without touching TF1
+	c, tm := newTimerCPU(0x23, 0x50, map[uint8]uint8{TL0: 0xFF, TH0: 0x10, TL1: 0xFF, TH1: 0x80})
+	c.advance(1)
+	if c.SFR(TCON) != 0x70 || c.SFR(TH0) != 0x11 || c.SFR(TL1) != 0x80 {
+		t.Errorf("TCON 0x%02X TH0 0x%02X TL1 0x%02X", c.SFR(TCON), c.SFR(TH0), c.SFR(TL1))
+	}
+	if tm.Overflows != [2]uint64{1, 1} {
+		t.Errorf("overflows %v", tm.Overflows)
+	}
+	c.SetSFR(TH0, 0xFF)
+	c.advance(1)
+	if c.SFR(TCON)&0x80 == 0 {
+		t.Error("TH0 overflow did not set TF1")
+	}
+}
+
+func TestTimerGateAndCounter(t *testing.T) {
+	//GATE holds the timer while INT0 is low
+	c, _ := newTimerCPU(0x09, 0x10, nil)
+	c.SetSFR(P3, 0xFB)
+	c.advance(3)
+	if c.SFR(TL0) != 0 {
+		t.Error("gated timer counted with INT0 low")
+	}
+	c.SetSFR(P3, 0xFF)
+	c.advance(3)
+	if c.SFR(TL0) != 3 {
+		t.Errorf("gated timer counted %d with INT0 high", c.SFR(TL0))
+	}
+
+	//a counter only increments on falling edges of T0
+	c, _ = newTimerCPU(0x05, 0x10, nil)
+	for i := 0; i < 4; i++ {
+		c.SetSFR(P3, 0xEF)
+		c.advance(2)
+		c.SetSFR(P3, 0xFF)
+		c.advance(2)
+	}
+	if c.SFR(TL0) != 4 {
+		t.Errorf("counter counted %d edges, expected 4", c.SFR(TL0))
+	}
+}
+
+func TestTimerInterrupt(t *testing.T) {
+	c, _ := newTimerCPU(0x01, 0x10, map[uint8]uint8{TH0: 0xFF, TL0: 0xFC, IE: 0x82})
+	for i := 0; i < 2; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.ProgCount != 0x1000 || c.SFR(TCON)&0x20 == 0 {
+		t.Fatalf("timer 0 did not overflow after 4 cycles, TL0 0x%02X", c.SFR(TL0))
+	}
+	c.Step()
+	if c.ProgCount != 0x000B {
+		t.Errorf("timer 0 overflow not serviced, PC 0x%04X", c.ProgCount)
+	}
+}
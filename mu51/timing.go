@@ -0,0 +1,59 @@
+package mu51
+
+import (
+	"time"
+)
+
+//DefaultClocksPerCycle is the machine cycle length of the classic
+//12 clock core, 6T and 1T derivatives divide this down
+const DefaultClocksPerCycle = 12
+
+//DefaultOscillatorHz is the common UART friendly 11.0592MHz crystal
+const DefaultOscillatorHz = 11059200
+
+//clocksPerCycle returns the configured machine cycle length in clocks
+func (c *CPU) clocksPerCycle() int {
+	if c.ClocksPerCycle <= 0 {
+		return DefaultClocksPerCycle
+	}
+	return c.ClocksPerCycle
+}
+
+//oscillatorHz returns the configured oscillator frequency
+func (c *CPU) oscillatorHz() float64 {
+	if c.OscillatorHz <= 0 {
+		return DefaultOscillatorHz
+	}
+	return c.OscillatorHz
+}
+
+//advance accounts for n machine cycles having passed,
+//clocking every peripheral once per cycle
+func (c *CPU) advance(n int) {
+	if c.idling {
+		c.Power.Idle += uint64(n)
+	} else {
+		c.Power.Active += uint64(n)
+	}
+	for i := 0; i < n; i++ {
+		c.Cycles++
+		for _, p := range c.Peripherals {
+			p.Tick(c)
+		}
+	}
+}
+
+//Clocks returns the number of oscillator clocks executed
+func (c *CPU) Clocks() uint64 {
+	return c.Cycles * uint64(c.clocksPerCycle())
+}
+
+//Elapsed returns the simulated time taken by the executed cycles
+func (c *CPU) Elapsed() time.Duration {
+	return time.Duration(float64(c.Clocks()) / c.oscillatorHz() * float64(time.Second))
+}
+
+//CycleTime returns the duration of a single machine cycle
+func (c *CPU) CycleTime() time.Duration {
+	return time.Duration(float64(c.clocksPerCycle()) / c.oscillatorHz() * float64(time.Second))
+}
@@ -0,0 +1,41 @@
+package mu51
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCycleCounting(t *testing.T) {
+	c := newTestCPU(0x0000,
+		0x00,             //0000 NOP        1 cycle
+		0x02, 0x00, 0x04, //0001 LJMP 0004h 2 cycles
+		0xA4,       //0004 MUL AB     4 cycles
+		0x80, 0xFE, //0005 SJMP $     2 cycles
+	)
+	for i := 0; i < 4; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Cycles != 9 {
+		t.Errorf("expected 9 cycles, got %d", c.Cycles)
+	}
+	if c.Clocks() != 108 {
+		t.Errorf("expected 108 clocks, got %d", c.Clocks())
+	}
+}
+
+func TestElapsed(t *testing.T) {
+	c := &CPU{ALU: &ALU{}, OscillatorHz: 12000000, Cycles: 1000}
+	if c.Elapsed() != time.Millisecond {
+		t.Errorf("12T core at 12MHz took %s for 1000 cycles", c.Elapsed())
+	}
+	c.ClocksPerCycle = 1
+	if c.Elapsed() != time.Millisecond/12 {
+		t.Errorf("1T core at 12MHz took %s for 1000 cycles", c.Elapsed())
+	}
+	c.ClocksPerCycle, c.OscillatorHz = 0, 0
+	if c.CycleTime() != 1085*time.Nanosecond {
+		t.Errorf("default oscillator gave a cycle time of %s", c.CycleTime())
+	}
+}
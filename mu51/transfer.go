@@ -0,0 +1,98 @@
+package mu51
+
+import (
+	"errors"
+	"io"
+)
+
+//ErrNoExtRAM is the cause of the fault raised when a MOVX is
+//executed without any external ram attached to the CPU
+var ErrNoExtRAM = errors.New("no external ram attached")
+
+//InstrPUSH pushes a byte onto the stack read from
+//the specified direct address
+func (c *CPU) InstrPUSH(loc uint8) {
+	c.PushByte(c.ReadDirect(loc))
+}
+
+//InstrPOP pops a byte off the stack and places it in
+//the specified direct address
+func (c *CPU) InstrPOP(loc uint8) {
+	c.WriteDirect(loc, c.PopByte())
+}
+
+//InstrXCHD exchanges the low nibble of the accumulator with the
+//low nibble of the internal ram location addressed by R0 or R1
+func (a *ALU) InstrXCHD(R1 bool) {
+	var addr uint8
+	if R1 {
+		addr = a.Reg(1)
+	} else {
+		addr = a.Reg(0)
+	}
+	acc := a.Accum()
+	val := a.ReadIndirect(addr)
+	a.SetAccum(acc&0xF0 | val&0x0F)
+	a.WriteIndirect(addr, val&0xF0|acc&0x0F)
+}
+
+//InstrMOVC loads the accumulator from code memory at the
+//accumulator offset from base, base is either DPTR or the
+//address of the following instruction
+func (c *CPU) InstrMOVC(base uint16) error {
+	b := make([]byte, 1)
+	addr := base + uint16(c.Accum())
+	err := ErrCodeBounds
+	if c.inCode(addr, 1) {
+		err = readCode(c.ProgMem, b, int64(addr))
+	}
+	if err != nil {
+		return &Fault{Kind: FaultCodeBounds, Addr: addr, Err: err}
+	}
+	c.access(SpaceCode, addr, false, b[0])
+	c.SetAccum(b[0])
+	return nil
+}
+
+//xdataInd returns the external ram address used by the MOVX @Ri
+//forms, Ri supplies the low byte and the P2 latch the high byte
+func (c *CPU) xdataInd(r uint8) uint16 {
+	return uint16(c.SFR(P2))<<8 | uint16(c.Reg(r))
+}
+
+//InstrMOVXLoad executes a MOVX load from external ram into the accumulator
+func (c *CPU) InstrMOVXLoad(addr uint16) error {
+	if c.ExtRAM == nil {
+		return &Fault{Kind: FaultXDATA, Addr: addr, Err: ErrNoExtRAM}
+	}
+	b := make([]byte, 1)
+	n, err := c.ExtRAM.ReadAt(b, int64(addr))
+	if n != 1 {
+		return xdataFault(addr, err)
+	}
+	c.access(SpaceXDATA, addr, false, b[0])
+	c.SetAccum(b[0])
+	return nil
+}
+
+//InstrMOVXStore executes a MOVX store of the accumulator into external ram
+func (c *CPU) InstrMOVXStore(addr uint16) error {
+	if c.ExtRAM == nil {
+		return &Fault{Kind: FaultXDATA, Addr: addr, Err: ErrNoExtRAM}
+	}
+	n, err := c.ExtRAM.WriteAt([]byte{c.Accum()}, int64(addr))
+	if n != 1 {
+		return xdataFault(addr, err)
+	}
+	c.access(SpaceXDATA, addr, true, c.Accum())
+	return nil
+}
+
+//xdataFault reports a failed external ram access, a short access
+//without an error is past the end of the ram
+func xdataFault(addr uint16, err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	return &Fault{Kind: FaultXDATA, Addr: addr, Err: err}
+}
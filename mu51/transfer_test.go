@@ -0,0 +1,147 @@
+package mu51
+
+import (
+	"errors"
+	"testing"
+)
+
+//testRAM is a flat external ram for test programs
+type testRAM []byte
+
+func (r testRAM) ReadAt(b []byte, off int64) (int, error) {
+	return testROM(r).ReadAt(b, off)
+}
+
+func (r testRAM) WriteAt(b []byte, off int64) (int, error) {
+	return copy(r[off:], b), nil
+}
+
+func (r testRAM) Size() int64 {
+	return int64(len(r))
+}
+
+func TestMOV(t *testing.T) {
+	runBranchCases(t, []branchCase{
+		{"MOV A,#data", []byte{0x74, 0x5A}, nil, 0x1002, func(c *CPU) bool { return c.Accum() == 0x5A }},
+		{"MOV direct,#data", []byte{0x75, 0xF0, 0x12}, nil, 0x1003, func(c *CPU) bool { return c.BReg() == 0x12 }},
+		{"MOV @Ri,#data", []byte{0x77, 0x99}, func(c *CPU) { c.SetReg(1, 0xF0) }, 0x1002,
+			func(c *CPU) bool { return c.InternalRAM[0xF0] == 0x99 && c.BReg() == 0 }},
+		{"MOV Rn,#data", []byte{0x7D, 0x33}, func(c *CPU) { c.SetProgStatus(RS0Bit | RS1Bit) }, 0x1002,
+			func(c *CPU) bool { return c.InternalRAM[0x1D] == 0x33 }},
+		{"MOV direct,direct", []byte{0x85, 0x30, 0xE0}, func(c *CPU) { c.InternalRAM[0x30] = 0x44 }, 0x1003,
+			func(c *CPU) bool { return c.Accum() == 0x44 }},
+		{"MOV direct,@Ri", []byte{0x86, 0x40}, func(c *CPU) {
+			c.SetReg(0, 0x80)
+			c.InternalRAM[0x80] = 0x21
+		}, 0x1002, func(c *CPU) bool { return c.InternalRAM[0x40] == 0x21 }},
+		{"MOV direct,Rn", []byte{0x8F, 0x81}, func(c *CPU) { c.SetReg(7, 0x50) }, 0x1002,
+			func(c *CPU) bool { return c.StackPtr() == 0x50 }},
+		{"MOV DPTR,#data16", []byte{0x90, 0x12, 0x34}, nil, 0x1003, func(c *CPU) bool { return c.DataPtr() == 0x1234 }},
+		{"MOV bit,C", []byte{0x92, 0x00}, setCarry, 0x1002, func(c *CPU) bool { return c.InternalRAM[0x20] == 0x01 }},
+		{"MOV C,bit", []byte{0xA2, 0xE7}, func(c *CPU) { c.SetAccum(0x80) }, 0x1002, carry},
+		{"MOV @Ri,direct", []byte{0xA6, 0xF0}, func(c *CPU) {
+			c.SetReg(0, 0xF0)
+			c.SetBReg(0x77)
+		}, 0x1002, func(c *CPU) bool { return c.InternalRAM[0xF0] == 0x77 }},
+		{"MOV Rn,direct", []byte{0xA9, 0x30}, func(c *CPU) { c.InternalRAM[0x30] = 0x66 }, 0x1002,
+			func(c *CPU) bool { return c.Reg(1) == 0x66 }},
+		{"MOV A,direct", []byte{0xE5, 0xD0}, func(c *CPU) { c.SetProgStatus(FlagBit) }, 0x1002,
+			func(c *CPU) bool { return c.Accum() == FlagBit }},
+		{"MOV A,@Ri", []byte{0xE7}, func(c *CPU) {
+			c.SetReg(1, 0x31)
+			c.InternalRAM[0x31] = 0x0F
+		}, 0x1001, func(c *CPU) bool { return c.Accum() == 0x0F }},
+		{"MOV A,Rn", []byte{0xEC}, func(c *CPU) { c.SetReg(4, 0x24) }, 0x1001, func(c *CPU) bool { return c.Accum() == 0x24 }},
+		{"MOV direct,A", []byte{0xF5, 0x82}, func(c *CPU) { c.SetAccum(0x9A) }, 0x1002,
+			func(c *CPU) bool { return c.DataPtr() == 0x009A }},
+		{"MOV @Ri,A", []byte{0xF6}, func(c *CPU) {
+			c.SetReg(0, 0xE0)
+			c.SetAccum(0x11)
+		}, 0x1001, func(c *CPU) bool { return c.InternalRAM[0xE0] == 0x11 }},
+		{"MOV Rn,A", []byte{0xFA}, func(c *CPU) { c.SetAccum(0x3C) }, 0x1001, func(c *CPU) bool { return c.Reg(2) == 0x3C }},
+	})
+}
+
+func TestMOVC(t *testing.T) {
+	c := newTestCPU(0x1000, 0x93, 0x83)
+	rom := c.ProgMem.(testROM)
+	rom[0x2005] = 0xAB
+	rom[0x1007] = 0xCD
+	c.SetDataPtr(0x2000)
+	c.SetAccum(0x05)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Accum() != 0xAB {
+		t.Errorf("MOVC A,@A+DPTR loaded 0x%02X", c.Accum())
+	}
+	c.SetAccum(0x05)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Accum() != 0xCD {
+		t.Errorf("MOVC A,@A+PC loaded 0x%02X", c.Accum())
+	}
+}
+
+func TestMOVX(t *testing.T) {
+	c := newTestCPU(0x1000, 0xF0, 0xE3, 0xF2, 0xE0)
+	xram := make(testRAM, 0x10000)
+	c.ExtRAM = xram
+	xram[0x4210] = 0x5E
+	c.SetDataPtr(0x0123)
+	c.SetAccum(0x77)
+	c.SetSFR(P2, 0x42)
+	c.SetReg(0, 0x20)
+	c.SetReg(1, 0x10)
+	for i := 0; i < 4; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if xram[0x0123] != 0x77 {
+		t.Error("MOVX @DPTR,A did not store")
+	}
+	if xram[0x4220] != 0x5E {
+		t.Error("MOVX A,@R1 / MOVX @R0,A did not use P2 as the high byte")
+	}
+	if c.Accum() != 0x77 {
+		t.Errorf("MOVX A,@DPTR loaded 0x%02X", c.Accum())
+	}
+	c = newTestCPU(0, 0xE0)
+	if err := c.Step(); !errors.Is(err, ErrNoExtRAM) {
+		t.Error("MOVX without external ram did not fail")
+	}
+}
+
+func TestXCHD(t *testing.T) {
+	c := newTestCPU(0, 0xD7)
+	c.SetReg(1, 0x90)
+	c.InternalRAM[0x90] = 0x12
+	c.SetAccum(0x34)
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Accum() != 0x32 || c.InternalRAM[0x90] != 0x14 {
+		t.Errorf("XCHD gave A=%02X @R1=%02X", c.Accum(), c.InternalRAM[0x90])
+	}
+}
+
+func TestPushPopCallbacks(t *testing.T) {
+	c := newTestCPU(0, 0xC0, 0x90, 0xD0, 0x98)
+	var scon uint8
+	c.ReadCallbacks[P1] = func() uint8 { return 0xA5 }
+	c.WriteCallbacks[SCON] = func(v uint8) { scon = v }
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.InternalRAM[0x08] != 0xA5 {
+		t.Error("PUSH did not read P1 through its callback")
+	}
+	if err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if scon != 0xA5 || c.StackPtr() != 0x07 {
+		t.Error("POP did not write SCON through its callback")
+	}
+}
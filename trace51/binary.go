@@ -0,0 +1,207 @@
+package trace51
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//binaryMagic starts every binary trace, the last byte is the version
+var binaryMagic = []byte{'T', '5', '1', 1}
+
+//ErrBadTrace is returned when reading a stream which is not a valid
+//binary trace
+var ErrBadTrace = errors.New("not a binary trace")
+
+//BinaryWriter writes a trace in the compact binary form. After the four
+//byte header "T51\x01" each record is encoded as
+//
+//	uvarint  cycles since the previous record
+//	uint16   PC, little endian
+//	byte     opcode length, then the opcode bytes, or zero then
+//	         the interrupt source for vectoring
+//	byte     number of changes, then for each the Reg and its
+//	         value, a uint16 for DPTR and a byte otherwise
+//	uvarint  number of writes, then for each the Space, the
+//	         address as a uint16 and the value
+//
+//The disassembly is not stored, it is decoded again from the opcode
+//bytes when read. Output is buffered until Flush
+type BinaryWriter struct {
+	w       *bufio.Writer
+	started bool
+	cycle   uint64
+	buf     []byte
+}
+
+//NewBinaryWriter returns a BinaryWriter writing to w
+func NewBinaryWriter(w io.Writer) *BinaryWriter {
+	return &BinaryWriter{w: bufio.NewWriter(w)}
+}
+
+//WriteRecord encodes a record
+func (b *BinaryWriter) WriteRecord(r *Record) error {
+	buf := b.buf[:0]
+	if !b.started {
+		buf = append(buf, binaryMagic...)
+		b.started = true
+	}
+	buf = binary.AppendUvarint(buf, r.Cycle-b.cycle)
+	b.cycle = r.Cycle
+	buf = binary.LittleEndian.AppendUint16(buf, r.PC)
+	buf = append(buf, byte(len(r.Bytes)))
+	buf = append(buf, r.Bytes...)
+	if r.Vectored() {
+		buf = append(buf, byte(r.Source))
+	}
+	buf = append(buf, byte(len(r.Changes)))
+	for _, c := range r.Changes {
+		buf = append(buf, byte(c.Reg))
+		if c.Reg == RegDPTR {
+			buf = binary.LittleEndian.AppendUint16(buf, c.Value)
+		} else {
+			buf = append(buf, byte(c.Value))
+		}
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(r.Writes)))
+	for _, a := range r.Writes {
+		buf = append(buf, byte(a.Space))
+		buf = binary.LittleEndian.AppendUint16(buf, a.Addr)
+		buf = append(buf, a.Value)
+	}
+	b.buf = buf
+	_, err := b.w.Write(buf)
+	return err
+}
+
+//Flush writes any buffered output
+func (b *BinaryWriter) Flush() error {
+	return b.w.Flush()
+}
+
+//BinaryReader reads records written by a BinaryWriter
+type BinaryReader struct {
+	r       *bufio.Reader
+	started bool
+	cycle   uint64
+
+	//Symbols, when set, are used in the disassembly
+	Symbols *dis51.Symbols
+}
+
+//NewBinaryReader returns a BinaryReader reading from r
+func NewBinaryReader(r io.Reader) *BinaryReader {
+	return &BinaryReader{r: bufio.NewReader(r)}
+}
+
+//Read returns the next record, or io.EOF at the end of the trace
+func (b *BinaryReader) Read() (*Record, error) {
+	if !b.started {
+		magic := make([]byte, len(binaryMagic))
+		if _, err := io.ReadFull(b.r, magic); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, ErrBadTrace
+		}
+		if string(magic) != string(binaryMagic) {
+			return nil, ErrBadTrace
+		}
+		b.started = true
+	}
+	delta, err := binary.ReadUvarint(b.r)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := b.read()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	b.cycle += delta
+	rec.Cycle = b.cycle
+	return rec, nil
+}
+
+//read decodes the remainder of a record after its cycle
+func (b *BinaryReader) read() (*Record, error) {
+	var rec Record
+	var pc [2]byte
+	if _, err := io.ReadFull(b.r, pc[:]); err != nil {
+		return nil, err
+	}
+	rec.PC = binary.LittleEndian.Uint16(pc[:])
+	n, err := b.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		src, err := b.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		rec.Source = int(src)
+		rec.Text = vectorText(rec.Source)
+	} else {
+		rec.Bytes = make([]byte, n)
+		if _, err := io.ReadFull(b.r, rec.Bytes); err != nil {
+			return nil, err
+		}
+		in, err := mu51.Decode(rec.PC, rec.Bytes)
+		if err != nil {
+			return nil, ErrBadTrace
+		}
+		rec.Text = dis51.Format(in, b.Symbols)
+	}
+
+	if n, err = b.r.ReadByte(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(n); i++ {
+		reg, err := b.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if Reg(reg) >= numRegs {
+			return nil, ErrBadTrace
+		}
+		size := 1
+		if Reg(reg) == RegDPTR {
+			size = 2
+		}
+		var v [2]byte
+		if _, err := io.ReadFull(b.r, v[:size]); err != nil {
+			return nil, err
+		}
+		rec.Changes = append(rec.Changes, Change{Reg: Reg(reg), Value: binary.LittleEndian.Uint16(v[:])})
+	}
+
+	writes, err := binary.ReadUvarint(b.r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < writes; i++ {
+		var w [4]byte
+		if _, err := io.ReadFull(b.r, w[:]); err != nil {
+			return nil, err
+		}
+		rec.Writes = append(rec.Writes, mu51.Access{
+			Space: mu51.Space(w[0]),
+			Addr:  binary.LittleEndian.Uint16(w[1:3]),
+			Write: true,
+			Value: w[3],
+		})
+	}
+	return &rec, nil
+}
+
+//unexpected reports a trace cut short within a record
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
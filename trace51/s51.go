@@ -0,0 +1,159 @@
+package trace51
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//S51Writer writes a trace as the s51 simulator prints it while single
+//stepping, so that a trace can be compared with a session of s51 step
+//commands over the same firmware. Each record is written as the block
+//s51 prints after a step: the active register bank, R0 and R1 with the
+//bytes they point at, ACC, B, DPTR and the external byte it points at,
+//PSW and its flags, then the next instruction in s51's disassembly
+//
+//	0x00 00 00 00 00 00 00 00 00 ........
+//	000000 00 .  ACC= 0x5a  90 Z  B= 0x00   DPTR= 0x1234 @DPTR= 0x00   0 .
+//	000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+//	   0x0008 f0       MOVX  @DPTR,A
+//
+//The registers are read from the CPU as each record is written, so the
+//writer must be attached to a Tracer of that CPU rather than used to
+//convert a stored trace. External ram is peeked so memory mapped
+//registers see no reads. Output is buffered until Flush
+type S51Writer struct {
+	w *bufio.Writer
+	c *mu51.CPU
+}
+
+//NewS51Writer returns an S51Writer writing the state of c to w
+func NewS51Writer(w io.Writer, c *mu51.CPU) *S51Writer {
+	return &S51Writer{w: bufio.NewWriter(w), c: c}
+}
+
+//printable returns b as s51 shows it beside its value
+func printable(b uint8) byte {
+	if b < 0x20 || b > 0x7E {
+		return '.'
+	}
+	return b
+}
+
+//WriteRecord writes the state of the CPU after the record and the
+//instruction it will execute next
+func (s *S51Writer) WriteRecord(r *Record) error {
+	c := s.c
+	bank := c.ProgStatus() & 0x18
+	regs := c.InternalRAM[bank : bank+8]
+	fmt.Fprintf(s.w, "0x%02x", bank)
+	for _, b := range regs {
+		fmt.Fprintf(s.w, " %02x", b)
+	}
+	s.w.WriteByte(' ')
+	for _, b := range regs {
+		s.w.WriteByte(printable(b))
+	}
+	s.w.WriteByte('\n')
+
+	at := c.InternalRAM[regs[0]]
+	a := c.Accum()
+	fmt.Fprintf(s.w, "%06x %02x %c  ACC= 0x%02x %3d %c  B= 0x%02x", regs[0], at, printable(at), a, a, printable(a), c.BReg())
+	var x [1]byte
+	if p, ok := c.ExtRAM.(mu51.Peeker); ok {
+		p.PeekAt(x[:], int64(c.DataPtr()))
+	} else if c.ExtRAM != nil {
+		c.ExtRAM.ReadAt(x[:], int64(c.DataPtr()))
+	}
+	fmt.Fprintf(s.w, "   DPTR= 0x%04x @DPTR= 0x%02x %3d %c\n", c.DataPtr(), x[0], x[0], printable(x[0]))
+
+	at = c.InternalRAM[regs[1]]
+	psw := c.ProgStatus()
+	flag := func(mask uint8) int {
+		if psw&mask != 0 {
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintf(s.w, "%06x %02x %c  PSW= 0x%02x CY=%d AC=%d OV=%d P=%d\n", regs[1], at, printable(at), psw,
+		flag(mu51.CarryBit), flag(mu51.AuxCarryBit), flag(mu51.OverFlowBit), flag(mu51.ParityBit))
+
+	pc := c.ProgCount
+	in, err := mu51.ReadInstruction(c.ProgMem, int64(pc))
+	if err != nil {
+		_, err = fmt.Fprintf(s.w, "   0x%04x %s\n", pc, s51Unknown)
+		return err
+	}
+	raw := make([]string, len(in.Bytes))
+	for i, b := range in.Bytes {
+		raw[i] = fmt.Sprintf("%02x", b)
+	}
+	_, err = fmt.Fprintf(s.w, "   0x%04x %-8s %s\n", pc, strings.Join(raw, " "), FormatS51(in))
+	return err
+}
+
+//Flush writes any buffered output
+func (s *S51Writer) Flush() error {
+	return s.w.Flush()
+}
+
+//s51Unknown is what s51 disassembles an undefined opcode as
+const s51Unknown = "-- UNKNOWN/INVALID"
+
+//FormatS51 renders a decoded instruction as the s51 disassembler does,
+//the mnemonic padded to six columns and numbers in bare lower case hex
+func FormatS51(in mu51.Instruction) string {
+	if in.Op == mu51.ERR {
+		return s51Unknown
+	}
+	if len(in.Operands) == 0 {
+		return in.Op.String()
+	}
+	ops := make([]string, len(in.Operands))
+	for i, o := range in.Operands {
+		ops[i] = formatS51Operand(o)
+	}
+	return fmt.Sprintf("%-6s%s", in.Op.String(), strings.Join(ops, ","))
+}
+
+//s51Direct names a direct address as s51 does
+func s51Direct(addr uint8) string {
+	if addr >= 0x80 {
+		if name, ok := mu51.SFRName(addr); ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("%02x", addr)
+}
+
+//s51Bit names a bit address as s51 does, by its byte and bit number
+//where it has no name of its own
+func s51Bit(bit uint8) string {
+	if name, ok := mu51.BitName(bit); ok {
+		return name
+	}
+	addr, _ := mu51.BitLocation(bit)
+	return fmt.Sprintf("%s.%d", s51Direct(addr), bit&0x07)
+}
+
+func formatS51Operand(o mu51.Operand) string {
+	switch o.Kind {
+	case mu51.OperandImm:
+		return fmt.Sprintf("#%02x", o.Value)
+	case mu51.OperandImm16:
+		return fmt.Sprintf("#%04x", o.Value)
+	case mu51.OperandDirect:
+		return s51Direct(uint8(o.Value))
+	case mu51.OperandBit:
+		return s51Bit(uint8(o.Value))
+	case mu51.OperandNotBit:
+		return "/" + s51Bit(uint8(o.Value))
+	case mu51.OperandRel, mu51.OperandAddr11, mu51.OperandAddr16:
+		return fmt.Sprintf("%04x", o.Value)
+	}
+	return dis51.FormatOperand(o, nil)
+}
@@ -0,0 +1,55 @@
+package trace51
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//TextWriter writes a trace as text, one line per instruction: the
+//cycle, address, opcode bytes and disassembly followed by the registers
+//changed and memory written. Output is buffered until Flush
+type TextWriter struct {
+	w *bufio.Writer
+}
+
+//NewTextWriter returns a TextWriter writing to w
+func NewTextWriter(w io.Writer) *TextWriter {
+	return &TextWriter{w: bufio.NewWriter(w)}
+}
+
+//FormatRecord returns the text form of a record without a newline
+func FormatRecord(r *Record) string {
+	raw := make([]string, len(r.Bytes))
+	for i, b := range r.Bytes {
+		raw[i] = fmt.Sprintf("%02x", b)
+	}
+	line := fmt.Sprintf("%10d %04x %-8s  %-22s", r.Cycle, r.PC, strings.Join(raw, " "), r.Text)
+	var effects []string
+	for _, c := range r.Changes {
+		if c.Reg == RegDPTR {
+			effects = append(effects, fmt.Sprintf("%s=%04x", c.Reg, c.Value))
+		} else {
+			effects = append(effects, fmt.Sprintf("%s=%02x", c.Reg, c.Value))
+		}
+	}
+	for _, a := range r.Writes {
+		effects = append(effects, fmt.Sprintf("%s[%x]=%02x", a.Space, a.Addr, a.Value))
+	}
+	if len(effects) > 0 {
+		line += " ; " + strings.Join(effects, " ")
+	}
+	return strings.TrimRight(line, " ")
+}
+
+//WriteRecord writes a record as a line of text
+func (t *TextWriter) WriteRecord(r *Record) error {
+	_, err := fmt.Fprintln(t.w, FormatRecord(r))
+	return err
+}
+
+//Flush writes any buffered output
+func (t *TextWriter) Flush() error {
+	return t.w.Flush()
+}
@@ -0,0 +1,231 @@
+//Package trace51 records per instruction execution traces of firmware
+//running on the mu51 emulator. Each record holds the cycle, PC, opcode
+//bytes and disassembly of an instruction along with the registers it
+//changed and the memory it wrote, interrupt vectoring is recorded the
+//same way. Traces are written as text, one line per instruction for
+//diffing runs, as the step output of the s51 simulator for comparing
+//against it, or in a compact binary form
+package trace51
+
+import (
+	"fmt"
+
+	"github.com/JonathanFraser/go51/dis51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+//Reg identifies a register tracked between instructions
+type Reg uint8
+
+const (
+	RegR0 Reg = iota //R0-R7 of the active bank
+	RegR1
+	RegR2
+	RegR3
+	RegR4
+	RegR5
+	RegR6
+	RegR7
+	RegA
+	RegB
+	RegDPTR //the active data pointer
+	RegSP
+	RegPSW
+	numRegs
+)
+
+//regNames are the names of each Reg
+var regNames = []string{"R0", "R1", "R2", "R3", "R4", "R5", "R6", "R7", "A", "B", "DPTR", "SP", "PSW"}
+
+func (r Reg) String() string {
+	if r >= numRegs {
+		return fmt.Sprintf("reg %d", int(r))
+	}
+	return regNames[r]
+}
+
+//Change is the new value of a register changed by an instruction
+type Change struct {
+	Reg   Reg
+	Value uint16
+}
+
+//Record is the trace of a single instruction, or of vectoring to an
+//interrupt handler when it has no opcode bytes
+type Record struct {
+	Cycle   uint64 //machine cycle the instruction started on
+	PC      uint16 //address of the instruction, or the return address pushed
+	Bytes   []byte
+	Source  int    //interrupt source vectored to
+	Text    string //disassembly
+	Changes []Change
+	Writes  []mu51.Access //memory written, in order
+}
+
+//Vectored reports whether the record is of vectoring to an interrupt
+func (r *Record) Vectored() bool {
+	return len(r.Bytes) == 0
+}
+
+//vectorText describes vectoring to the handler of src in place of
+//a disassembly
+func vectorText(src int) string {
+	return fmt.Sprintf("interrupt %d -> %s", src, dis51.Hex(mu51.InterruptVector(src), 4))
+}
+
+//Range is an inclusive range of code addresses
+type Range struct {
+	Start, End uint16
+}
+
+//RecordWriter is implemented by the trace formats
+type RecordWriter interface {
+	WriteRecord(r *Record) error
+}
+
+//Tracer records every instruction a CPU executes and every interrupt
+//it vectors to, to a RecordWriter
+type Tracer struct {
+	//Ranges limits tracing to instructions within them and interrupts
+	//whose vector is within them, when empty everything is traced
+	Ranges []Range
+
+	//Symbols, when set, are used in the disassembly
+	Symbols *dis51.Symbols
+
+	c          *mu51.CPU
+	out        RecordWriter
+	prevAccess func(mu51.Access)
+	prevObs    mu51.Observer
+
+	rec    *Record //record of the executing instruction, nil when filtered
+	before [numRegs]uint16
+	err    error
+}
+
+//Attach starts tracing c to out, any observer or access hook already
+//installed on the CPU is still called
+func Attach(c *mu51.CPU, out RecordWriter) *Tracer {
+	t := &Tracer{c: c, out: out, prevAccess: c.OnAccess, prevObs: c.Observer}
+	c.OnAccess = t.onAccess
+	c.Observer = t
+	return t
+}
+
+//Detach stops tracing, restoring the hooks replaced by Attach
+func (t *Tracer) Detach() {
+	t.c.OnAccess = t.prevAccess
+	t.c.Observer = t.prevObs
+}
+
+//Err returns the first error writing the trace, tracing stops after it
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+//traced reports whether the instruction at pc is to be traced
+func (t *Tracer) traced(pc uint16) bool {
+	if len(t.Ranges) == 0 {
+		return true
+	}
+	for _, r := range t.Ranges {
+		if pc >= r.Start && pc <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+//regs returns the values of the tracked registers
+func regs(c *mu51.CPU) [numRegs]uint16 {
+	var v [numRegs]uint16
+	bank := int(c.ProgStatus()>>3&0x03) * 8
+	for i := 0; i < 8; i++ {
+		v[RegR0+Reg(i)] = uint16(c.InternalRAM[bank+i])
+	}
+	v[RegA] = uint16(c.Accum())
+	v[RegB] = uint16(c.BReg())
+	v[RegDPTR] = c.DataPtr()
+	v[RegSP] = uint16(c.StackPtr())
+	v[RegPSW] = uint16(c.ProgStatus())
+	return v
+}
+
+//BeforeInstruction starts the record of an instruction
+func (t *Tracer) BeforeInstruction(c *mu51.CPU, pc uint16, in mu51.Instruction) {
+	if t.prevObs != nil {
+		t.prevObs.BeforeInstruction(c, pc, in)
+	}
+	t.rec = nil
+	if t.err != nil || !t.traced(pc) {
+		return
+	}
+	t.begin(c, &Record{
+		Cycle: c.Cycles,
+		PC:    pc,
+		Bytes: append([]byte(nil), in.Bytes...),
+		Text:  dis51.Format(in, t.Symbols),
+	})
+}
+
+//AfterInstruction completes and writes the record of an instruction
+func (t *Tracer) AfterInstruction(c *mu51.CPU, pc uint16, in mu51.Instruction, err error) {
+	if t.prevObs != nil {
+		t.prevObs.AfterInstruction(c, pc, in, err)
+	}
+	t.finish(c)
+}
+
+//BeforeInterrupt starts the record of vectoring to an interrupt
+func (t *Tracer) BeforeInterrupt(c *mu51.CPU, pc uint16, src int) {
+	if t.prevObs != nil {
+		t.prevObs.BeforeInterrupt(c, pc, src)
+	}
+	t.rec = nil
+	if t.err != nil || !t.traced(mu51.InterruptVector(src)) {
+		return
+	}
+	t.begin(c, &Record{Cycle: c.Cycles, PC: pc, Source: src, Text: vectorText(src)})
+}
+
+//AfterInterrupt completes and writes the record of vectoring
+func (t *Tracer) AfterInterrupt(c *mu51.CPU, pc uint16, src int) {
+	if t.prevObs != nil {
+		t.prevObs.AfterInterrupt(c, pc, src)
+	}
+	t.finish(c)
+}
+
+//begin makes rec the record collecting changes
+func (t *Tracer) begin(c *mu51.CPU, rec *Record) {
+	t.rec = rec
+	t.before = regs(c)
+}
+
+//finish adds the registers changed to the current record and writes it
+func (t *Tracer) finish(c *mu51.CPU) {
+	rec := t.rec
+	t.rec = nil
+	if rec == nil {
+		return
+	}
+	after := regs(c)
+	for r := Reg(0); r < numRegs; r++ {
+		if after[r] != t.before[r] {
+			rec.Changes = append(rec.Changes, Change{Reg: r, Value: after[r]})
+		}
+	}
+	t.err = t.out.WriteRecord(rec)
+}
+
+//onAccess collects the memory written by the traced instruction or
+//vectoring, bit writes are seen through the write of the byte holding
+//them
+func (t *Tracer) onAccess(a mu51.Access) {
+	if t.prevAccess != nil {
+		t.prevAccess(a)
+	}
+	if t.rec != nil && a.Write && a.Space != mu51.SpaceBit {
+		t.rec.Writes = append(t.rec.Writes, a)
+	}
+}
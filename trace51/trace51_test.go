@@ -0,0 +1,266 @@
+package trace51
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JonathanFraser/go51/as51"
+	"github.com/JonathanFraser/go51/mu51"
+)
+
+const testProgram = `
+	ORG 0
+	MOV SP,#50h
+	MOV DPTR,#1234h
+	MOV A,#5Ah
+	MOVX @DPTR,A
+	LCALL SUB
+	SJMP $
+SUB:	SETB 00h
+	RET
+`
+
+//records collects records in memory
+type records []*Record
+
+func (r *records) WriteRecord(rec *Record) error {
+	*r = append(*r, rec)
+	return nil
+}
+
+func newTraceCPU(t *testing.T, program string) *mu51.CPU {
+	p, err := as51.AssembleString(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mu51.NewCPU(mu51.Memory(p.Image(0xFF)), make(mu51.Memory, 0x10000))
+}
+
+func runTrace(t *testing.T, c *mu51.CPU, steps int, ranges []Range, out RecordWriter) {
+	tr := Attach(c, out)
+	tr.Ranges = ranges
+	for i := 0; i < steps; i++ {
+		if err := c.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tr.Detach()
+	if c.OnAccess != nil || c.Observer != nil {
+		t.Error("detach left hooks installed")
+	}
+}
+
+func TestTextTrace(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewTextWriter(&buf)
+	runTrace(t, newTraceCPU(t, testProgram), 7, nil, w)
+	w.Flush()
+	want := []string{
+		"         0 0000 75 81 50  MOV SP,#50h            ; SP=50 sfr[81]=50",
+		"         2 0003 90 12 34  MOV DPTR,#1234h        ; DPTR=1234",
+		"         4 0006 74 5a     MOV A,#5Ah             ; A=5a",
+		"         5 0008 f0        MOVX @DPTR,A           ; xdata[1234]=5a",
+		"         7 0009 12 00 0e  LCALL 000Eh            ; SP=52 iram[51]=0c iram[52]=00",
+		"         9 000e d2 00     SETB 20h.0             ; iram[20]=01",
+		"        10 0010 22        RET                    ; SP=50",
+	}
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trace:\n%s", buf.String())
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	var recs records
+	var buf bytes.Buffer
+	w := NewBinaryWriter(&buf)
+	runTrace(t, newTraceCPU(t, testProgram), 8, nil, &recs)
+	for _, r := range recs {
+		w.WriteRecord(r)
+	}
+	w.Flush()
+
+	r := NewBinaryReader(&buf)
+	for i := 0; ; i++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			if i != len(recs) {
+				t.Errorf("read %d of %d records", i, len(recs))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rec, recs[i]) {
+			t.Errorf("record %d read as %+v, expected %+v", i, rec, recs[i])
+		}
+	}
+	if len(buf.Bytes()) != 0 {
+		t.Error("trailing bytes")
+	}
+
+	if _, err := NewBinaryReader(strings.NewReader("nope")).Read(); err != ErrBadTrace {
+		t.Errorf("bad header gave %v", err)
+	}
+}
+
+func TestTraceRanges(t *testing.T) {
+	var recs records
+	runTrace(t, newTraceCPU(t, testProgram), 8, []Range{{0x0008, 0x0009}, {0x0010, 0x0010}}, &recs)
+	var pcs []uint16
+	for _, r := range recs {
+		pcs = append(pcs, r.PC)
+	}
+	if !reflect.DeepEqual(pcs, []uint16{0x0008, 0x0009, 0x0010}) {
+		t.Errorf("traced %04x", pcs)
+	}
+}
+
+//s51Sample is s51 single stepping testProgram from reset
+const s51Sample = `0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x00   0 .  B= 0x00   DPTR= 0x0000 @DPTR= 0x00   0 .
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x0003 90 12 34 MOV   DPTR,#1234
+0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x00   0 .  B= 0x00   DPTR= 0x1234 @DPTR= 0x00   0 .
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x0006 74 5a    MOV   A,#5a
+0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x5a  90 Z  B= 0x00   DPTR= 0x1234 @DPTR= 0x00   0 .
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x0008 f0       MOVX  @DPTR,A
+0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x5a  90 Z  B= 0x00   DPTR= 0x1234 @DPTR= 0x5a  90 Z
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x0009 12 00 0e LCALL 000e
+0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x5a  90 Z  B= 0x00   DPTR= 0x1234 @DPTR= 0x5a  90 Z
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x000e d2 00    SETB  20.0
+0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x5a  90 Z  B= 0x00   DPTR= 0x1234 @DPTR= 0x5a  90 Z
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x0010 22       RET
+0x00 00 00 00 00 00 00 00 00 ........
+000000 00 .  ACC= 0x5a  90 Z  B= 0x00   DPTR= 0x1234 @DPTR= 0x5a  90 Z
+000000 00 .  PSW= 0x00 CY=0 AC=0 OV=0 P=0
+   0x000c 80 fe    SJMP  000c
+`
+
+func TestS51Trace(t *testing.T) {
+	var buf bytes.Buffer
+	c := newTraceCPU(t, testProgram)
+	w := NewS51Writer(&buf, c)
+	runTrace(t, c, 7, nil, w)
+	w.Flush()
+	if buf.String() != s51Sample {
+		t.Errorf("s51 trace:\n%s", buf.String())
+	}
+
+	cases := []struct {
+		code []byte
+		text string
+	}{
+		{[]byte{0x85, 0x30, 0xE0}, "MOV   ACC,30"},
+		{[]byte{0xB0, 0x05}, "ANL   C,/20.5"},
+		{[]byte{0xC2, 0x8C}, "CLR   TR0"},
+		{[]byte{0x30, 0x93, 0xFD}, "JNB   P1.3,0000"},
+		{[]byte{0x93}, "MOVC  A,@A+DPTR"},
+		{[]byte{0x22}, "RET"},
+		{[]byte{0xA5}, "-- UNKNOWN/INVALID"},
+	}
+	for _, v := range cases {
+		in, err := mu51.Decode(0, v.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := FormatS51(in); s != v.text {
+			t.Errorf("0x%02X formatted as %q, expected %q", v.code[0], s, v.text)
+		}
+	}
+}
+
+func TestS51TracePeeks(t *testing.T) {
+	var reads int
+	xdata := &mu51.Bus{}
+	xdata.MapIO(0x0000, 0x10, &mu51.MMIO{
+		Len:  0x10,
+		Read: func(uint16) uint8 { reads++; return 0 },
+		Peek: func(uint16) uint8 { return 'A' },
+	})
+	var buf bytes.Buffer
+	c := mu51.NewCPU(mu51.Memory{0x00, 0x00}, xdata)
+	w := NewS51Writer(&buf, c)
+	runTrace(t, c, 2, nil, w)
+	w.Flush()
+	if reads != 0 || !strings.Contains(buf.String(), "@DPTR= 0x41  65 A") {
+		t.Errorf("s51 trace read the registers %d times:\n%s", reads, buf.String())
+	}
+}
+
+const interruptProgram = `
+	ORG 0
+	MOV IE,#82h
+	SETB TF0
+	SJMP $
+	ORG 0Bh
+	INC A
+	RETI
+`
+
+func TestInterruptTrace(t *testing.T) {
+	var buf bytes.Buffer
+	var recs records
+	w := NewTextWriter(&buf)
+	runTrace(t, newTraceCPU(t, interruptProgram), 5, nil, tee{w, &recs})
+	w.Flush()
+	want := []string{
+		"         0 0000 75 a8 82  MOV IE,#82h            ; sfr[a8]=82",
+		"         2 0003 d2 8d     SETB TF0               ; sfr[88]=20",
+		"         3 0005           interrupt 1 -> 000Bh   ; SP=09 iram[8]=05 iram[9]=00",
+		"         5 000b 04        INC A                  ; A=01 PSW=01",
+		"         6 000c 32        RETI                   ; SP=07",
+	}
+	got := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("trace:\n%s", buf.String())
+	}
+
+	var bin bytes.Buffer
+	bw := NewBinaryWriter(&bin)
+	for _, r := range recs {
+		bw.WriteRecord(r)
+	}
+	bw.Flush()
+	r := NewBinaryReader(&bin)
+	for i := range recs {
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rec, recs[i]) {
+			t.Errorf("record %d read as %+v, expected %+v", i, rec, recs[i])
+		}
+	}
+
+	//vectoring is traced when the vector is within a range
+	recs = nil
+	runTrace(t, newTraceCPU(t, interruptProgram), 5, []Range{{0x000B, 0x000C}}, &recs)
+	if len(recs) != 3 || !recs[0].Vectored() || recs[0].Source != mu51.IntTimer0 || recs[0].PC != 0x0005 {
+		t.Errorf("ranged trace of vectoring gave %+v", recs)
+	}
+}
+
+//tee writes each record to both writers
+type tee [2]RecordWriter
+
+func (t tee) WriteRecord(r *Record) error {
+	if err := t[0].WriteRecord(r); err != nil {
+		return err
+	}
+	return t[1].WriteRecord(r)
+}